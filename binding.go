@@ -0,0 +1,238 @@
+package httprouter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrMissingParam 表示一个标记为 required 的参数在请求中不存在。
+var ErrMissingParam = errors.New("missing required parameter")
+
+// BindError 描述绑定请求参数到结构体字段时发生的错误。
+// 处理程序通常可以将其映射为 400 Bad Request。
+type BindError struct {
+	Source string // 参数来源，例如 "query"，Params 的类型转换方法为 "path"
+	Name   string // 参数名（结构体标签中的名称）
+	Field  string // 结构体字段名，Params 的类型转换方法返回的错误中为空
+	Value  string // 导致错误的原始值，参数缺失时为空
+	Err    error  // 底层错误，缺失时为 ErrMissingParam
+}
+
+func (e *BindError) Error() string {
+	if errors.Is(e.Err, ErrMissingParam) {
+		return "httprouter: " + e.Source + " parameter '" + e.Name + "' is required"
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("httprouter: invalid value %q for %s parameter '%s': %v", e.Value, e.Source, e.Name, e.Err)
+	}
+	return fmt.Sprintf("httprouter: invalid value %q for %s parameter '%s' (field %s): %v",
+		e.Value, e.Source, e.Name, e.Field, e.Err)
+}
+
+// Int 将名为 name 的路径参数解析为 int。
+// 参数不存在（或为空）时返回包装了 ErrMissingParam 的 *BindError，
+// 无法解析时返回包含参数名与原始值的 *BindError，例如：
+//
+//	id, err := ps.Int("id")
+//	if err != nil {
+//		http.Error(w, err.Error(), http.StatusBadRequest)
+//		return
+//	}
+func (ps Params) Int(name string) (int, error) {
+	value, err := ps.required(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, paramError(name, value, err)
+	}
+	return n, nil
+}
+
+// Int64 与 Int 相同，但解析为 int64。
+func (ps Params) Int64(name string) (int64, error) {
+	value, err := ps.required(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, paramError(name, value, err)
+	}
+	return n, nil
+}
+
+// Uint64 与 Int 相同，但解析为 uint64，负数视为无法解析。
+func (ps Params) Uint64(name string) (uint64, error) {
+	value, err := ps.required(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, paramError(name, value, err)
+	}
+	return n, nil
+}
+
+// Bool 与 Int 相同，但按 strconv.ParseBool 解析为 bool（接受 1、t、true、0、f、false 等）。
+func (ps Params) Bool(name string) (bool, error) {
+	value, err := ps.required(name)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, paramError(name, value, err)
+	}
+	return b, nil
+}
+
+// required 返回名为 name 的路径参数的值，参数不存在或为空时返回包装了 ErrMissingParam 的 *BindError。
+func (ps Params) required(name string) (string, error) {
+	value := ps.ByName(name)
+	if value == "" {
+		return "", &BindError{Source: "path", Name: name, Err: ErrMissingParam}
+	}
+	return value, nil
+}
+
+// paramError 返回描述路径参数 name 的值 value 无法解析的 *BindError。
+func paramError(name, value string, err error) error {
+	var ne *strconv.NumError
+	if errors.As(err, &ne) {
+		err = ne.Err // 参数名与值已经包含在 BindError 中
+	}
+	return &BindError{Source: "path", Name: name, Value: value, Err: err}
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// BindQuery 将请求 URL 中的查询参数绑定到 v 指向的结构体。
+// 只有带有 `query` 标签的导出字段会被填充，例如：
+//
+//	type ListOptions struct {
+//	    Page    int      `query:"page,required"`
+//	    PerPage int      `query:"per_page"`
+//	    Tags    []string `query:"tag"`
+//	}
+//
+// 支持的字段类型包括 string、bool、各类整数与浮点数、它们的指针以及切片（对应重复出现的参数）。
+// 标签选项 required 表示参数必须存在，否则返回包装了 ErrMissingParam 的 *BindError；
+// 类型转换失败同样返回 *BindError。不存在的可选参数保持字段原值不变。
+// 匿名嵌入的结构体字段会被递归处理。
+func BindQuery(r *http.Request, v interface{}) error {
+	return bindValues("query", r.URL.Query(), v)
+}
+
+// bindValues 将 values 按 tag 标签绑定到 v 指向的结构体。
+func bindValues(tag string, values map[string][]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("httprouter: bind target must be a non-nil pointer to a struct")
+	}
+	return bindStruct(tag, values, rv.Elem())
+}
+
+func bindStruct(tag string, values map[string][]string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		name, opts, tagged := strings.Cut(sf.Tag.Get(tag), ",")
+		if sf.Anonymous && name == "" && !tagged && fv.Kind() == reflect.Struct {
+			if err := bindStruct(tag, values, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			if opts == "required" {
+				return &BindError{Source: tag, Name: name, Field: sf.Name, Err: ErrMissingParam}
+			}
+			continue
+		}
+
+		if err := setField(fv, vals); err != nil {
+			value := vals[0]
+			var be *BindError
+			if errors.As(err, &be) {
+				value, err = be.Value, be.Err
+			}
+			return &BindError{Source: tag, Name: name, Field: sf.Name, Value: value, Err: err}
+		}
+	}
+	return nil
+}
+
+// setField 将字符串值转换后写入字段。切片字段接收所有值，其他字段只使用第一个值。
+func setField(fv reflect.Value, vals []string) error {
+	switch fv.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setScalar(s.Index(i), val); err != nil {
+				return &BindError{Value: val, Err: err}
+			}
+		}
+		fv.Set(s)
+		return nil
+	case reflect.Ptr:
+		p := reflect.New(fv.Type().Elem())
+		if err := setScalar(p.Elem(), vals[0]); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	default:
+		return setScalar(fv, vals[0])
+	}
+}
+
+// setScalar 将单个字符串值转换为字段的类型并写入。
+func setScalar(fv reflect.Value, val string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return errors.New("unsupported field type " + fv.Type().String())
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package httprouter
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type pagination struct {
+	Page    int `query:"page,required"`
+	PerPage int `query:"per_page"`
+}
+
+type listQuery struct {
+	pagination
+	Search  string   `query:"q"`
+	Tags    []string `query:"tag"`
+	Active  *bool    `query:"active"`
+	Ratio   float64  `query:"ratio"`
+	Limit   uint8    `query:"limit"`
+	Ignored string
+	Skipped string `query:"-"`
+}
+
+func TestBindQuery(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "/items?page=2&q=go&tag=a&tag=b&active=true&ratio=0.5&limit=10&Ignored=x&-=y", nil)
+
+	q := listQuery{pagination: pagination{PerPage: 20}}
+	if err := BindQuery(r, &q); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	active := true
+	want := listQuery{
+		pagination: pagination{Page: 2, PerPage: 20},
+		Search:     "go",
+		Tags:       []string{"a", "b"},
+		Active:     &active,
+		Ratio:      0.5,
+		Limit:      10,
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("wrong binding result:\nwant %+v\n got %+v", want, q)
+	}
+}
+
+func TestBindQueryErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		missing bool
+		msg     string
+	}{
+		{"", true, "'page' is required"},
+		{"page=x", false, `invalid value "x" for query parameter 'page'`},
+		{"page=1&limit=300", false, `invalid value "300" for query parameter 'limit'`},
+		{"page=1&active=maybe", false, `invalid value "maybe" for query parameter 'active'`},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(http.MethodGet, "/items?"+tt.query, nil)
+		var q listQuery
+		err := BindQuery(r, &q)
+
+		var be *BindError
+		if !errors.As(err, &be) {
+			t.Errorf("%q: expected *BindError, got %v", tt.query, err)
+			continue
+		}
+		if errors.Is(err, ErrMissingParam) != tt.missing {
+			t.Errorf("%q: wrong ErrMissingParam match for %v", tt.query, err)
+		}
+		if !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%q: error %q does not contain %q", tt.query, err.Error(), tt.msg)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/items", nil)
+	if err := BindQuery(r, listQuery{}); err == nil {
+		t.Error("expected error for non-pointer target")
+	}
+}
+
+func TestParamsTypedAccessors(t *testing.T) {
+	ps := Params{
+		{"id", "42"},
+		{"big", "-9000000000"},
+		{"count", "18446744073709551615"},
+		{"flag", "true"},
+		{"name", "gopher"},
+		{"empty", ""},
+	}
+
+	if v, err := ps.Int("id"); v != 42 || err != nil {
+		t.Errorf("Int: %d %v", v, err)
+	}
+	if v, err := ps.Int64("big"); v != -9000000000 || err != nil {
+		t.Errorf("Int64: %d %v", v, err)
+	}
+	if v, err := ps.Uint64("count"); v != 18446744073709551615 || err != nil {
+		t.Errorf("Uint64: %d %v", v, err)
+	}
+	if v, err := ps.Bool("flag"); !v || err != nil {
+		t.Errorf("Bool: %t %v", v, err)
+	}
+
+	for _, tt := range []struct {
+		call    func() error
+		missing bool
+		msg     string
+	}{
+		{func() error { _, err := ps.Int("missing"); return err }, true, "path parameter 'missing' is required"},
+		{func() error { _, err := ps.Int("empty"); return err }, true, "path parameter 'empty' is required"},
+		{func() error { _, err := ps.Int("name"); return err }, false, `invalid value "gopher" for path parameter 'name': invalid syntax`},
+		{func() error { _, err := ps.Int64("name"); return err }, false, `invalid value "gopher" for path parameter 'name'`},
+		{func() error { _, err := ps.Uint64("big"); return err }, false, `invalid value "-9000000000" for path parameter 'big'`},
+		{func() error { _, err := ps.Int64("count"); return err }, false, "value out of range"},
+		{func() error { _, err := ps.Bool("id"); return err }, false, `invalid value "42" for path parameter 'id'`},
+	} {
+		err := tt.call()
+		var be *BindError
+		if !errors.As(err, &be) {
+			t.Errorf("expected *BindError, got %v", err)
+			continue
+		}
+		if errors.Is(err, ErrMissingParam) != tt.missing {
+			t.Errorf("wrong ErrMissingParam match for %v", err)
+		}
+		if !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("error %q does not contain %q", err.Error(), tt.msg)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package httprouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config 汇集了路由器最常用的选项，供 NewWithConfig 在构造时一次性设置，
+// 避免在 New 之后逐个给字段赋值（以及在开始处理请求之后才修改配置造成的数据竞争）。
+// 各字段的含义与 Router 中的同名字段（或同名的设置方法）相同。
+//
+// Config 的零值关闭了所有布尔选项，这与 New 的默认值不同；
+// 需要保留 New 的默认值时，从 DefaultConfig 开始修改。
+type Config struct {
+	RedirectTrailingSlash  bool
+	MergeTrailingSlash     bool
+	RedirectFixedPath      bool
+	RedirectNonIdempotent  bool
+	HandleMethodNotAllowed bool
+	HandleOPTIONS          bool
+	OPTIONSRouteMiddleware bool
+	AutoHead               bool
+	CaseInsensitive        bool
+	DecodeParams           bool
+	SaveMatchedRoutePath   bool
+	StoreRoutePattern      bool
+	AlwaysStoreParams      bool
+	StaticContextAware     bool
+	EmitServerTiming       bool
+	TrackClosestMatch      bool
+
+	// MisdirectedHostHandling 启用时以 421 回复 Host 不匹配的请求
+	MisdirectedHostHandling bool
+
+	// RedirectStatusGET 与 RedirectStatusOther 为 0 时使用默认值 301 与 308，否则必须是 3xx
+	RedirectStatusGET   int
+	RedirectStatusOther int
+
+	NotFound         http.Handler
+	MethodNotAllowed http.Handler
+	GlobalOPTIONS    http.Handler
+	RecoveryHandler  RecoveryHandlerFunc
+
+	// MalformedPathHandler 不为 nil 时启用路径编码检查
+	MalformedPathHandler http.Handler
+
+	// ErrorHandler 是通用的错误处理函数（见 Router.SetErrorHandler），nil 表示默认的错误处理函数；
+	// ErrorHandlers 是按状态码注册的错误处理函数（见 Router.SetErrorHandlerFor）
+	ErrorHandler  ErrorHandlerFunc
+	ErrorHandlers map[int]ErrorHandlerFunc
+
+	// ErrorHandlerExt 是接收错误原因的错误处理函数，见 Router.SetErrorHandlerExt
+	ErrorHandlerExt ErrorHandlerFuncExt
+
+	// Middlewares 与 PostMatchMiddlewares 与依次调用 Use 与 UsePostMatch 的效果相同
+	Middlewares          []Middleware
+	PostMatchMiddlewares []Middleware
+
+	FileSystemForUnmatched http.FileSystem
+	ServeUnmatchedAsStatic bool
+	UnmatchedStaticFilter  func(*http.Request) bool
+
+	UnknownMethodStatus   int
+	MethodOverrideHeader  string
+	MethodOverrideRewrite bool
+	AnyMethods            []string
+	MaxRequestParams      uint16
+	MaxSegments           int
+	DefaultHeaders        http.Header
+	RetryAfter            time.Duration
+
+	// DrainAllowedPaths 中的路径必须以 '/' 开头
+	DrainAllowedPaths []string
+	DrainExempt       func(*http.Request) bool
+
+	PreHandler func(http.ResponseWriter, *http.Request) bool
+	OnRequest  func(*http.Request)
+	OnResponse func(req *http.Request, status int, bytes int, dur time.Duration)
+	OnRegister func(method, path string)
+
+	// Validator 与 MaxJSONBodyBytes 用于 POSTJSON
+	Validator        func(v interface{}) error
+	MaxJSONBodyBytes int64
+
+	// FaviconMissingStatus 必须是 0、http.StatusNoContent 或 http.StatusNotFound
+	FaviconMissingStatus int
+
+	// ParamsContextKeys 中的键不能为 nil，并且必须是可比较的（与 context.WithValue 的要求相同）
+	ParamsContextKeys []interface{}
+	ParamsEncoder     func(ctx context.Context, ps Params) context.Context
+
+	Clock func() time.Time
+}
+
+// DefaultConfig 返回与 New 的默认设置相同的 Config。
+func DefaultConfig() Config {
+	return Config{
+		RedirectTrailingSlash:  true,
+		RedirectFixedPath:      true,
+		RedirectNonIdempotent:  true,
+		HandleMethodNotAllowed: true,
+		HandleOPTIONS:          true,
+		RedirectStatusGET:      http.StatusMovedPermanently,
+		RedirectStatusOther:    http.StatusPermanentRedirect,
+	}
+}
+
+// NewWithConfig 返回按 cfg 配置的新路由器，与调用 New 之后逐个设置对应字段的结果相同。
+// cfg 中的切片与映射会被复制，之后修改它们不影响路由器。
+// 相互矛盾或没有意义的组合会导致 panic，见 Config.validate。
+func NewWithConfig(cfg Config) *Router {
+	if err := cfg.validate(); err != nil {
+		panic(err.Error())
+	}
+
+	r := New()
+	r.RedirectTrailingSlash = cfg.RedirectTrailingSlash
+	r.MergeTrailingSlash = cfg.MergeTrailingSlash
+	r.RedirectFixedPath = cfg.RedirectFixedPath
+	r.RedirectNonIdempotent = cfg.RedirectNonIdempotent
+	r.HandleMethodNotAllowed = cfg.HandleMethodNotAllowed
+	r.HandleOPTIONS = cfg.HandleOPTIONS
+	r.OPTIONSRouteMiddleware = cfg.OPTIONSRouteMiddleware
+	r.AutoHead = cfg.AutoHead
+	r.CaseInsensitive = cfg.CaseInsensitive
+	r.DecodeParams = cfg.DecodeParams
+	r.SaveMatchedRoutePath = cfg.SaveMatchedRoutePath
+	r.StoreRoutePattern = cfg.StoreRoutePattern
+	r.AlwaysStoreParams = cfg.AlwaysStoreParams
+	r.StaticContextAware = cfg.StaticContextAware
+	r.EmitServerTiming = cfg.EmitServerTiming
+	r.TrackClosestMatch = cfg.TrackClosestMatch
+	r.MisdirectedHostHandling = cfg.MisdirectedHostHandling
+	if cfg.RedirectStatusGET != 0 {
+		r.RedirectStatusGET = cfg.RedirectStatusGET
+	}
+	if cfg.RedirectStatusOther != 0 {
+		r.RedirectStatusOther = cfg.RedirectStatusOther
+	}
+
+	r.NotFound = cfg.NotFound
+	r.MethodNotAllowed = cfg.MethodNotAllowed
+	r.GlobalOPTIONS = cfg.GlobalOPTIONS
+	r.RecoveryHandler = cfg.RecoveryHandler
+	r.MalformedPathHandler = cfg.MalformedPathHandler
+	r.SetErrorHandler(cfg.ErrorHandler)
+	for code, h := range cfg.ErrorHandlers {
+		r.SetErrorHandlerFor(code, h)
+	}
+	r.SetErrorHandlerExt(cfg.ErrorHandlerExt)
+
+	r.Use(cfg.Middlewares...)
+	r.UsePostMatch(cfg.PostMatchMiddlewares...)
+
+	r.FileSystemForUnmatched = cfg.FileSystemForUnmatched
+	r.ServeUnmatchedAsStatic = cfg.ServeUnmatchedAsStatic
+	r.UnmatchedStaticFilter = cfg.UnmatchedStaticFilter
+	r.UnknownMethodStatus = cfg.UnknownMethodStatus
+	r.MethodOverrideHeader = cfg.MethodOverrideHeader
+	r.MethodOverrideRewrite = cfg.MethodOverrideRewrite
+	r.AnyMethods = slices.Clone(cfg.AnyMethods)
+	r.MaxRequestParams = cfg.MaxRequestParams
+	r.MaxSegments = cfg.MaxSegments
+	r.DefaultHeaders = cfg.DefaultHeaders.Clone()
+	r.RetryAfter = cfg.RetryAfter
+	r.DrainAllowedPaths = slices.Clone(cfg.DrainAllowedPaths)
+	r.DrainExempt = cfg.DrainExempt
+	r.PreHandler = cfg.PreHandler
+	r.OnRequest = cfg.OnRequest
+	r.OnResponse = cfg.OnResponse
+	r.OnRegister = cfg.OnRegister
+	r.Validator = cfg.Validator
+	r.MaxJSONBodyBytes = cfg.MaxJSONBodyBytes
+	r.FaviconMissingStatus = cfg.FaviconMissingStatus
+	r.ParamsContextKeys = slices.Clone(cfg.ParamsContextKeys)
+	r.ParamsEncoder = cfg.ParamsEncoder
+	r.Clock = cfg.Clock
+	return r
+}
+
+// validate 检查配置中相互矛盾或没有意义的组合：
+//   - 重定向状态码不是 3xx；
+//   - 设置了 MethodNotAllowed 却关闭了 HandleMethodNotAllowed（处理程序永远不会被调用）；
+//   - 设置了 GlobalOPTIONS 或 OPTIONSRouteMiddleware 却关闭了 HandleOPTIONS；
+//   - 启用了 ServeUnmatchedAsStatic 却没有 FileSystemForUnmatched；
+//   - 启用了 MethodOverrideRewrite 却没有 MethodOverrideHeader；
+//   - UnknownMethodStatus 不是 0 或错误状态码（4xx、5xx）；
+//   - AnyMethods 不是 nil 但为空，或包含空的方法名；
+//   - MaxSegments 或 RetryAfter 为负数；
+//   - ErrorHandlers 中的状态码不是错误状态码，或处理函数为 nil；
+//   - 启用了 TrackClosestMatch 却没有 NotFound（最长前缀只提供给 NotFound 处理程序）；
+//   - DrainAllowedPaths 中的路径不以 '/' 开头（永远不会与请求路径相等）；
+//   - FaviconMissingStatus 不是 0、204 或 404；
+//   - ParamsContextKeys 中的键为 nil 或不可比较。
+func (cfg *Config) validate() error {
+	for _, code := range []int{cfg.RedirectStatusGET, cfg.RedirectStatusOther} {
+		if code != 0 && !isRedirectStatus(code) {
+			return fmt.Errorf("redirect status codes must be 3xx, got %d", code)
+		}
+	}
+	if cfg.MethodNotAllowed != nil && !cfg.HandleMethodNotAllowed {
+		return errors.New("MethodNotAllowed is set but HandleMethodNotAllowed is disabled")
+	}
+	if (cfg.GlobalOPTIONS != nil || cfg.OPTIONSRouteMiddleware) && !cfg.HandleOPTIONS {
+		return errors.New("GlobalOPTIONS or OPTIONSRouteMiddleware is set but HandleOPTIONS is disabled")
+	}
+	if cfg.ServeUnmatchedAsStatic && cfg.FileSystemForUnmatched == nil {
+		return errors.New("ServeUnmatchedAsStatic is enabled but FileSystemForUnmatched is nil")
+	}
+	if cfg.MethodOverrideRewrite && cfg.MethodOverrideHeader == "" {
+		return errors.New("MethodOverrideRewrite is enabled but MethodOverrideHeader is empty")
+	}
+	if s := cfg.UnknownMethodStatus; s != 0 && (s < 400 || s > 599) {
+		return fmt.Errorf("UnknownMethodStatus must be 0 or an error status code, got %d", s)
+	}
+	if cfg.AnyMethods != nil && len(cfg.AnyMethods) == 0 {
+		return errors.New("AnyMethods must not be empty")
+	}
+	if slices.Contains(cfg.AnyMethods, "") {
+		return errors.New("AnyMethods must not contain an empty method")
+	}
+	if cfg.MaxSegments < 0 || cfg.RetryAfter < 0 {
+		return errors.New("MaxSegments and RetryAfter must not be negative")
+	}
+	for _, code := range slices.Sorted(maps.Keys(cfg.ErrorHandlers)) {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("ErrorHandlers keys must be error status codes, got %d", code)
+		}
+		if cfg.ErrorHandlers[code] == nil {
+			return fmt.Errorf("nil error handler for status code %d", code)
+		}
+	}
+	if cfg.TrackClosestMatch && cfg.NotFound == nil {
+		return errors.New("TrackClosestMatch is enabled but NotFound is nil")
+	}
+	for _, p := range cfg.DrainAllowedPaths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("DrainAllowedPaths entries must begin with '/', got %q", p)
+		}
+	}
+	switch cfg.FaviconMissingStatus {
+	case 0, http.StatusNoContent, http.StatusNotFound:
+	default:
+		return fmt.Errorf("FaviconMissingStatus must be 0, 204 or 404, got %d", cfg.FaviconMissingStatus)
+	}
+	for _, key := range cfg.ParamsContextKeys {
+		if key == nil || !reflect.TypeOf(key).Comparable() {
+			return fmt.Errorf("ParamsContextKeys must contain non-nil comparable keys, got %#v", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewWithConfig(t *testing.T) {
+	errorHandler := func(w http.ResponseWriter, _ *http.Request, code int) {
+		w.WriteHeader(code)
+		w.Write([]byte("custom error"))
+	}
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "1")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	cfg := DefaultConfig()
+	cfg.RedirectTrailingSlash = false
+	cfg.HandleOPTIONS = false
+	cfg.CaseInsensitive = true
+	cfg.AutoHead = true
+	cfg.ErrorHandler = errorHandler
+	cfg.Middlewares = []Middleware{middleware}
+	cfg.DefaultHeaders = http.Header{"X-Default": {"yes"}}
+	configured := NewWithConfig(cfg)
+
+	manual := New()
+	manual.RedirectTrailingSlash = false
+	manual.HandleOPTIONS = false
+	manual.CaseInsensitive = true
+	manual.AutoHead = true
+	manual.SetErrorHandler(errorHandler)
+	manual.Use(middleware)
+	manual.DefaultHeaders = http.Header{"X-Default": {"yes"}}
+
+	// the configuration is copied, not shared
+	cfg.DefaultHeaders.Set("X-Default", "changed")
+
+	h := func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte("user " + ps.ByName("id")))
+	}
+	for _, router := range []*Router{configured, manual} {
+		router.GET("/Users/:id", h)
+	}
+
+	requests := []struct{ method, path string }{
+		{http.MethodGet, "/users/42"},
+		{http.MethodHead, "/USERS/42"},
+		{http.MethodGet, "/users/42/"},
+		{http.MethodPost, "/users/42"},
+		{http.MethodOptions, "/users/42"},
+		{http.MethodGet, "/missing"},
+	}
+	for _, req := range requests {
+		serve := func(router *Router) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(req.method, req.path, nil)
+			router.ServeHTTP(w, r)
+			return w
+		}
+		got, want := serve(configured), serve(manual)
+		if got.Code != want.Code || got.Body.String() != want.Body.String() || !reflect.DeepEqual(got.Header(), want.Header()) {
+			t.Errorf("%s %s: NewWithConfig %d %q %v, field-configured %d %q %v", req.method, req.path,
+				got.Code, got.Body.String(), got.Header(), want.Code, want.Body.String(), want.Header())
+		}
+	}
+
+	if d := NewWithConfig(DefaultConfig()); !d.RedirectTrailingSlash || !d.RedirectFixedPath || !d.HandleMethodNotAllowed ||
+		!d.HandleOPTIONS || !d.RedirectNonIdempotent || !d.IsUsingDefaultErrorHandler() ||
+		d.RedirectStatusGET != http.StatusMovedPermanently || d.RedirectStatusOther != http.StatusPermanentRedirect {
+		t.Errorf("DefaultConfig does not match New: %+v", d)
+	}
+}
+
+func TestNewWithConfigFields(t *testing.T) {
+	// every exported Router field can be set through Config
+	configType := reflect.TypeOf(Config{})
+	routerType := reflect.TypeOf(Router{})
+	for i := 0; i < routerType.NumField(); i++ {
+		f := routerType.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if cf, ok := configType.FieldByName(f.Name); !ok || cf.Type != f.Type {
+			t.Errorf("Router.%s has no matching Config field", f.Name)
+		}
+	}
+
+	type key struct{}
+	cfg := DefaultConfig()
+	cfg.EmitServerTiming = true
+	cfg.NotFound = http.RedirectHandler("/", http.StatusFound)
+	cfg.TrackClosestMatch = true
+	cfg.MisdirectedHostHandling = true
+	cfg.MalformedPathHandler = http.RedirectHandler("/", http.StatusFound)
+	cfg.DrainAllowedPaths = []string{"/healthz"}
+	cfg.DrainExempt = func(*http.Request) bool { return false }
+	cfg.PreHandler = func(http.ResponseWriter, *http.Request) bool { return true }
+	cfg.OnRequest = func(*http.Request) {}
+	cfg.OnResponse = func(*http.Request, int, int, time.Duration) {}
+	cfg.OnRegister = func(string, string) {}
+	cfg.Validator = func(interface{}) error { return nil }
+	cfg.MaxJSONBodyBytes = -1
+	cfg.FaviconMissingStatus = http.StatusNotFound
+	cfg.ParamsContextKeys = []interface{}{key{}}
+	cfg.ParamsEncoder = func(ctx context.Context, _ Params) context.Context { return ctx }
+	cfg.Clock = time.Now
+	router := NewWithConfig(cfg)
+
+	// the slices are copied, not shared
+	cfg.DrainAllowedPaths[0] = "/changed"
+	cfg.ParamsContextKeys[0] = "changed"
+
+	configValue, routerValue := reflect.ValueOf(cfg), reflect.ValueOf(router).Elem()
+	for i := 0; i < configType.NumField(); i++ {
+		name := configType.Field(i).Name
+		got := routerValue.FieldByName(name)
+		if !got.IsValid() {
+			continue // set through a method, e.g. ErrorHandler
+		}
+		want := configValue.Field(i)
+		switch {
+		case want.Kind() == reflect.Func:
+			if want.IsNil() != got.IsNil() || (!want.IsNil() && want.Pointer() != got.Pointer()) {
+				t.Errorf("%s not copied", name)
+			}
+		case name == "DrainAllowedPaths":
+			if !reflect.DeepEqual(router.DrainAllowedPaths, []string{"/healthz"}) {
+				t.Errorf("DrainAllowedPaths shared with the Config: %q", router.DrainAllowedPaths)
+			}
+		case name == "ParamsContextKeys":
+			if !reflect.DeepEqual(router.ParamsContextKeys, []interface{}{key{}}) {
+				t.Errorf("ParamsContextKeys shared with the Config: %v", router.ParamsContextKeys)
+			}
+		case name == "Middlewares" || name == "PostMatchMiddlewares":
+			// registered through Use and UsePostMatch, see TestNewWithConfig
+		default:
+			if !reflect.DeepEqual(want.Interface(), got.Interface()) {
+				t.Errorf("%s: want %v, got %v", name, want.Interface(), got.Interface())
+			}
+		}
+	}
+}
+
+func TestNewWithConfigValidation(t *testing.T) {
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	invalid := map[string]func(*Config){
+		"redirect status":    func(c *Config) { c.RedirectStatusGET = http.StatusOK },
+		"method not allowed": func(c *Config) { c.MethodNotAllowed = handler; c.HandleMethodNotAllowed = false },
+		"global options":     func(c *Config) { c.GlobalOPTIONS = handler; c.HandleOPTIONS = false },
+		"unmatched static":   func(c *Config) { c.ServeUnmatchedAsStatic = true },
+		"override rewrite":   func(c *Config) { c.MethodOverrideRewrite = true },
+		"unknown method":     func(c *Config) { c.UnknownMethodStatus = http.StatusOK },
+		"empty any methods":  func(c *Config) { c.AnyMethods = []string{} },
+		"negative segments":  func(c *Config) { c.MaxSegments = -1 },
+		"error handler code": func(c *Config) { c.ErrorHandlers = map[int]ErrorHandlerFunc{200: defaultErrorHandler} },
+		"nil error handler":  func(c *Config) { c.ErrorHandlers = map[int]ErrorHandlerFunc{404: nil} },
+		"closest match":      func(c *Config) { c.TrackClosestMatch = true },
+		"drain path":         func(c *Config) { c.DrainAllowedPaths = []string{"healthz"} },
+		"favicon status":     func(c *Config) { c.FaviconMissingStatus = http.StatusOK },
+		"nil params key":     func(c *Config) { c.ParamsContextKeys = []interface{}{nil} },
+		"params key":         func(c *Config) { c.ParamsContextKeys = []interface{}{[]string{"x"}} },
+	}
+	for name, modify := range invalid {
+		cfg := DefaultConfig()
+		modify(&cfg)
+		if recv := catchPanic(func() { NewWithConfig(cfg) }); recv == nil {
+			t.Errorf("%s: expected panic", name)
+		}
+	}
+
+	if recv := catchPanic(func() { NewWithConfig(Config{}) }); recv != nil {
+		t.Errorf("zero Config rejected: %v", recv)
+	}
+}
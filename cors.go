@@ -0,0 +1,223 @@
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions 配置 CORS 中间件。零值字段使用对应的默认值。
+type CORSOptions struct {
+	// AllowedOrigins 是允许的来源列表，例如 "https://example.com"，比较时忽略大小写。
+	// "*" 允许任意来源。AllowedOrigins 与 AllowOriginFunc 都为空时允许任意来源。
+	AllowedOrigins []string
+
+	// AllowOriginFunc 是可选的来源匹配函数，返回 true 表示允许该来源。
+	// 它在 AllowedOrigins 不匹配时调用，例如用于匹配某个域名的所有子域。
+	AllowOriginFunc func(origin string) bool
+
+	// AllowedMethods 是预检请求允许的方法，默认为 GET、HEAD 与 POST
+	AllowedMethods []string
+
+	// AllowedHeaders 是预检请求允许的请求头部，比较时忽略大小写，
+	// 默认为 Accept、Content-Type 与 X-Requested-With；"*" 允许任意头部
+	AllowedHeaders []string
+
+	// ExposedHeaders 是允许跨源脚本读取的响应头部
+	ExposedHeaders []string
+
+	// AllowCredentials 允许携带凭据（Cookie、HTTP 认证等）的跨源请求。
+	// 此时必须通过 AllowedOrigins（不含 "*"）或 AllowOriginFunc 明确给出允许的来源，否则 CORS panic
+	AllowCredentials bool
+
+	// MaxAge 是浏览器缓存预检结果的时长，以秒为单位发送；为 0 时不设置 Access-Control-Max-Age
+	MaxAge time.Duration
+}
+
+// cors 是预处理之后的 CORSOptions。
+type cors struct {
+	anyOrigin      bool
+	origins        []string
+	originFunc     func(string) bool
+	methods        []string
+	anyHeader      bool
+	headers        []string
+	allowMethods   string
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+// CORS 返回一个处理跨源资源共享（CORS）的中间件。
+//
+// 对于预检请求（带有 Origin 与 Access-Control-Request-Method 头部的 OPTIONS 请求），
+// 中间件直接以 204 No Content 回复，不再调用后续的处理程序：
+// 来源、方法与请求头部都被允许时，回复中包含 Access-Control-Allow-* 头部，否则不包含，浏览器会拒绝该跨源请求。
+// 因此预检请求不会再到达路由器的自动 OPTIONS 回复（HandleOPTIONS、GlobalOPTIONS），两者不会重复处理；
+// 不带 Access-Control-Request-Method 的普通 OPTIONS 请求照常交给路由器。
+//
+// 对于其他带有 Origin 头部的请求，来源被允许时设置 Access-Control-Allow-Origin
+// （以及 Access-Control-Allow-Credentials 与 Access-Control-Expose-Headers），然后调用后续的处理程序。
+//
+// 允许任意来源时，Access-Control-Allow-Origin 为 "*"；允许凭据时回复请求的 Origin。
+// 允许凭据的同时允许任意来源（AllowedOrigins 为空或包含 "*"）会让任何网站以用户的身份读取响应，
+// 因此 CORS 在这种配置下 panic。
+// 回复内容取决于请求来源时，响应带有 Vary: Origin，使缓存按来源区分响应。
+//
+// 中间件应当通过 Use 全局应用，使预检请求在路由之前得到处理；
+// 只应用于某个组时，需要同时启用 OPTIONSRouteMiddleware，使自动 OPTIONS 回复经过组中间件。
+func CORS(opts CORSOptions) Middleware {
+	c := &cors{
+		originFunc:  opts.AllowOriginFunc,
+		credentials: opts.AllowCredentials,
+		methods:     opts.AllowedMethods,
+	}
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+		} else {
+			c.origins = append(c.origins, strings.ToLower(origin))
+		}
+	}
+	if len(opts.AllowedOrigins) == 0 && opts.AllowOriginFunc == nil {
+		c.anyOrigin = true
+	}
+	if c.anyOrigin && c.credentials {
+		panic("AllowCredentials requires an explicit AllowedOrigins list without '*' or an AllowOriginFunc")
+	}
+	if len(c.methods) == 0 {
+		c.methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	c.allowMethods = strings.Join(c.methods, ", ")
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Accept", "Content-Type", "X-Requested-With"}
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.anyHeader = true
+		} else {
+			c.headers = append(c.headers, strings.ToLower(h))
+		}
+	}
+	c.exposedHeaders = strings.Join(opts.ExposedHeaders, ", ")
+	if opts.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(opts.MaxAge / time.Second))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, req, origin)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h := w.Header()
+			if c.allowOrigin(h, origin) {
+				if c.exposedHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+				}
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// allowOrigin 在来源被允许时设置 Access-Control-Allow-Origin 与 Access-Control-Allow-Credentials，
+// 并在回复取决于来源时添加 Vary: Origin。返回来源是否被允许。
+func (c *cors) allowOrigin(h http.Header, origin string) bool {
+	if !c.anyOrigin {
+		h.Add("Vary", "Origin")
+	}
+	if !c.originAllowed(origin) {
+		return false
+	}
+	if c.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+func (c *cors) originAllowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	for _, o := range c.origins {
+		if o == lower {
+			return true
+		}
+	}
+	return c.originFunc != nil && c.originFunc(origin)
+}
+
+// preflight 为预检请求设置回复头部，请求不被允许时只设置 Vary。
+func (c *cors) preflight(w http.ResponseWriter, req *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	method := req.Header.Get("Access-Control-Request-Method")
+	allowed := false
+	for _, m := range c.methods {
+		if m == method {
+			allowed = true
+			break
+		}
+	}
+	var requested []string
+	for _, v := range req.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				requested = append(requested, name)
+			}
+		}
+	}
+	if !allowed || !c.headersAllowed(requested) {
+		if !c.anyOrigin {
+			h.Add("Vary", "Origin")
+		}
+		return
+	}
+
+	if !c.allowOrigin(h, origin) {
+		return
+	}
+	h.Set("Access-Control-Allow-Methods", c.allowMethods)
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+}
+
+func (c *cors) headersAllowed(requested []string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, name := range requested {
+		found := false
+		for _, h := range c.headers {
+			if strings.EqualFold(h, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
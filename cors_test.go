@@ -0,0 +1,132 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	newRouter := func(opts CORSOptions) *Router {
+		router := New()
+		router.Use(CORS(opts))
+		router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-Global-Options", "called")
+			w.WriteHeader(http.StatusOK)
+		})
+		router.GET("/items", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Write([]byte("items"))
+		})
+		router.PUT("/items", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+		return router
+	}
+	serve := func(router *Router, method, origin string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, "/items", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+	preflight := func(method, headers string) http.Header {
+		h := http.Header{"Access-Control-Request-Method": {method}}
+		if headers != "" {
+			h.Set("Access-Control-Request-Headers", headers)
+		}
+		return h
+	}
+
+	// wildcard origins
+	router := newRouter(CORSOptions{ExposedHeaders: []string{"X-Total"}})
+	w := serve(router, http.MethodGet, "https://a.example", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" || w.Body.String() != "items" {
+		t.Errorf("wildcard origin: %q %q", got, w.Body.String())
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Total" {
+		t.Errorf("wrong exposed headers: %q", got)
+	}
+	if got := w.Header().Values("Vary"); len(got) != 0 {
+		t.Errorf("constant wildcard reply must not vary by origin: %q", got)
+	}
+	if w := serve(router, http.MethodGet, "", nil); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS headers set for a same-origin request")
+	}
+
+	// preflight short-circuits before the automatic OPTIONS reply
+	w = serve(router, http.MethodOptions, "https://a.example", preflight(http.MethodPost, "content-type"))
+	if w.Code != http.StatusNoContent || w.Header().Get("X-Global-Options") != "" || w.Header().Get("Allow") != "" {
+		t.Errorf("preflight handled twice: %d %v", w.Code, w.Header())
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, HEAD, POST" {
+		t.Errorf("wrong allowed methods: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "content-type" {
+		t.Errorf("wrong allowed headers: %q", got)
+	}
+	for _, h := range []http.Header{preflight(http.MethodDelete, ""), preflight(http.MethodGet, "X-Secret")} {
+		w = serve(router, http.MethodOptions, "https://a.example", h)
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("disallowed preflight %v accepted: %d %v", h, w.Code, w.Header())
+		}
+	}
+
+	// plain OPTIONS requests are still answered by the router
+	w = serve(router, http.MethodOptions, "https://a.example", nil)
+	if w.Header().Get("X-Global-Options") != "called" || w.Header().Get("Allow") != "GET, OPTIONS, PUT" {
+		t.Errorf("plain OPTIONS not passed to the router: %v", w.Header())
+	}
+
+	// credentialed requests echo the origin instead of *
+	router = newRouter(CORSOptions{
+		AllowedOrigins:   []string{"https://app.example"},
+		AllowOriginFunc:  func(origin string) bool { return strings.HasSuffix(origin, ".trusted.example") },
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"*"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	for _, origin := range []string{"https://APP.example", "https://x.trusted.example"} {
+		w = serve(router, http.MethodGet, origin, nil)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("want origin %q echoed, got %q", origin, got)
+		}
+		if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("%s: credentials not allowed", origin)
+		}
+		if got := w.Header().Values("Vary"); len(got) != 1 || got[0] != "Origin" {
+			t.Errorf("%s: want Vary: Origin, got %q", origin, got)
+		}
+	}
+	w = serve(router, http.MethodGet, "https://evil.example", nil)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "Origin" || w.Body.String() != "items" {
+		t.Errorf("disallowed origin: %v %q", w.Header(), w.Body.String())
+	}
+
+	w = serve(router, http.MethodOptions, "https://app.example", preflight(http.MethodPut, "X-Anything, X-Other"))
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("preflight origin: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "X-Anything, X-Other" {
+		t.Errorf("preflight headers: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("preflight max age: %q", got)
+	}
+
+	// credentials require an explicit origin list or function
+	for _, opts := range []CORSOptions{
+		{AllowCredentials: true},
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		{AllowedOrigins: []string{"https://app.example", "*"}, AllowCredentials: true},
+	} {
+		if recv := catchPanic(func() { CORS(opts) }); recv == nil {
+			t.Errorf("origins %q with credentials: want panic", opts.AllowedOrigins)
+		}
+	}
+}
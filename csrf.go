@@ -0,0 +1,124 @@
+package httprouter
+
+import (
+	"context"
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+)
+
+// CSRFOptions 配置 CSRF 中间件。零值字段使用对应的默认值。
+type CSRFOptions struct {
+	// CookieName 是保存令牌的 Cookie 名称，默认为 "csrf_token"
+	CookieName string
+
+	// CookiePath 是 Cookie 的 Path 属性，默认为 "/"
+	CookiePath string
+
+	// Secure 设置 Cookie 的 Secure 属性，生产环境中应当启用
+	Secure bool
+
+	// SameSite 是 Cookie 的 SameSite 属性，默认为 http.SameSiteLaxMode
+	SameSite http.SameSite
+
+	// HeaderName 是提交令牌的请求头部，默认为 "X-CSRF-Token"；设为 "-" 表示不从头部读取
+	HeaderName string
+
+	// FormField 是提交令牌的表单字段，默认为 "csrf_token"；设为 "-" 表示不从表单读取
+	FormField string
+}
+
+type csrfKey struct{}
+
+type csrfState struct {
+	token string
+	field string
+}
+
+// CSRF 返回一个使用双重提交 Cookie 方式防御跨站请求伪造的中间件。
+// 每个请求都会获得一个令牌：沿用 Cookie 中已有的令牌，或者生成新的令牌并写入 Cookie。
+// 对于改变状态的方法（GET、HEAD、OPTIONS、TRACE 以外的方法），请求必须通过头部或表单字段提交
+// 与 Cookie 相同的令牌（先检查头部），否则以 403 Forbidden（经由错误处理器）拒绝。
+//
+// 处理程序可以通过 CSRFToken 获取令牌（例如写入 JavaScript 请求的头部），
+// 或者通过 CSRFField 在表单中渲染隐藏字段。
+// 中间件可以只应用于需要保护的组，例如 router.Group("/admin").Use(CSRF(CSRFOptions{Secure: true}))。
+func CSRF(opts CSRFOptions) Middleware {
+	if opts.CookieName == "" {
+		opts.CookieName = "csrf_token"
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if opts.FormField == "" {
+		opts.FormField = "csrf_token"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var token string
+			if c, err := req.Cookie(opts.CookieName); err == nil && len(c.Value) == 32 {
+				token = c.Value
+			} else {
+				token = newRequestID()
+				http.SetCookie(w, &http.Cookie{
+					Name:     opts.CookieName,
+					Value:    token,
+					Path:     opts.CookiePath,
+					Secure:   opts.Secure,
+					HttpOnly: true,
+					SameSite: opts.SameSite,
+				})
+			}
+			w.Header().Add("Vary", "Cookie")
+
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				var submitted string
+				if opts.HeaderName != "-" {
+					submitted = req.Header.Get(opts.HeaderName)
+				}
+				if submitted == "" && opts.FormField != "-" {
+					submitted = req.PostFormValue(opts.FormField)
+				}
+				if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+					serveMiddlewareError(w, req, http.StatusForbidden)
+					return
+				}
+			}
+
+			field := opts.FormField
+			if field == "-" {
+				field = ""
+			}
+			ctx := context.WithValue(req.Context(), csrfKey{}, csrfState{token: token, field: field})
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// CSRFToken 返回 CSRF 中间件为请求分配的令牌，不存在时返回空字符串。
+func CSRFToken(ctx context.Context) string {
+	s, _ := ctx.Value(csrfKey{}).(csrfState)
+	return s.token
+}
+
+// CSRFField 返回一个携带 CSRF 令牌的隐藏表单字段，用于在 html/template 模板中渲染：
+//
+//	<form method="post">{{ .CSRFField }} ... </form>
+//
+// 请求未经过 CSRF 中间件或禁用了表单字段时返回空字符串。
+func CSRFField(ctx context.Context) template.HTML {
+	s, _ := ctx.Value(csrfKey{}).(csrfState)
+	if s.token == "" || s.field == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(s.field) +
+		`" value="` + s.token + `">`)
+}
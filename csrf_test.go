@@ -0,0 +1,73 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	router := New()
+	var field string
+	admin := router.Group("/admin")
+	admin.Use(CSRF(CSRFOptions{}))
+	admin.GET("/form", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		field = string(CSRFField(r.Context()))
+		w.Write([]byte(CSRFToken(r.Context())))
+	})
+	admin.POST("/form", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	// safe methods pass and receive a token cookie
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/admin/form", nil)
+	router.ServeHTTP(w, r)
+	token := w.Body.String()
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(token) != 32 || len(cookies) != 1 || cookies[0].Value != token {
+		t.Fatalf("token not issued: %d %q %v", w.Code, token, cookies)
+	}
+	if want := `<input type="hidden" name="csrf_token" value="` + token + `">`; field != want {
+		t.Errorf("want field %q, got %q", want, field)
+	}
+
+	post := func(header, form string) int {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodPost, "/admin/form", strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookies[0])
+		if header != "" {
+			r.Header.Set("X-CSRF-Token", header)
+		}
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	for _, tc := range []struct {
+		header, form string
+		code         int
+	}{
+		{"", "", http.StatusForbidden},
+		{"wrong", "", http.StatusForbidden},
+		{token, "", http.StatusOK},
+		{"", url.Values{"csrf_token": {token}}.Encode(), http.StatusOK},
+		{"", url.Values{"csrf_token": {"x"}}.Encode(), http.StatusForbidden},
+	} {
+		if code := post(tc.header, tc.form); code != tc.code {
+			t.Errorf("header=%q form=%q: want %d, got %d", tc.header, tc.form, tc.code, code)
+		}
+	}
+
+	// header-only extraction ignores the form field
+	router = New()
+	router.Use(CSRF(CSRFOptions{FormField: "-"}))
+	router.POST("/", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/", strings.NewReader("csrf_token="+token))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookies[0])
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("form token accepted with form extraction disabled: %d", w.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package httprouter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Explain 返回一段可读的文本，逐步说明路由器会如何处理给定方法与路径的请求：
+// 使用哪棵 trie 树、是否匹配到路由（以及路由模式与参数）、是否会触发尾部斜杠或路径修正重定向、
+// 允许的方法列表，以及最终是否会交给静态文件或 NotFound 处理。
+// 用于排查“为什么这个请求返回 404”之类的问题。
+//
+// Explain 只读取路由表，不调用任何处理程序或中间件，不影响请求处理。
+// 它不考虑全局中间件、PreHandler 以及路由上的守卫（Host、Active 等）可能做出的决定。
+// 启用 DecodeParams 时，path 应与 ServeHTTP 匹配时使用的路径一样是编码形式（URL.EscapedPath），显示的参数值是解码后的值。
+func (r *Router) Explain(method, path string) string {
+	var b strings.Builder
+	step := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format+"\n", args...)
+	}
+
+	step("request: %s %s", method, path)
+	if r.draining.Load() && !r.drainAllowed(path) {
+		if r.DrainExempt == nil {
+			step("router is not accepting new requests: 503 Service Unavailable")
+			return b.String()
+		}
+		step("router is not accepting new requests: 503 Service Unavailable unless DrainExempt allows the request")
+	}
+
+	if r.MaxSegments > 0 && tooManySegments(path, r.MaxSegments) {
+		step("too many segments (MaxSegments %d): 414 URI Too Long", r.MaxSegments)
+		return b.String()
+	}
+
+	t := r.liveTable()
+	root := t.trees[method]
+	if root == nil {
+		step("tree: no routes registered for method %s", method)
+	} else {
+		step("tree: %s", method)
+		routePath := r.routePath(path)
+		newParams := func() *Params {
+			ps := make(Params, 0, t.maxParams)
+			return &ps
+		}
+		handle, psp, tsr := root.getFoldedValue(routePath, path, newParams)
+		// 与 ServeHTTP 相同：启用 MergeTrailingSlash 时，只差尾部斜杠的路由直接处理请求
+		if handle == nil && tsr && r.MergeTrailingSlash {
+			mergedRoute, mergedPath := toggleTrailingSlash(routePath), toggleTrailingSlash(path)
+			if h, ps, _ := root.getFoldedValue(mergedRoute, mergedPath, newParams); h != nil {
+				step("trailing slash merged: %s (MergeTrailingSlash)", mergedPath)
+				handle, psp = h, ps
+				routePath, path = mergedRoute, mergedPath
+			}
+		}
+		if handle != nil {
+			step("matched route: %s %s", method, root.matchedFoldedPattern(routePath, path))
+			if psp != nil && len(*psp) > 0 {
+				if r.DecodeParams {
+					decodeParams(*psp)
+				}
+				params := make([]string, len(*psp))
+				for i, p := range *psp {
+					params[i] = p.Key + "=" + p.Value
+				}
+				step("params: %s", strings.Join(params, ", "))
+			}
+			step("result: route handler")
+			return b.String()
+		}
+		step("matched route: none")
+
+		if target, ok := r.redirectTarget(root, method, path, tsr); ok {
+			if tsr && r.RedirectTrailingSlash {
+				step("trailing slash redirect: %d to %s", r.redirectStatus(method), target)
+			} else {
+				step("fixed path redirect: %d to %s", r.redirectStatus(method), target)
+			}
+			return b.String()
+		}
+		if tsr && !r.RedirectTrailingSlash {
+			step("trailing slash recommendation: yes (RedirectTrailingSlash disabled)")
+		}
+	}
+
+	if r.UnknownMethodStatus != 0 && root == nil && !(method == http.MethodOptions && r.HandleOPTIONS) {
+		step("unknown method: %d %s", r.UnknownMethodStatus, http.StatusText(r.UnknownMethodStatus))
+		return b.String()
+	}
+
+	if method == http.MethodOptions && r.HandleOPTIONS {
+		if allow := r.allowedIn(t, path, http.MethodOptions); allow != "" {
+			step("allowed methods: %s", allow)
+			step("result: automatic OPTIONS reply")
+			return b.String()
+		}
+		step("allowed methods: none")
+	} else if r.HandleMethodNotAllowed {
+		if allow := r.allowedIn(t, path, method); allow != "" {
+			step("allowed methods: %s", allow)
+			step("result: 405 Method Not Allowed")
+			return b.String()
+		}
+		step("allowed methods: none")
+	}
+
+	defaultHandle := r.defaultFor(method)
+	if r.ServeUnmatchedAsStatic && r.FileSystemForUnmatched != nil &&
+		(defaultHandle == nil || staticFileExists(r.FileSystemForUnmatched, path)) {
+		if r.UnmatchedStaticFilter == nil {
+			step("result: static file server (FileSystemForUnmatched)")
+			return b.String()
+		}
+		step("static file server (FileSystemForUnmatched) if UnmatchedStaticFilter accepts the request")
+	}
+	if defaultHandle != nil {
+		step("result: default route")
+		return b.String()
+	}
+	if r.NotFound != nil {
+		step("result: NotFound handler")
+	} else {
+		step("result: 404 Not Found")
+	}
+	return b.String()
+}
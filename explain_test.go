@@ -0,0 +1,67 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterExplain(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/users/:id", h)
+	router.GET("/dir/", h)
+	router.POST("/items", h)
+
+	tests := []struct {
+		method, path string
+		contains     []string
+	}{
+		{http.MethodGet, "/users/42", []string{"tree: GET", "matched route: GET /users/:id", "params: id=42", "result: route handler"}},
+		{http.MethodGet, "/dir", []string{"matched route: none", "trailing slash redirect: 301 to /dir/"}},
+		{http.MethodGet, "/USERS/42", []string{"fixed path redirect: 301 to /users/42"}},
+		{http.MethodGet, "/items", []string{"allowed methods: OPTIONS, POST", "result: 405 Method Not Allowed"}},
+		{http.MethodOptions, "/items", []string{"tree: no routes registered for method OPTIONS", "result: automatic OPTIONS reply"}},
+		{http.MethodDelete, "/nothing", []string{"tree: no routes registered for method DELETE", "allowed methods: none", "result: 404 Not Found"}},
+	}
+	for _, tt := range tests {
+		got := router.Explain(tt.method, tt.path)
+		for _, want := range tt.contains {
+			if !strings.Contains(got, want) {
+				t.Errorf("Explain(%s, %s) does not contain %q:\n%s", tt.method, tt.path, want, got)
+			}
+		}
+	}
+
+	router.RedirectTrailingSlash = false
+	router.NotFound = http.NotFoundHandler()
+	got := router.Explain(http.MethodGet, "/dir")
+	for _, want := range []string{"trailing slash recommendation: yes", "result: NotFound handler"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Explain(GET, /dir) does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRouterExplainMergeTrailingSlash(t *testing.T) {
+	router := New()
+	router.MergeTrailingSlash = true
+	router.GET("/foo", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	got := router.Explain(http.MethodGet, "/foo/")
+	for _, want := range []string{"trailing slash merged: /foo", "matched route: GET /foo", "result: route handler"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Explain(GET, /foo/) does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "redirect") {
+		t.Errorf("Explain(GET, /foo/) reports a redirect although ServeHTTP serves the route:\n%s", got)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /foo/: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,39 @@
+package httprouter
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+// faviconCacheControl 是 Favicon 提供图标时使用的缓存策略。
+// 图标的 URL 固定，无法通过改名使缓存失效，因此只缓存一周。
+const faviconCacheControl = "public, max-age=604800"
+
+// faviconMissingCacheControl 是图标文件不存在、回复 204 时使用的缓存策略。
+// 只短暂缓存，之后放置的图标文件可以很快生效。
+const faviconMissingCacheControl = "public, max-age=300"
+
+// Favicon 注册 GET /favicon.ico，提供磁盘上的图标文件 file，并设置较长的缓存时间与正确的 Content-Type。
+// 文件的提供方式与 StaticFile 相同：每次请求时读取，更新文件不需要重启；
+// 条件请求（If-Modified-Since）与 Range 请求由 http.ServeContent 处理，读取失败时回复 500（经由错误处理器）。
+// 文件不存在时按 Router.FaviconMissingStatus 回复 204（只短暂缓存）或 404（经由错误处理器）。
+func (r *Router) Favicon(file string) *Route {
+	header := http.Header{"Cache-Control": {faviconCacheControl}}
+	if filepath.Ext(file) == ".ico" {
+		header.Set("Content-Type", "image/x-icon")
+	} else if contentType := mime.TypeByExtension(filepath.Ext(file)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return r.GET("/favicon.ico", r.staticFileHandle(file, staticFileOptions{
+		header: header,
+		missing: func(w http.ResponseWriter, req *http.Request) {
+			if r.FaviconMissingStatus == http.StatusNotFound {
+				r.serveError(w, req, http.StatusNotFound, ReasonStaticMiss)
+				return
+			}
+			w.Header().Set("Cache-Control", faviconMissingCacheControl)
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}))
+}
@@ -0,0 +1,59 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRouterFavicon(t *testing.T) {
+	dir := t.TempDir()
+	icon := filepath.Join(dir, "favicon.ico")
+	if err := os.WriteFile(icon, []byte("\x00\x00\x01\x00icon"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(router *Router) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/favicon.ico", nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	router := New()
+	router.Favicon(icon)
+	w := serve(router)
+	if w.Code != http.StatusOK || w.Body.String() != "\x00\x00\x01\x00icon" {
+		t.Fatalf("favicon not served: %d %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/x-icon" {
+		t.Errorf("wrong Content-Type %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != faviconCacheControl {
+		t.Errorf("wrong Cache-Control %q", cc)
+	}
+
+	// a missing file is answered with 204 by default
+	router = New()
+	router.Favicon(filepath.Join(dir, "missing.ico"))
+	w = serve(router)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("want 204 for missing favicon, got %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != faviconMissingCacheControl {
+		t.Errorf("wrong Cache-Control for missing favicon %q", cc)
+	}
+
+	// or with 404 through the error handler
+	var errorCode int
+	router.FaviconMissingStatus = http.StatusNotFound
+	router.SetErrorHandler(func(w http.ResponseWriter, _ *http.Request, code int) {
+		errorCode = code
+		w.WriteHeader(code)
+	})
+	if w := serve(router); w.Code != http.StatusNotFound || errorCode != http.StatusNotFound {
+		t.Errorf("want 404 via error handler, got %d (error handler %d)", w.Code, errorCode)
+	}
+}
@@ -0,0 +1,260 @@
+package httprouter
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// fsMount 是 ServeFileSystems 中一个子前缀对应的文件服务器。
+type fsMount struct {
+	prefix string
+	fs     http.FileSystem
+	server http.Handler
+}
+
+// newFSMounts 按前缀长度从长到短排列各个文件系统，以便最长前缀优先匹配。
+func newFSMounts(path string, mounts map[string]http.FileSystem) []fsMount {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+	if len(mounts) == 0 {
+		panic("no file systems given for path '" + path + "'")
+	}
+	ms := make([]fsMount, 0, len(mounts))
+	for prefix, fs := range mounts {
+		ms = append(ms, fsMount{prefix: strings.Trim(prefix, "/"), fs: fs, server: http.FileServer(fs)})
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return len(ms[i].prefix) > len(ms[j].prefix)
+	})
+	for i := 1; i < len(ms); i++ {
+		if ms[i].prefix == ms[i-1].prefix {
+			panic("duplicate file system prefix '" + ms[i].prefix + "' for path '" + path + "'")
+		}
+	}
+	return ms
+}
+
+// filesHandle 返回 ServeFiles 使用的处理函数：以 filepath 参数作为路径，从 root 提供文件。
+func (r *Router) filesHandle(root http.FileSystem) Handle {
+	fileServer := http.FileServer(root)
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		if len(ps) > 0 { // 将 Params 放入上下文，以保持一致性
+			req = req.WithContext(r.withParams(req.Context(), ps))
+		}
+		fsReq := staticRequest(req, ps.ByName("filepath"))
+		r.serveStatic(w, req, fsReq, r.staticServer(fsReq, root, fileServer))
+	}
+}
+
+// fileSystemsHandle 返回按 filepath 参数的子前缀分派到各个文件系统的处理函数。
+func (r *Router) fileSystemsHandle(ms []fsMount) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		rel := strings.TrimPrefix(ps.ByName("filepath"), "/")
+		for _, m := range ms {
+			rest, ok := strings.CutPrefix(rel, m.prefix)
+			if !ok || (m.prefix != "" && rest != "" && rest[0] != '/') {
+				continue
+			}
+			if len(ps) > 0 {
+				req = req.WithContext(r.withParams(req.Context(), ps))
+			}
+			r2 := staticRequest(req, rest)
+			r.serveStatic(w, req, r2, r.staticServer(r2, m.fs, m.server))
+			return
+		}
+		r.serveStaticError(w, req, http.StatusNotFound)
+	}
+}
+
+// contextFileSystem 包装 http.FileSystem，使打开的文件在每次读取之前检查 ctx，
+// 请求取消后读取返回 ctx.Err()，从而中止 http.FileServer 的传输。见 Router.StaticContextAware。
+type contextFileSystem struct {
+	fs  http.FileSystem
+	ctx context.Context
+}
+
+func (cfs contextFileSystem) Open(name string) (http.File, error) {
+	if err := cfs.ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := cfs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return contextFile{File: f, ctx: cfs.ctx}, nil
+}
+
+type contextFile struct {
+	http.File
+	ctx context.Context
+}
+
+func (f contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+// staticServer 返回用于处理该请求的文件服务器：启用 StaticContextAware 时，
+// 返回一个基于请求上下文包装 root 的文件服务器，否则返回预先创建的 fileServer。
+func (r *Router) staticServer(req *http.Request, root http.FileSystem, fileServer http.Handler) http.Handler {
+	if !r.StaticContextAware {
+		return fileServer
+	}
+	return http.FileServer(contextFileSystem{fs: root, ctx: req.Context()})
+}
+
+// staticRequest 返回 req 的浅拷贝，其 URL 路径改写为文件服务器使用的 path，原请求保持不变。
+func staticRequest(req *http.Request, path string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.URL = new(url.URL)
+	*r2.URL = *req.URL
+	r2.URL.Path = "/" + strings.TrimPrefix(path, "/")
+	r2.URL.RawPath = ""
+	return r2
+}
+
+// serveStatic 使用 fileServer 处理 fsReq（staticRequest 改写路径后的请求）。
+// 配置了自定义的错误处理（SetErrorHandler、SetErrorHandlerFor、SetErrorHandlerExt、Group.SetErrorHandler 或 NotFound）时，
+// 文件服务器回复的错误状态码被 errorCapturingResponseWriter 捕获，改由 serveStaticError 处理，
+// 错误处理函数收到的是原始请求 req；否则直接使用文件服务器自己的错误回复。
+func (r *Router) serveStatic(w http.ResponseWriter, req, fsReq *http.Request, fileServer http.Handler) {
+	if r.isDefaultErrorHandlerUsed && len(r.errorHandlers) == 0 && r.errorHandlerExt == nil &&
+		r.NotFound == nil && len(r.groupErrorHandlers) == 0 {
+		fileServer.ServeHTTP(w, fsReq)
+		return
+	}
+	ecw := newErrorCapturingResponseWriter(w, req, r.serveStaticError)
+	fileServer.ServeHTTP(ecw, fsReq)
+	ecw.processAfterFileServer()
+}
+
+// serveStaticError 回复静态文件服务产生的错误：404 在设置了 NotFound 时交给 NotFound，
+// 其他状态码交给错误处理器。
+func (r *Router) serveStaticError(w http.ResponseWriter, req *http.Request, statusCode int) {
+	if statusCode == http.StatusNotFound {
+		r.serveNotFound(w, req, ReasonStaticMiss)
+		return
+	}
+	r.serveError(w, req, statusCode, ReasonStaticError)
+}
+
+// ServeFileSystems 与 ServeFiles 类似，但在同一个 catch-all 路由下按子前缀使用不同的文件系统：
+//
+//	router.ServeFileSystems("/static/*filepath", map[string]http.FileSystem{
+//		"images": http.Dir("/srv/images"), // /static/images/a.png -> /srv/images/a.png
+//		"js":     http.Dir("/srv/js"),     // /static/js/app.js   -> /srv/js/app.js
+//		"":       http.Dir("/srv/public"), // 其他路径
+//	})
+//
+// 子前缀按路径段匹配（"images" 匹配 "images/a.png"，不匹配 "imagesX/a.png"），
+// 多个子前缀都匹配时最长的优先；匹配的子前缀会从路径中去除后再交给对应的文件系统。
+// 空前缀（或 "/"）匹配所有路径，可作为回退。没有任何子前缀匹配时回复 404，
+// 与 ServeFiles 相同，错误回复交给 NotFound 或错误处理器。
+// 子前缀重复（忽略首尾斜杠）时会 panic。
+func (r *Router) ServeFileSystems(path string, mounts map[string]http.FileSystem) {
+	r.GET(path, r.fileSystemsHandle(newFSMounts(path, mounts)))
+}
+
+// ServeFileSystems 是 Group 的 router.ServeFileSystems 的快捷方式，组中间件会被应用在它之外。
+func (g *Group) ServeFileSystems(relativePath string, mounts map[string]http.FileSystem) {
+	ms := newFSMounts(relativePath, mounts)
+	g.handle(http.MethodGet, joinGroupPath(g.prefix, relativePath), g.router.fileSystemsHandle(ms))
+}
+
+// staticFileOptions 调整 staticFileHandle 的行为，零值即 StaticFile 的行为。
+type staticFileOptions struct {
+	// header 是成功提供文件时附加的响应头部，例如 Cache-Control 或 Content-Type
+	header http.Header
+
+	// missing 回复文件不存在（或是目录）的请求，nil 表示回复 404（经由错误处理器）
+	missing func(w http.ResponseWriter, req *http.Request)
+}
+
+// staticFileHandle 返回提供单个文件 file 的处理函数。
+// 文件在每次请求时打开，不存在或是目录时按 opts.missing 回复（默认 404）、读取失败时回复 500（经由错误处理器）。
+// 启用 StaticContextAware 时，请求取消后中止传输。
+func (r *Router) staticFileHandle(file string, opts staticFileOptions) Handle {
+	missing := opts.missing
+	if missing == nil {
+		missing = func(w http.ResponseWriter, req *http.Request) {
+			r.serveError(w, req, http.StatusNotFound, ReasonStaticMiss)
+		}
+	}
+	return func(w http.ResponseWriter, req *http.Request, _ Params) {
+		f, err := os.Open(file)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				missing(w, req)
+			} else {
+				r.serveError(w, req, http.StatusInternalServerError, ReasonStaticError)
+			}
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			r.serveError(w, req, http.StatusInternalServerError, ReasonStaticError)
+			return
+		}
+		if info.IsDir() {
+			missing(w, req)
+			return
+		}
+		for key, values := range opts.header {
+			w.Header()[key] = append([]string(nil), values...)
+		}
+		var content http.File = f
+		if r.StaticContextAware {
+			content = contextFile{File: f, ctx: req.Context()}
+		}
+		http.ServeContent(w, req, info.Name(), info.ModTime(), content)
+	}
+}
+
+// checkStaticFilePath 检查 StaticFile 的路径中没有参数。
+func checkStaticFilePath(path string) {
+	if strings.ContainsAny(path, ":*") {
+		panic("path for StaticFile must not contain ':' or '*' in path '" + path + "'")
+	}
+}
+
+// StaticFile 在 path 上注册 GET 与 HEAD 路由，提供磁盘上的单个文件 file，例如：
+//
+//	router.StaticFile("/robots.txt", "./assets/robots.txt")
+//
+// 文件通过 http.ServeContent 提供：根据扩展名（或内容）设置 Content-Type，支持 Range 与条件请求。
+// 不提供目录列表：file 是目录或不存在时回复 404（经由错误处理器）。
+// path 不能包含参数，含有 ':' 或 '*' 时 panic。
+func (r *Router) StaticFile(path, file string) {
+	checkStaticFilePath(path)
+	handle := r.staticFileHandle(file, staticFileOptions{})
+	r.mutate(func() {
+		r.checkRoute(http.MethodGet, path, handle)
+		r.checkRoute(http.MethodHead, path, handle)
+		r.addRoute(http.MethodGet, path, handle, nil, false)
+		r.addRoute(http.MethodHead, path, handle, nil, false)
+	})
+}
+
+// StaticFile 是 Group 的 router.StaticFile 的快捷方式，组中间件会被应用在它之外。
+func (g *Group) StaticFile(relativePath, file string) {
+	checkStaticFilePath(relativePath)
+	fullPath := joinGroupPath(g.prefix, relativePath)
+	handle := g.router.staticFileHandle(file, staticFileOptions{})
+	g.router.mutate(func() {
+		g.router.checkRoute(http.MethodGet, fullPath, handle)
+		g.router.checkRoute(http.MethodHead, fullPath, handle)
+		g.addRoute(http.MethodGet, fullPath, handle, g.chain())
+		g.addRoute(http.MethodHead, fullPath, handle, g.chain())
+	})
+}
@@ -0,0 +1,250 @@
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRouterServeFileSystems(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+	router := New()
+	router.ServeFileSystems("/static/*filepath", map[string]http.FileSystem{
+		"images":     http.FS(fstest.MapFS{"a.png": file("image")}),
+		"images/raw": http.FS(fstest.MapFS{"a.png": file("raw image")}),
+		"/js/":       http.FS(fstest.MapFS{"app.js": file("script")}),
+	})
+	g := router.Group("/assets")
+	g.ServeFileSystems("/*filepath", map[string]http.FileSystem{
+		"css": http.FS(fstest.MapFS{"site.css": file("style")}),
+		"":    http.FS(fstest.MapFS{"robots.txt": file("robots")}),
+	})
+
+	for _, tc := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/images/a.png", http.StatusOK, "image"},
+		{"/static/images/raw/a.png", http.StatusOK, "raw image"},
+		{"/static/js/app.js", http.StatusOK, "script"},
+		{"/static/jsx/app.js", http.StatusNotFound, ""},
+		{"/static/css/site.css", http.StatusNotFound, ""},
+		{"/static/images/b.png", http.StatusNotFound, ""},
+		{"/assets/css/site.css", http.StatusOK, "style"},
+		{"/assets/robots.txt", http.StatusOK, "robots"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s: want %d %q, got %d %q", tc.path, tc.code, tc.body, w.Code, w.Body.String())
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.ServeFileSystems("/dup/*filepath", map[string]http.FileSystem{
+			"js":  http.Dir("."),
+			"/js": http.Dir("."),
+		})
+	})
+	if recv == nil {
+		t.Error("duplicate prefix did not panic")
+	}
+}
+
+// cancelingWriter cancels the request context after the first write.
+type cancelingWriter struct {
+	*httptest.ResponseRecorder
+	cancel func()
+}
+
+func (w cancelingWriter) Write(p []byte) (int, error) {
+	defer w.cancel()
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestRouterServeFilesErrorHandler(t *testing.T) {
+	fsys := http.FS(fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("a")}})
+	router := New()
+	router.ServeFiles("/static/*filepath", fsys)
+	router.Group("/g").ServeFiles("/files/*filepath", fsys)
+
+	var gotStatus int
+	var gotPath string
+	router.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, statusCode int) {
+		gotStatus, gotPath = statusCode, r.URL.Path
+		w.WriteHeader(statusCode)
+		w.Write([]byte("custom error"))
+	})
+	serve := func(path string) *httptest.ResponseRecorder {
+		gotStatus, gotPath = 0, ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, path := range []string{"/static/missing.txt", "/g/files/missing.txt"} {
+		w := serve(path)
+		if gotStatus != http.StatusNotFound || gotPath != path {
+			t.Errorf("%s: error handler got %d %q", path, gotStatus, gotPath)
+		}
+		if w.Code != http.StatusNotFound || w.Body.String() != "custom error" {
+			t.Errorf("%s: want custom 404, got %d %q", path, w.Code, w.Body.String())
+		}
+	}
+	if w := serve("/static/a.txt"); w.Code != http.StatusOK || w.Body.String() != "a" || gotStatus != 0 {
+		t.Errorf("existing file: %d %q (error handler %d)", w.Code, w.Body.String(), gotStatus)
+	}
+
+	// NotFound takes precedence for 404, as for unmatched routes
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found " + r.URL.Path))
+	})
+	if w := serve("/static/missing.txt"); w.Body.String() != "not found /static/missing.txt" || gotStatus != 0 {
+		t.Errorf("NotFound not used: %d %q (error handler %d)", w.Code, w.Body.String(), gotStatus)
+	}
+}
+
+func TestRouterStaticContextAware(t *testing.T) {
+	const size = 1 << 20
+	fsys := http.FS(fstest.MapFS{"big.bin": &fstest.MapFile{Data: make([]byte, size)}})
+	file := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(file, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, aware := range []bool{false, true} {
+		router := New()
+		router.StaticContextAware = aware
+		router.ServeFiles("/files/*filepath", fsys)
+		router.ServeUnmatched(fsys)
+		router.StaticFile("/static/big.bin", file)
+
+		for _, path := range []string{"/files/big.bin", "/big.bin", "/static/big.bin"} {
+			ctx, cancel := context.WithCancel(context.Background())
+			w := cancelingWriter{httptest.NewRecorder(), cancel}
+			r, _ := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+			router.ServeHTTP(w, r)
+			cancel()
+
+			if aware && w.Body.Len() >= size {
+				t.Errorf("%s: transfer not aborted after cancellation", path)
+			}
+			if !aware && w.Body.Len() != size {
+				t.Errorf("%s: want full transfer without StaticContextAware, got %d bytes", path, w.Body.Len())
+			}
+		}
+	}
+}
+
+// openRecordingFS records the names opened in the wrapped file system.
+type openRecordingFS struct {
+	http.FileSystem
+	opened []string
+}
+
+func (fs *openRecordingFS) Open(name string) (http.File, error) {
+	fs.opened = append(fs.opened, name)
+	return fs.FileSystem.Open(name)
+}
+
+func TestRouterServeUnmatchedFilter(t *testing.T) {
+	fsys := &openRecordingFS{FileSystem: http.FS(fstest.MapFS{
+		"static/x.js": &fstest.MapFile{Data: []byte("js")},
+		"api/x":       &fstest.MapFile{Data: []byte("must not be served")},
+	})}
+	router := New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("index"))
+	})
+	router.ServeUnmatched(fsys, func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, "/static/")
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		fsys.opened = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("/api/x"); w.Code != http.StatusNotFound || w.Body.String() != "index" || len(fsys.opened) != 0 {
+		t.Errorf("/api/x: want NotFound without touching the file system, got %d %q (opened %v)", w.Code, w.Body.String(), fsys.opened)
+	}
+	if w := serve("/static/x.js"); w.Code != http.StatusOK || w.Body.String() != "js" || len(fsys.opened) == 0 {
+		t.Errorf("/static/x.js: want the file, got %d %q (opened %v)", w.Code, w.Body.String(), fsys.opened)
+	}
+	if w := serve("/static/missing.js"); w.Body.String() != "index" || len(fsys.opened) == 0 {
+		t.Errorf("/static/missing.js: want NotFound after the file system lookup, got %d %q (opened %v)", w.Code, w.Body.String(), fsys.opened)
+	}
+
+	// several filters must all accept the request
+	router.ServeUnmatched(fsys, func(*http.Request) bool { return true }, func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, ".css")
+	})
+	if w := serve("/static/x.js"); w.Code != http.StatusNotFound || len(fsys.opened) != 0 {
+		t.Errorf("rejected by second filter: got %d (opened %v)", w.Code, fsys.opened)
+	}
+
+	// without a filter every unmatched request is tried again
+	router.ServeUnmatched(fsys)
+	if w := serve("/api/x"); w.Code != http.StatusOK || len(fsys.opened) == 0 {
+		t.Errorf("no filter: want the file, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRouterStaticFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "robots.txt")
+	if err := os.WriteFile(file, []byte("User-agent: *"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	router := New()
+	router.StaticFile("/robots.txt", file)
+	router.StaticFile("/dir", dir)
+	router.Group("/g").StaticFile("/missing.txt", filepath.Join(dir, "missing.txt"))
+
+	serve := func(method, path, rng string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/robots.txt", "")
+	if w.Code != http.StatusOK || w.Body.String() != "User-agent: *" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("file not served: %d %q %q", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	if w := serve(http.MethodHead, "/robots.txt", ""); w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "13" {
+		t.Errorf("HEAD: %d %q %q", w.Code, w.Body.String(), w.Header().Get("Content-Length"))
+	}
+	if w := serve(http.MethodGet, "/robots.txt", "bytes=0-3"); w.Code != http.StatusPartialContent || w.Body.String() != "User" {
+		t.Errorf("range: %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/dir", ""); w.Code != http.StatusNotFound {
+		t.Errorf("directory listed: %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/g/missing.txt", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing file: %d", w.Code)
+	}
+
+	for _, path := range []string{"/files/:name", "/files/*path"} {
+		if recv := catchPanic(func() { router.StaticFile(path, file) }); recv == nil {
+			t.Errorf("no panic for path '%s'", path)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// ipACL 是路由的 IP 访问控制列表。
+type ipACL struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// permits 报告 addr 是否可以访问：拒绝列表优先，其次在设置了允许列表时必须位于其中。
+func (acl *ipACL) permits(addr netip.Addr) bool {
+	for _, p := range acl.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(acl.allow) == 0 {
+		return true
+	}
+	for _, p := range acl.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessList 返回路由的访问控制列表，第一次调用时创建它并安装对应的守卫。
+func (rt *Route) accessList() *ipACL {
+	if rt.acl == nil {
+		acl := &ipACL{}
+		rt.acl = acl
+		rt.addGuard(func(_ http.ResponseWriter, req *http.Request) int {
+			addr, err := netip.ParseAddr(clientIP(req))
+			if err != nil || !acl.permits(addr.Unmap()) {
+				return http.StatusForbidden
+			}
+			return 0
+		})
+	}
+	return rt.acl
+}
+
+// AllowIPs 将路由限制为只处理来自给定网段的请求，其他请求以 403 Forbidden（经由错误处理器）拒绝，
+// 适用于只对内网开放的管理端点。多次调用会合并网段。
+//
+// 客户端地址取自 req.RemoteAddr（忽略端口，IPv4 映射的 IPv6 地址按 IPv4 处理），路由器本身不读取 X-Forwarded-For；
+// 部署在反向代理之后时，应由前置的中间件把 RemoteAddr 改写为可信的客户端地址，否则检查的是代理的地址。
+// 无法解析的地址一律拒绝。与 DenyIPs 同时使用时拒绝列表优先：
+// 位于拒绝列表中的地址即使也位于允许列表中，仍然被拒绝。
+func (rt *Route) AllowIPs(prefixes ...netip.Prefix) *Route {
+	if len(prefixes) == 0 {
+		panic("at least one prefix is required")
+	}
+	acl := rt.accessList()
+	for _, p := range prefixes {
+		acl.allow = append(acl.allow, validPrefix(p))
+	}
+	return rt
+}
+
+// DenyIPs 拒绝来自给定网段的请求，以 403 Forbidden（经由错误处理器）回复，其他请求不受影响
+// （除非同时设置了 AllowIPs）。多次调用会合并网段。地址的确定方式与优先级见 AllowIPs。
+func (rt *Route) DenyIPs(prefixes ...netip.Prefix) *Route {
+	if len(prefixes) == 0 {
+		panic("at least one prefix is required")
+	}
+	acl := rt.accessList()
+	for _, p := range prefixes {
+		acl.deny = append(acl.deny, validPrefix(p))
+	}
+	return rt
+}
+
+// validPrefix 检查网段是否有效，并去除 IPv4 映射，使其与客户端地址的比较方式一致。
+func validPrefix(p netip.Prefix) netip.Prefix {
+	if !p.IsValid() {
+		panic("invalid IP prefix '" + p.String() + "'")
+	}
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96).Masked()
+	}
+	return p.Masked()
+}
@@ -0,0 +1,43 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRouteIPACL(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/admin", h).
+		AllowIPs(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")).
+		DenyIPs(netip.MustParsePrefix("10.0.0.13/32"))
+	router.GET("/public", h).DenyIPs(netip.MustParsePrefix("192.0.2.0/24"))
+
+	for _, tc := range []struct {
+		path, remote string
+		code         int
+	}{
+		{"/admin", "10.1.2.3:1234", http.StatusOK},
+		{"/admin", "[::1]:1234", http.StatusOK},
+		{"/admin", "[::ffff:10.1.2.3]:1234", http.StatusOK},
+		{"/admin", "10.0.0.13:1234", http.StatusForbidden}, // deny wins
+		{"/admin", "203.0.113.5:1234", http.StatusForbidden},
+		{"/admin", "garbage", http.StatusForbidden},
+		{"/public", "203.0.113.5:1234", http.StatusOK},
+		{"/public", "192.0.2.7:1234", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		r.RemoteAddr = tc.remote
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code {
+			t.Errorf("%s from %s: want %d, got %d", tc.path, tc.remote, tc.code, w.Code)
+		}
+	}
+
+	if recv := catchPanic(func() { router.GET("/x", h).AllowIPs(netip.Prefix{}) }); recv == nil {
+		t.Error("no panic for invalid prefix")
+	}
+}
@@ -0,0 +1,127 @@
+package httprouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// FieldError 描述请求体中一个字段未通过校验的原因。
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors 是校验失败的字段列表。
+// 校验函数（Router.Validator 或请求结构体的 Validate 方法）返回它时，
+// 字段错误会出现在 ProblemJSONErrorHandler 的 errors 字段中。
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "httprouter: validation failed: " + strings.Join(msgs, "; ")
+}
+
+type requestErrorKey struct{}
+
+// RequestErrorFromContext 返回导致路由器回复错误的请求错误，例如 POSTJSON 的解码或校验错误，
+// 供错误处理器在响应中给出详细信息；不存在时返回 nil。
+func RequestErrorFromContext(ctx context.Context) error {
+	err, _ := ctx.Value(requestErrorKey{}).(error)
+	return err
+}
+
+// JSONHandle 是 POSTJSON 注册的处理函数，v 是已解码并通过校验的请求体。
+type JSONHandle[T any] func(w http.ResponseWriter, r *http.Request, ps Params, v *T)
+
+// defaultMaxJSONBodyBytes 是 Router.MaxJSONBodyBytes 为 0 时 POSTJSON 读取的请求体的最大字节数。
+const defaultMaxJSONBodyBytes = 1 << 20
+
+// POSTJSON 在 r 上注册一个 POST 路由，自动把 JSON 请求体解码为 T 并校验：
+//
+//	httprouter.POSTJSON(router, "/users", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, req *CreateUserReq) {
+//	    ...
+//	})
+//
+// 每个请求都会把请求体解码到一个新的 T 中，然后依次执行校验：
+// 如果 *T 实现了 Validate() error，调用它；如果设置了 Router.Validator，再以 *T 调用它（例如基于结构体标签的校验器）。
+// 全部通过后才调用 handle。
+//
+// 失败时经由错误处理器回复，错误可通过 RequestErrorFromContext 获取：
+//   - Content-Type 不是 JSON（application/json 或 +json 后缀）时回复 415 Unsupported Media Type；
+//   - 请求体超过 Router.MaxJSONBodyBytes 时回复 413 Request Entity Too Large；
+//   - 请求体为空、不是有效的 JSON，或在 JSON 值之后还有其他数据时回复 400 Bad Request；
+//   - 校验失败时回复 400 Bad Request，返回 ValidationErrors 的校验器会带出字段错误。
+//
+// Go 的方法不能带有类型参数，因此 POSTJSON 是以路由器为参数的函数。
+func POSTJSON[T any](r *Router, path string, handle JSONHandle[T]) *Route {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	return r.POST(path, func(w http.ResponseWriter, req *http.Request, ps Params) {
+		v := new(T)
+		if code, err := r.decodeJSON(w, req, v); err != nil {
+			r.serveError(w, req.WithContext(context.WithValue(req.Context(), requestErrorKey{}, err)), code, ReasonInvalidBody)
+			return
+		}
+		handle(w, req, ps, v)
+	})
+}
+
+// decodeJSON 将请求体解码到 v 并执行校验，失败时返回用于回复的状态码与错误。
+func (r *Router) decodeJSON(w http.ResponseWriter, req *http.Request, v interface{}) (int, error) {
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+			return http.StatusUnsupportedMediaType, errors.New("httprouter: request body must be JSON")
+		}
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return http.StatusBadRequest, errors.New("httprouter: request body is empty")
+	}
+	body := req.Body
+	if limit := r.MaxJSONBodyBytes; limit >= 0 {
+		if limit == 0 {
+			limit = defaultMaxJSONBodyBytes
+		}
+		body = http.MaxBytesReader(w, body, limit)
+	}
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(v); err != nil {
+		return jsonBodyStatus(err), err
+	}
+	// 请求体只能包含一个 JSON 值，之后只允许空白
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("httprouter: request body must contain a single JSON value")
+		}
+		return jsonBodyStatus(err), err
+	}
+	if validator, ok := v.(interface{ Validate() error }); ok {
+		if err := validator.Validate(); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	if r.Validator != nil {
+		if err := r.Validator(v); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	return 0, nil
+}
+
+// jsonBodyStatus 返回读取或解码请求体失败时回复的状态码：超过大小限制时为 413，否则为 400。
+func jsonBodyStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,92 @@
+package httprouter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type createUserReq struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func (c *createUserReq) Validate() error {
+	var ve ValidationErrors
+	if c.Name == "" {
+		ve = append(ve, FieldError{Field: "name", Message: "is required"})
+	}
+	if !strings.Contains(c.Email, "@") {
+		ve = append(ve, FieldError{Field: "email", Message: "is not an email address"})
+	}
+	if ve != nil {
+		return ve
+	}
+	return nil
+}
+
+func TestRouterPOSTJSON(t *testing.T) {
+	router := New()
+	router.SetErrorHandler(ProblemJSONErrorHandler)
+	router.Validator = func(v interface{}) error {
+		if v.(*createUserReq).Name == "root" {
+			return errors.New("reserved name")
+		}
+		return nil
+	}
+	router.MaxJSONBodyBytes = 64
+	POSTJSON(router, "/orgs/:org/users", func(w http.ResponseWriter, _ *http.Request, ps Params, req *createUserReq) {
+		w.Write([]byte(ps.ByName("org") + ":" + req.Name + ":" + req.Email))
+	})
+
+	post := func(contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodPost, "/orgs/acme/users", strings.NewReader(body))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post("application/json", `{"name":"ann","email":"ann@example.com"}`)
+	if w.Code != http.StatusOK || w.Body.String() != "acme:ann:ann@example.com" {
+		t.Fatalf("valid request: %d %q", w.Code, w.Body.String())
+	}
+
+	w = post("application/json", `{"name":"","email":"nope"}`)
+	var p Problem
+	json.NewDecoder(w.Body).Decode(&p)
+	want := []FieldError{{"name", "is required"}, {"email", "is not an email address"}}
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(p.Errors, want) {
+		t.Errorf("want 400 with field errors %v, got %d %+v", want, w.Code, p)
+	}
+
+	for _, tc := range []struct {
+		contentType, body string
+		code              int
+	}{
+		{"", `{"name":"bob","email":"b@x"}`, http.StatusOK},
+		{"application/merge-patch+json", `{"name":"bob","email":"b@x"}`, http.StatusOK},
+		{"text/plain", `{"name":"bob","email":"b@x"}`, http.StatusUnsupportedMediaType},
+		{"application/json", ``, http.StatusBadRequest},
+		{"application/json", `{"name":`, http.StatusBadRequest},
+		{"application/json", `{"name":"root","email":"r@x"}`, http.StatusBadRequest},
+		{"application/json", `{"name":"bob","email":"b@x"}` + "\n", http.StatusOK},
+		{"application/json", `{"name":"bob","email":"b@x"}{"name":"eve"}`, http.StatusBadRequest},
+		{"application/json", `{"name":"bob","email":"b@x"} trailing`, http.StatusBadRequest},
+		{"application/json", `{"name":"` + strings.Repeat("a", 64) + `","email":"b@x"}`, http.StatusRequestEntityTooLarge},
+	} {
+		if w := post(tc.contentType, tc.body); w.Code != tc.code {
+			t.Errorf("%q %q: want %d, got %d", tc.contentType, tc.body, tc.code, w.Code)
+		}
+	}
+
+	if recv := catchPanic(func() { POSTJSON[createUserReq](router, "/x", nil) }); recv == nil {
+		t.Error("no panic for nil handle")
+	}
+}
@@ -0,0 +1,70 @@
+package httprouter
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// linkRelOrder 是 WriteLinkHeader 输出常用分页关系时的顺序，其他关系按名称排序排在其后。
+var linkRelOrder = map[string]int{"first": 1, "prev": 2, "next": 3, "last": 4}
+
+// WriteLinkHeader 按 RFC 8288（原 RFC 5988）为响应添加 Link 头部，rels 是关系名到 URL 的映射，例如：
+//
+//	Link: </items?page=1>; rel="first", </items?page=3>; rel="next"
+//
+// 所有关系写入同一个头部值，first、prev、next、last 依次排在前面，其他关系按名称排序。
+// 头部通过 Add 添加，不会覆盖已有的 Link 头部。rels 为空时不做任何事。
+func WriteLinkHeader(w http.ResponseWriter, rels map[string]string) {
+	if len(rels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(rels))
+	for rel := range rels {
+		names = append(names, rel)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		oi, oj := linkRelOrder[names[i]], linkRelOrder[names[j]]
+		if oi != oj {
+			if oi == 0 || oj == 0 {
+				return oj == 0
+			}
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+
+	links := make([]string, len(names))
+	for i, rel := range names {
+		links[i] = "<" + rels[rel] + `>; rel="` + rel + `"`
+	}
+	w.Header().Add("Link", strings.Join(links, ", "))
+}
+
+// PaginationLinks 根据当前请求与分页信息生成 first、prev、next、last 关系的 URL，供 WriteLinkHeader 使用。
+// URL 基于请求的 URL 构造，保留其他查询参数，只把查询参数 param 设置为对应的页码（页码从 1 开始）。
+// 第一页不包含 first 与 prev，最后一页不包含 next 与 last；
+// lastPage 小于 1 表示总页数未知，此时总是包含 next，不包含 last。
+func PaginationLinks(r *http.Request, param string, page, lastPage int) map[string]string {
+	pageURL := func(n int) string {
+		u := *r.URL
+		q := u.Query()
+		q.Set(param, strconv.Itoa(n))
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	rels := make(map[string]string, 4)
+	if page > 1 {
+		rels["first"] = pageURL(1)
+		rels["prev"] = pageURL(page - 1)
+	}
+	if lastPage < 1 || page < lastPage {
+		rels["next"] = pageURL(page + 1)
+	}
+	if lastPage >= 1 && page < lastPage {
+		rels["last"] = pageURL(lastPage)
+	}
+	return rels
+}
@@ -0,0 +1,65 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWriteLinkHeader(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteLinkHeader(w, map[string]string{
+		"last":    "/items?page=9",
+		"next":    "/items?page=3",
+		"alt":     "/items.json",
+		"prev":    "/items?page=1",
+		"first":   "/items?page=1",
+		"preview": "/items/preview",
+	})
+	want := `</items?page=1>; rel="first", </items?page=1>; rel="prev", </items?page=3>; rel="next", ` +
+		`</items?page=9>; rel="last", </items.json>; rel="alt", </items/preview>; rel="preview"`
+	if got := w.Header().Get("Link"); got != want {
+		t.Errorf("wrong Link header:\nwant %s\n got %s", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	w.Header().Set("Link", `</style.css>; rel="preload"`)
+	WriteLinkHeader(w, map[string]string{"next": "/n"})
+	WriteLinkHeader(w, nil)
+	if got := w.Header().Values("Link"); len(got) != 2 {
+		t.Errorf("existing Link header not preserved: %v", got)
+	}
+}
+
+func TestPaginationLinks(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "/items?sort=name&page=2&tag=a&tag=b", nil)
+
+	tests := []struct {
+		page, last int
+		want       map[string]string
+	}{
+		{2, 3, map[string]string{
+			"first": "/items?page=1&sort=name&tag=a&tag=b",
+			"prev":  "/items?page=1&sort=name&tag=a&tag=b",
+			"next":  "/items?page=3&sort=name&tag=a&tag=b",
+			"last":  "/items?page=3&sort=name&tag=a&tag=b",
+		}},
+		{1, 3, map[string]string{
+			"next": "/items?page=2&sort=name&tag=a&tag=b",
+			"last": "/items?page=3&sort=name&tag=a&tag=b",
+		}},
+		{3, 3, map[string]string{
+			"first": "/items?page=1&sort=name&tag=a&tag=b",
+			"prev":  "/items?page=2&sort=name&tag=a&tag=b",
+		}},
+		{1, 0, map[string]string{
+			"next": "/items?page=2&sort=name&tag=a&tag=b",
+		}},
+	}
+	for _, tt := range tests {
+		if got := PaginationLinks(r, "page", tt.page, tt.last); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("page %d of %d:\nwant %v\n got %v", tt.page, tt.last, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package httprouter
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Fields 是请求范围内的日志字段集合，由 Logger 中间件创建并放入请求上下文。
+// 之后的中间件与处理程序可以通过 LogFields 取得它并添加字段，
+// Logger 在请求结束时把所有字段与请求信息一起写成一条日志，无需在各层之间传递 logger。
+//
+// Fields 可以被多个 goroutine 并发使用。nil *Fields（请求未经过 Logger）上的操作不产生任何效果。
+type Fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type logFieldsKey struct{}
+
+// LogFields 返回 Logger 中间件放入上下文的字段集合，不存在时返回 nil（可以安全地调用其方法）。
+func LogFields(ctx context.Context) *Fields {
+	f, _ := ctx.Value(logFieldsKey{}).(*Fields)
+	return f
+}
+
+// Set 设置一个字段。同名字段已存在时替换其值，并保持原来的位置。
+func (f *Fields) Set(key string, value interface{}) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.attrs {
+		if f.attrs[i].Key == key {
+			f.attrs[i].Value = slog.AnyValue(value)
+			return
+		}
+	}
+	f.attrs = append(f.attrs, slog.Any(key, value))
+}
+
+// Get 返回字段的值，不存在时返回 nil。
+func (f *Fields) Get(key string) interface{} {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, a := range f.attrs {
+		if a.Key == key {
+			return a.Value.Any()
+		}
+	}
+	return nil
+}
+
+// Attrs 按添加的顺序返回所有字段的副本。
+func (f *Fields) Attrs() []slog.Attr {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slog.Attr(nil), f.attrs...)
+}
+
+// Logger 返回一个为每个请求写一条结构化日志的中间件。
+// 日志在请求处理结束后写出，包含 method、path、status、bytes 与 duration，
+// 以及处理过程中通过 LogFields 添加的所有字段（按添加的顺序）。
+// 5xx 响应使用 Error 级别，其他响应使用 Info 级别。logger 为 nil 时使用 slog.Default()。
+func Logger(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			start := time.Now()
+			fields := &Fields{}
+			scw := newStatusCapturingResponseWriter(w)
+			ctx := context.WithValue(req.Context(), logFieldsKey{}, fields)
+			next.ServeHTTP(scw, req.WithContext(ctx))
+
+			status := scw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+			attrs := append([]slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", scw.size),
+				slog.Duration("duration", time.Since(start)),
+			}, fields.Attrs()...)
+			l.LogAttrs(req.Context(), level, "request", attrs...)
+		})
+	}
+}
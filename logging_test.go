@@ -0,0 +1,62 @@
+package httprouter
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	router := New()
+	router.Use(Logger(logger), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			LogFields(r.Context()).Set("tenant", "acme")
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, ps Params) {
+		fields := LogFields(r.Context())
+		fields.Set("user_id", ps.ByName("id"))
+		fields.Set("tenant", "acme-eu")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/42", nil)
+	router.ServeHTTP(w, r)
+
+	want := "level=INFO msg=request method=GET path=/users/42 status=201 bytes=2 tenant=acme-eu user_id=42\n"
+	if buf.String() != want {
+		t.Errorf("wrong log line:\n got %q\nwant %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/missing", nil)
+	router.ServeHTTP(w, r)
+	if !strings.Contains(buf.String(), "status=404") {
+		t.Errorf("404 not logged: %q", buf.String())
+	}
+
+	// outside the Logger middleware the accumulator is a no-op
+	fields := LogFields(context.Background())
+	fields.Set("k", "v")
+	if fields != nil || fields.Get("k") != nil || fields.Attrs() != nil {
+		t.Error("fields available without Logger middleware")
+	}
+}
@@ -0,0 +1,522 @@
+package httprouter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// routerKey 是路由器在请求上下文中的键。
+// 只有在存在中间件链（全局或组级）时路由器才会把自身放入上下文，
+// 以便本包提供的中间件通过路由器配置的错误处理器回复错误。
+type routerKey struct{}
+
+// withRouter 返回携带路由器的请求。
+func (r *Router) withRouter(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), routerKey{}, r))
+}
+
+// routerFromContext 返回上下文中的路由器，不存在时返回 nil。
+func routerFromContext(ctx context.Context) *Router {
+	r, _ := ctx.Value(routerKey{}).(*Router)
+	return r
+}
+
+// serveMiddlewareError 供本包的中间件回复错误使用：
+// 如果请求由路由器分派，则使用路由器配置的错误处理器，否则使用默认的错误处理器。
+func serveMiddlewareError(w http.ResponseWriter, req *http.Request, statusCode int) {
+	if r := routerFromContext(req.Context()); r != nil {
+		r.serveError(w, req, statusCode, ReasonMiddleware)
+		return
+	}
+	defaultErrorHandler(w, req, statusCode)
+}
+
+// DefaultRequestIDHeader 是 RequestID 中间件默认使用的头部名称。
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength 是接受的客户端请求 ID 的最大长度，超出时重新生成。
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext 返回 RequestID 中间件放入上下文的请求 ID，不存在时返回空字符串。
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID 返回一个为每个请求分配请求 ID 的中间件。
+// 如果请求已经带有 header 头部（例如由网关生成）且长度合理，则沿用它，否则生成一个随机 ID。
+// 请求 ID 会写入同名的响应头部，并放入请求上下文（见 RequestIDFromContext）。
+// header 为空时使用 DefaultRequestIDHeader。
+func RequestID(header string) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id := req.Header.Get(header)
+			if id == "" || len(id) > maxRequestIDLength {
+				id = newRequestID()
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// newRequestID 生成一个 128 位的随机请求 ID（32 个十六进制字符）。
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// HardTimeout 返回一个中间件，为其后的整个处理链（后续中间件与处理程序）设置硬性的总时长上限。
+// 处理链在单独的 goroutine 中执行，并获得一个在 d 之后取消的上下文；
+// 超时后中间件立即以 503 Service Unavailable（经由错误处理器）回复并返回，
+// 即使处理程序卡在不响应上下文取消的调用中。
+// 超时之后处理程序的任何写入都会被丢弃（Write 返回 http.ErrHandlerTimeout），不会造成重复写出；
+// 如果超时前响应已经开始写出，则不会再写出 503，只是停止后续写入。
+// 处理链中的 panic 会在原 goroutine 中重新抛出，以便路由器的 panic 恢复机制处理。
+//
+// 注意：如果处理程序不检查上下文取消，它所在的 goroutine 会一直运行到自行结束，
+// 在此期间占用的资源不会被释放（goroutine 泄漏）。HardTimeout 只能保证客户端及时得到响应。
+func HardTimeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, h: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+						return
+					}
+					close(done)
+				}()
+				next.ServeHTTP(tw, req.WithContext(ctx))
+			}()
+
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+				// 处理程序只设置了头部而没有写出任何内容时，与 http.TimeoutHandler 一样以 200 写出这些头部
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				if !tw.wroteHeader && !tw.timedOut {
+					tw.writeHeaderLocked(http.StatusOK)
+				}
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if !tw.wroteHeader && ctx.Err() == context.DeadlineExceeded {
+					serveMiddlewareError(w, req, http.StatusServiceUnavailable)
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter 是 HardTimeout 使用的 ResponseWriter。
+// 它使用独立的头部映射，并在互斥锁保护下写出，超时后丢弃所有写入。
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(statusCode)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(statusCode int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+		tw.wroteHeader = true
+	}
+	tw.w.WriteHeader(statusCode)
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(data)
+}
+
+// Flush 在未超时时写出尚未写出的头部（状态码 200），并在原始 ResponseWriter 支持 http.Flusher 时刷新数据。
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+// 超时之后返回 nil：被放弃的处理程序不能再经由 ResponseController 接管或操作已经结束的请求的连接。
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil
+	}
+	return tw.w
+}
+
+// ErrResponseTooLarge 表示处理程序写出的响应体超过了 MaxResponseBytes 设置的上限。
+var ErrResponseTooLarge = errors.New("httprouter: response body exceeds size limit")
+
+// ResponseLimitAction 指定响应体超过 MaxResponseBytes 上限时的处理方式。
+type ResponseLimitAction int
+
+const (
+	// ResponseLimitTruncate 截断响应：写出上限以内的部分，之后的写入被丢弃并返回 ErrResponseTooLarge。
+	ResponseLimitTruncate ResponseLimitAction = iota
+
+	// ResponseLimitPanic 在超限的写入时以 ErrResponseTooLarge panic（超限的那次写入不会写出任何数据），
+	// 交由路由器的 panic 恢复机制（RecoveryHandler 或 500 错误回复）处理。
+	// 如果此前响应已经开始写出，客户端只会收到被截断的响应。
+	ResponseLimitPanic
+)
+
+// MaxResponseBytes 返回一个限制响应体大小的中间件，用于防止某些端点产生过大的响应（例如保护下游缓存）。
+// 已经发送的字节无法撤回，因此超过上限 n 时中间件只能停止写出，并按 action 截断或 panic。
+// onExceed 是一个可选的回调，在首次超限时调用一次，接收请求与上限，可用于记录日志或指标。
+func MaxResponseBytes(n int64, action ResponseLimitAction, onExceed func(req *http.Request, limit int64)) Middleware {
+	if n < 0 {
+		panic("response size limit must not be negative")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(&limitedResponseWriter{
+				w:        w,
+				req:      req,
+				limit:    n,
+				action:   action,
+				onExceed: onExceed,
+			}, req)
+		})
+	}
+}
+
+// limitedResponseWriter 是 MaxResponseBytes 使用的 ResponseWriter，统计并限制写出的响应体字节数。
+type limitedResponseWriter struct {
+	w        http.ResponseWriter
+	req      *http.Request
+	limit    int64
+	written  int64
+	exceeded bool
+	action   ResponseLimitAction
+	onExceed func(*http.Request, int64)
+}
+
+func (lw *limitedResponseWriter) Header() http.Header {
+	return lw.w.Header()
+}
+
+func (lw *limitedResponseWriter) WriteHeader(statusCode int) {
+	lw.w.WriteHeader(statusCode)
+}
+
+func (lw *limitedResponseWriter) Write(data []byte) (int, error) {
+	if lw.exceeded {
+		return 0, ErrResponseTooLarge
+	}
+	if remaining := lw.limit - lw.written; int64(len(data)) > remaining {
+		lw.exceeded = true
+		if lw.onExceed != nil {
+			lw.onExceed(lw.req, lw.limit)
+		}
+		if lw.action == ResponseLimitPanic {
+			panic(ErrResponseTooLarge)
+		}
+		n, err := lw.w.Write(data[:remaining])
+		lw.written += int64(n)
+		if err == nil {
+			err = ErrResponseTooLarge
+		}
+		return n, err
+	}
+	n, err := lw.w.Write(data)
+	lw.written += int64(n)
+	return n, err
+}
+
+// Flush 在原始 ResponseWriter 支持 http.Flusher 时刷新数据。
+func (lw *limitedResponseWriter) Flush() {
+	if flusher, ok := lw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+func (lw *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.w
+}
+
+// ErrRequestTooLarge 是 MaxBodyBytes 已经回复 413 之后，处理程序写入响应时返回的错误。
+var ErrRequestTooLarge = errors.New("httprouter: request body exceeds size limit")
+
+// MaxBodyBytes 返回一个限制请求体大小的中间件，用于防止过大的上传。
+// Content-Length 已经超过上限 n 的请求直接以 413 Request Entity Too Large（经由错误处理器）回复，不会调用处理程序；
+// 否则请求体被包装为 http.MaxBytesReader，处理程序读取超过 n 字节时读取返回 *http.MaxBytesError，
+// 中间件同时以 413 回复（经由错误处理器），处理程序之后的写入被丢弃并返回 ErrRequestTooLarge，
+// 处理程序无需自己把读取错误翻译为状态码。如果超限之前响应已经开始写出，则不会再写出 413。
+func MaxBodyBytes(n int64) Middleware {
+	if n < 0 {
+		panic("request body size limit must not be negative")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > n {
+				serveMiddlewareError(w, req, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if req.Body == nil || req.Body == http.NoBody {
+				next.ServeHTTP(w, req)
+				return
+			}
+			bw := &bodyLimitWriter{w: w, req: req}
+			r2 := new(http.Request)
+			*r2 = *req
+			r2.Body = &bodyLimitReader{ReadCloser: http.MaxBytesReader(w, req.Body, n), bw: bw}
+			next.ServeHTTP(bw, r2)
+		})
+	}
+}
+
+// bodyLimitReader 是 MaxBodyBytes 使用的请求体，读取超限时通知 bodyLimitWriter 回复 413。
+type bodyLimitReader struct {
+	io.ReadCloser
+	bw *bodyLimitWriter
+}
+
+func (br *bodyLimitReader) Read(p []byte) (int, error) {
+	n, err := br.ReadCloser.Read(p)
+	var mbe *http.MaxBytesError
+	if err != nil && errors.As(err, &mbe) {
+		br.bw.exceed()
+	}
+	return n, err
+}
+
+// bodyLimitWriter 是 MaxBodyBytes 使用的 ResponseWriter，请求体超限后回复 413 并丢弃处理程序的写入。
+type bodyLimitWriter struct {
+	w        http.ResponseWriter
+	req      *http.Request
+	started  bool
+	exceeded bool
+}
+
+// exceed 在请求体首次超限时回复 413（响应尚未开始写出时）。
+func (bw *bodyLimitWriter) exceed() {
+	if bw.exceeded {
+		return
+	}
+	bw.exceeded = true
+	if !bw.started {
+		bw.started = true
+		serveMiddlewareError(bw.w, bw.req, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func (bw *bodyLimitWriter) Header() http.Header {
+	return bw.w.Header()
+}
+
+func (bw *bodyLimitWriter) WriteHeader(statusCode int) {
+	if bw.exceeded {
+		return
+	}
+	if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+		bw.started = true
+	}
+	bw.w.WriteHeader(statusCode)
+}
+
+func (bw *bodyLimitWriter) Write(data []byte) (int, error) {
+	if bw.exceeded {
+		return 0, ErrRequestTooLarge
+	}
+	bw.started = true
+	return bw.w.Write(data)
+}
+
+// Flush 在请求体未超限且原始 ResponseWriter 支持 http.Flusher 时刷新数据。
+func (bw *bodyLimitWriter) Flush() {
+	if flusher, ok := bw.w.(http.Flusher); ok && !bw.exceeded {
+		bw.started = true
+		flusher.Flush()
+	}
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+func (bw *bodyLimitWriter) Unwrap() http.ResponseWriter {
+	return bw.w
+}
+
+// HopByHopHeaders 是 NormalizeHeaders 在未指定头部列表时从请求中移除的逐跳头部（RFC 9110 7.6.1），
+// 这些头部只对单个连接有意义，不应交给处理程序或被转发。
+var HopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// NormalizeHeaders 返回一个在请求到达处理程序之前清理请求头部的中间件：
+//   - 移除 strip 中列出的头部（为空时使用 HopByHopHeaders），以及 Connection 头部中列出的头部；
+//   - 将 Accept-Encoding 规范化为单个头部值：编码名转换为小写，去除多余空白、空项与重复项，
+//     例如 "GZIP , br,,gzip;q=0.5" 变为 "gzip, br"。
+//
+// 头部在请求的副本上修改，不影响调用方持有的请求。
+// 注意：移除 Upgrade 与 Connection 会使 WebSocket 等协议升级无法进行，
+// 需要支持升级的路由应传入不包含它们的列表。
+func NormalizeHeaders(strip ...string) Middleware {
+	if len(strip) == 0 {
+		strip = HopByHopHeaders
+	}
+	canonical := make([]string, len(strip))
+	for i, h := range strip {
+		canonical[i] = http.CanonicalHeaderKey(h)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			h := req.Header.Clone()
+			if h == nil {
+				h = make(http.Header)
+			}
+			for _, v := range h["Connection"] {
+				for _, name := range strings.Split(v, ",") {
+					if name = strings.TrimSpace(name); name != "" {
+						h.Del(name)
+					}
+				}
+			}
+			for _, name := range canonical {
+				delete(h, name)
+			}
+			if ae, ok := h["Accept-Encoding"]; ok {
+				if v := normalizeAcceptEncoding(ae); v != "" {
+					h["Accept-Encoding"] = []string{v}
+				} else {
+					delete(h, "Accept-Encoding")
+				}
+			}
+
+			r2 := new(http.Request)
+			*r2 = *req
+			r2.Header = h
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// normalizeAcceptEncoding 合并 Accept-Encoding 头部的各个值，
+// 编码名转换为小写并去除空白，同一编码只保留第一次出现。
+func normalizeAcceptEncoding(values []string) string {
+	var codings []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(item, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			if params = strings.ReplaceAll(strings.TrimSpace(params), " ", ""); params != "" {
+				name += ";" + strings.ToLower(params)
+			}
+			codings = append(codings, name)
+		}
+	}
+	return strings.Join(codings, ", ")
+}
+
+// PerClientConcurrency 返回一个限制单个客户端同时处理中的请求数量的中间件，
+// 防止单个客户端占满服务器。客户端由 key 确定，key 为 nil 时使用 RemoteAddr 中的 IP（忽略端口），
+// 这时经过同一个反向代理的请求会共享一个计数，可以通过 key 改用代理头部中的客户端地址。
+// 某个客户端已有 n 个请求在处理中时，新请求以 429 Too Many Requests（经由错误处理器）拒绝。
+//
+// 计数在处理链返回时减少，处理链 panic 时同样如此，因此可以与路由器的 panic 恢复机制一起使用。
+// 计数归零的客户端会立即从表中移除，表的大小只与当前处理中的客户端数量有关。
+func PerClientConcurrency(n int, key func(*http.Request) string) Middleware {
+	if n <= 0 {
+		panic("concurrency limit must be positive")
+	}
+	if key == nil {
+		key = clientIP
+	}
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[string]int)
+	)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			k := key(req)
+			mu.Lock()
+			if inFlight[k] >= n {
+				mu.Unlock()
+				serveMiddlewareError(w, req, http.StatusTooManyRequests)
+				return
+			}
+			inFlight[k]++
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				if inFlight[k]--; inFlight[k] == 0 {
+					delete(inFlight, k)
+				}
+				mu.Unlock()
+			}()
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package httprouter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHardTimeout(t *testing.T) {
+	router := New()
+	router.Use(HardTimeout(20 * time.Millisecond))
+
+	var errorCode int
+	router.SetErrorHandler(func(w http.ResponseWriter, _ *http.Request, code int) {
+		errorCode = code
+		w.WriteHeader(code)
+	})
+
+	release := make(chan struct{})
+	finished := make(chan error, 1)
+	router.GET("/stuck", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		<-release // ignores context cancellation on purpose
+		w.Header().Set("X-Late", "1")
+		_, err := w.Write([]byte("late"))
+		if _, _, herr := http.NewResponseController(w).Hijack(); herr == nil {
+			t.Error("abandoned handler could still hijack the connection")
+		}
+		finished <- err
+	})
+	router.GET("/fast", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("fast"))
+	})
+	router.GET("/headers", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Token", "t")
+	})
+	router.GET("/flush", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Token", "t")
+		http.NewResponseController(w).Flush()
+		if _, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok {
+			t.Error("timeout writer does not implement Unwrap")
+		}
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/stuck", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || errorCode != http.StatusServiceUnavailable {
+		t.Fatalf("want 503 via error handler, got code=%d errorCode=%d", w.Code, errorCode)
+	}
+
+	close(release)
+	if err := <-finished; err != http.ErrHandlerTimeout {
+		t.Errorf("late write: want ErrHandlerTimeout, got %v", err)
+	}
+	if w.Body.Len() != 0 || w.Header().Get("X-Late") != "" {
+		t.Errorf("late write leaked into the response: body=%q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/fast", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "fast" {
+		t.Errorf("fast handler: code=%d body=%q", w.Code, w.Body.String())
+	}
+
+	// headers set without writing anything are still sent, as with http.TimeoutHandler
+	for _, path := range []string{"/headers", "/flush"} {
+		w = httptest.NewRecorder()
+		r, _ = http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Header().Get("X-Token") != "t" {
+			t.Errorf("%s: want 200 with X-Token, got %d %v", path, w.Code, w.Header())
+		}
+	}
+
+	recv := catchPanic(func() {
+		r, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+		HardTimeout(time.Second)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})).ServeHTTP(httptest.NewRecorder(), r)
+	})
+	if recv != "boom" {
+		t.Errorf("panic was not propagated to the serving goroutine: %v", recv)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	router := New()
+	router.Use(RequestID(""))
+
+	var got string
+	router.GET("/", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		got = RequestIDFromContext(r.Context())
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	router.ServeHTTP(w, r)
+	if len(got) != 32 || w.Header().Get(DefaultRequestIDHeader) != got {
+		t.Errorf("generated request ID %q not propagated, header %q", got, w.Header().Get(DefaultRequestIDHeader))
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(DefaultRequestIDHeader, "abc")
+	router.ServeHTTP(w, r)
+	if got != "abc" || w.Header().Get(DefaultRequestIDHeader) != "abc" {
+		t.Errorf("incoming request ID not reused: %q", got)
+	}
+
+	if RequestIDFromContext(context.Background()) != "" {
+		t.Error("request ID present in empty context")
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	var exceeded int
+	onExceed := func(_ *http.Request, limit int64) {
+		if limit != 5 {
+			t.Errorf("wrong limit passed to hook: %d", limit)
+		}
+		exceeded++
+	}
+
+	var writeErr error
+	router := New()
+	router.Use(MaxResponseBytes(5, ResponseLimitTruncate, onExceed))
+	router.GET("/small", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		_, writeErr = w.Write([]byte("12345"))
+	})
+	router.GET("/large", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("123"))
+		w.Write([]byte("4567"))
+		_, writeErr = w.Write([]byte("89"))
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/small", nil)
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "12345" || writeErr != nil || exceeded != 0 {
+		t.Errorf("response within limit altered: %q, %v, %d", w.Body.String(), writeErr, exceeded)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/large", nil)
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "12345" || writeErr != ErrResponseTooLarge || exceeded != 1 {
+		t.Errorf("response not truncated: %q, %v, %d", w.Body.String(), writeErr, exceeded)
+	}
+
+	// panic mode hands over to the recovery handler
+	var recovered interface{}
+	router = New()
+	router.RecoveryHandler = func(w http.ResponseWriter, _ *http.Request, rcv interface{}) {
+		recovered = rcv
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.Use(MaxResponseBytes(5, ResponseLimitPanic, nil))
+	router.GET("/large", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("123456"))
+	})
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/large", nil)
+	router.ServeHTTP(w, r)
+	if recovered != ErrResponseTooLarge || w.Code != http.StatusInternalServerError || w.Body.Len() != 0 {
+		t.Errorf("want recovered ErrResponseTooLarge with 500, got %v, %d %q", recovered, w.Code, w.Body.String())
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	var errorCode int
+	router := New()
+	router.SetErrorHandler(func(w http.ResponseWriter, _ *http.Request, code int) {
+		errorCode = code
+		w.WriteHeader(code)
+		w.Write([]byte("too large"))
+	})
+	router.Use(MaxBodyBytes(10))
+
+	var (
+		called, completed bool
+		writeErr          error
+	)
+	router.POST("/upload", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		called = true
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			_, writeErr = w.Write([]byte("read failed"))
+			return
+		}
+		completed = true
+		w.Write(body)
+	})
+
+	tests := []struct {
+		name      string
+		body      io.Reader
+		code      int
+		response  string
+		called    bool
+		completed bool
+	}{
+		{"within limit", strings.NewReader("0123456789"), http.StatusOK, "0123456789", true, true},
+		{"declared too large", strings.NewReader("0123456789x"), http.StatusRequestEntityTooLarge, "too large", false, false},
+		{"streamed too large", io.MultiReader(strings.NewReader("01234"), strings.NewReader("56789x")),
+			http.StatusRequestEntityTooLarge, "too large", true, false},
+	}
+	for _, tt := range tests {
+		called, completed, writeErr, errorCode = false, false, nil, 0
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodPost, "/upload", tt.body)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.response {
+			t.Errorf("%s: want %d %q, got %d %q", tt.name, tt.code, tt.response, w.Code, w.Body.String())
+		}
+		if called != tt.called || completed != tt.completed {
+			t.Errorf("%s: handler called %v completed %v", tt.name, called, completed)
+		}
+		if tt.code == http.StatusRequestEntityTooLarge && errorCode != tt.code {
+			t.Errorf("%s: error handler not used: %d", tt.name, errorCode)
+		}
+		if tt.called && !tt.completed && writeErr != ErrRequestTooLarge {
+			t.Errorf("%s: want ErrRequestTooLarge for late writes, got %v", tt.name, writeErr)
+		}
+	}
+}
+
+func TestNormalizeHeaders(t *testing.T) {
+	var got http.Header
+	h := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Connection", "keep-alive, X-Internal")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("Upgrade", "h2c")
+	r.Header.Set("Te", "trailers")
+	r.Header.Set("X-Internal", "1")
+	r.Header.Set("X-Kept", "1")
+	r.Header.Add("Accept-Encoding", "GZIP , br,,")
+	r.Header.Add("Accept-Encoding", "gzip;q=0.5, Deflate; Q=0.1")
+	NormalizeHeaders()(h).ServeHTTP(httptest.NewRecorder(), r)
+
+	for _, name := range []string{"Connection", "Keep-Alive", "Upgrade", "Te", "X-Internal"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("header %s not stripped", name)
+		}
+	}
+	if got.Get("X-Kept") != "1" {
+		t.Error("unrelated header removed")
+	}
+	if ae := got["Accept-Encoding"]; len(ae) != 1 || ae[0] != "gzip, br, deflate;q=0.1" {
+		t.Errorf("Accept-Encoding not normalized: %q", ae)
+	}
+	if r.Header.Get("Keep-Alive") == "" {
+		t.Error("caller's request was modified")
+	}
+
+	// custom header set
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("X-Debug", "1")
+	NormalizeHeaders("x-debug")(h).ServeHTTP(httptest.NewRecorder(), r)
+	if got.Get("Upgrade") != "websocket" || got.Get("X-Debug") != "" {
+		t.Errorf("custom strip set not applied: %v", got)
+	}
+}
+
+func TestPerClientConcurrency(t *testing.T) {
+	const limit = 3
+	release := make(chan struct{})
+	var entered sync.WaitGroup
+	router := New()
+	router.RecoveryHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.Use(PerClientConcurrency(limit, nil))
+	router.GET("/slow", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		entered.Done()
+		<-release
+	})
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("boom")
+	})
+
+	serve := func(path, remote string) int {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = remote
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// fill the limit for one client
+	var done sync.WaitGroup
+	entered.Add(limit)
+	for i := 0; i < limit; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			serve("/slow", "192.0.2.1:1000")
+		}()
+	}
+	entered.Wait()
+
+	if code := serve("/slow", "192.0.2.1:2000"); code != http.StatusTooManyRequests {
+		t.Errorf("want 429 above the limit, got %d", code)
+	}
+	entered.Add(1)
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		if code := serve("/slow", "192.0.2.2:1000"); code != http.StatusOK {
+			t.Errorf("other client: want 200, got %d", code)
+		}
+	}()
+	entered.Wait()
+	close(release)
+	done.Wait()
+
+	// slots are released, also after panics
+	for i := 0; i < limit+1; i++ {
+		if code := serve("/panic", "192.0.2.1:1000"); code != http.StatusInternalServerError {
+			t.Fatalf("panic request %d: want 500, got %d", i, code)
+		}
+	}
+
+	// concurrent acquisition and release under load never exceeds the limit
+	var mu sync.Mutex
+	var current, peak int
+	router = New()
+	router.Use(PerClientConcurrency(limit, func(*http.Request) string { return "same" }))
+	router.GET("/", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		mu.Lock()
+		if current++; current > peak {
+			peak = current
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		current--
+		mu.Unlock()
+	})
+	var ok, rejected atomic.Int64
+	var load sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		load.Add(1)
+		go func() {
+			defer load.Done()
+			switch serve("/", "") {
+			case http.StatusOK:
+				ok.Add(1)
+			case http.StatusTooManyRequests:
+				rejected.Add(1)
+			}
+		}()
+	}
+	load.Wait()
+	if peak > limit || ok.Load() == 0 || ok.Load()+rejected.Load() != 50 {
+		t.Errorf("peak=%d ok=%d rejected=%d", peak, ok.Load(), rejected.Load())
+	}
+}
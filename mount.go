@@ -0,0 +1,123 @@
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// mountRestParam 是 MountRouter 注册的 catch-all 参数名
+const mountRestParam = "mountRest"
+
+// mountParamsKey 是挂载点之外（外层路由器）捕获的参数在请求上下文中的键
+type mountParamsKey struct{}
+
+// MountRouter 将子路由器 sub 挂载到组内的 relativePath 之下：
+// 注册 relativePath/*mountRest（对路由器的 AnyMethods 中的所有方法，见 ANY），
+// 把请求路径改写为相对于挂载点的剩余部分后交给 sub.ServeHTTP 处理。
+// 例如挂载到 "/users/:uid/admin" 时，请求 /users/7/admin/settings 在 sub 中以 /settings 匹配。
+//
+// 外层捕获的参数（例如 uid）会合并到子路由器处理函数的请求上下文中，
+// 可以通过 ParamsFromContext 获取；同名参数以子路由器捕获的为准。
+// 传给子路由器处理函数的 Params 参数只包含子路由器自身捕获的参数。
+// 改写后请求的 URL.RawPath 被清空；原始请求不会被修改。
+func (g *Group) MountRouter(relativePath string, sub *Router) {
+	if sub == nil {
+		panic("mounted router must not be nil")
+	}
+	pattern := joinGroupPath(g.prefix, relativePath)
+	if pattern[len(pattern)-1] != '/' {
+		pattern += "/"
+	}
+	pattern += "*" + mountRestParam
+
+	handle := mountHandle(sub)
+	methods := matchMethods(g.router.anyMethods())
+	g.router.mutate(func() {
+		for _, method := range methods {
+			g.router.checkRoute(method, pattern, handle)
+		}
+		for _, method := range methods {
+			g.addRoute(method, pattern, handle, g.chain())
+		}
+	})
+}
+
+// Mount 将任意的 http.Handler（例如另一个拥有自己的中间件的 *Router）挂载到 prefix 之下：
+// 为 prefix 与 prefix/*mountRest 注册路由（对 AnyMethods 中的所有方法），
+// 把请求路径改写为去除 prefix 之后的部分再交给 sub.ServeHTTP，请求 prefix 本身时改写为 "/"。
+// 例如挂载到 "/admin" 时，请求 /admin/users 在 sub 中以 /users 处理，/admin 与 /admin/ 以 / 处理。
+//
+// sub 收到的是请求的副本，原始请求不会被修改，因此无需在处理之后恢复路径；副本的 URL.RawPath 被清空。
+// 与 Group.MountRouter 相同，prefix 中捕获的参数可以在 sub 中通过 ParamsFromContext 获取。
+// 注册是原子的：任何一个路由的注册会发生冲突时，在修改路由器之前 panic。
+func (r *Router) Mount(prefix string, sub http.Handler) {
+	if sub == nil {
+		panic("mounted handler must not be nil")
+	}
+	if len(prefix) < 1 || prefix[0] != '/' {
+		panic("mount prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	base := strings.TrimRight(prefix, "/")
+	patterns := []string{base + "/*" + mountRestParam}
+	if base != "" {
+		patterns = append(patterns, base)
+	}
+
+	handle := mountHandle(sub)
+	methods := matchMethods(r.anyMethods())
+	r.mutate(func() {
+		for _, method := range methods {
+			for _, pattern := range patterns {
+				r.checkRoute(method, pattern, handle)
+			}
+		}
+		for _, method := range methods {
+			for _, pattern := range patterns {
+				r.addRoute(method, pattern, handle, nil, false)
+			}
+		}
+	})
+}
+
+// mountHandle 返回将请求交给挂载的 sub 处理的处理函数：
+// 请求路径改写为 mountRest 参数的值（不存在时为 "/"），外层捕获的参数放入请求上下文。
+func mountHandle(sub http.Handler) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		var outer Params
+		for _, p := range ps {
+			if p.Key != mountRestParam && p.Key != MatchedRoutePathParam {
+				outer = append(outer, p)
+			}
+		}
+
+		// 嵌套挂载时保留更外层的参数
+		ctx := req.Context()
+		outer = mergeMountParams(ctx, outer)
+		if len(outer) > 0 {
+			ctx = context.WithValue(ctx, mountParamsKey{}, outer)
+			ctx = context.WithValue(ctx, ParamsKey, outer)
+		}
+		u := *req.URL
+		u.Path = ps.ByName(mountRestParam)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		u.RawPath = ""
+		inner := req.WithContext(ctx)
+		inner.URL = &u
+		sub.ServeHTTP(w, inner)
+	}
+}
+
+// mergeMountParams 将挂载点外层捕获的参数（如果有）追加到 ps 之后，
+// 使同名参数以 ps 中的为准。
+func mergeMountParams(ctx context.Context, ps Params) Params {
+	outer, _ := ctx.Value(mountParamsKey{}).(Params)
+	if len(outer) == 0 {
+		return ps
+	}
+	merged := make(Params, 0, len(ps)+len(outer))
+	merged = append(merged, ps...)
+	return append(merged, outer...)
+}
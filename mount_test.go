@@ -0,0 +1,129 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGroupMountRouter(t *testing.T) {
+	var (
+		gotPath   string
+		gotParams Params
+		gotCtx    Params
+	)
+	record := func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		gotPath = r.URL.Path
+		gotParams = ps
+		gotCtx = ParamsFromContext(r.Context())
+	}
+
+	sub := New()
+	sub.GET("/", record)
+	sub.GET("/settings", record)
+	sub.POST("/items/:id", record)
+
+	nested := New()
+	nested.GET("/files/:name", record)
+	sub.Group("/").MountRouter("/storage/:bucket", nested)
+
+	router := New()
+	router.Group("/users/:uid").MountRouter("/admin", sub)
+
+	tests := []struct {
+		method, path string
+		code         int
+		innerPath    string
+		params       Params
+		ctx          Params
+	}{
+		{http.MethodGet, "/users/7/admin/", http.StatusOK, "/", nil, Params{{"uid", "7"}}},
+		{http.MethodGet, "/users/7/admin/settings", http.StatusOK, "/settings", nil, Params{{"uid", "7"}}},
+		{http.MethodPost, "/users/7/admin/items/3", http.StatusOK, "/items/3",
+			Params{{"id", "3"}}, Params{{"id", "3"}, {"uid", "7"}}},
+		{http.MethodGet, "/users/7/admin/storage/b1/files/a.txt", http.StatusOK, "/files/a.txt",
+			Params{{"name", "a.txt"}}, Params{{"name", "a.txt"}, {"bucket", "b1"}, {"uid", "7"}}},
+		{http.MethodGet, "/users/7/admin/unknown", http.StatusNotFound, "", nil, nil},
+		{http.MethodPut, "/users/7/admin/settings", http.StatusMethodNotAllowed, "", nil, nil},
+	}
+	for _, tt := range tests {
+		gotPath, gotParams, gotCtx = "", nil, nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || gotPath != tt.innerPath {
+			t.Errorf("%s %s: want %d at %q, got %d at %q", tt.method, tt.path, tt.code, tt.innerPath, w.Code, gotPath)
+		}
+		if len(gotParams) != len(tt.params) || (len(tt.params) > 0 && !reflect.DeepEqual(gotParams, tt.params)) {
+			t.Errorf("%s %s: want params %v, got %v", tt.method, tt.path, tt.params, gotParams)
+		}
+		if !reflect.DeepEqual(gotCtx, tt.ctx) {
+			t.Errorf("%s %s: want context params %v, got %v", tt.method, tt.path, tt.ctx, gotCtx)
+		}
+		if r.URL.Path != tt.path {
+			t.Errorf("original request modified: %q", r.URL.Path)
+		}
+	}
+}
+
+func TestRouterMount(t *testing.T) {
+	var gotPath string
+	sub := New()
+	sub.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Sub", "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	record := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		gotPath = r.URL.Path
+	}
+	sub.GET("/", record)
+	sub.GET("/users", record)
+
+	router := New()
+	router.Mount("/admin", sub)
+	router.Mount("/plain/", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+	}))
+
+	tests := []struct {
+		method, path string
+		code         int
+		innerPath    string
+	}{
+		{http.MethodGet, "/admin", http.StatusOK, "/"},
+		{http.MethodGet, "/admin/", http.StatusOK, "/"},
+		{http.MethodGet, "/admin/users", http.StatusOK, "/users"},
+		{http.MethodGet, "/admin/unknown", http.StatusNotFound, ""},
+		{http.MethodPost, "/plain/a/b", http.StatusOK, "/a/b"},
+		{http.MethodGet, "/plain", http.StatusOK, "/"},
+	}
+	for _, tt := range tests {
+		gotPath = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || gotPath != tt.innerPath {
+			t.Errorf("%s %s: want %d at %q, got %d at %q", tt.method, tt.path, tt.code, tt.innerPath, w.Code, gotPath)
+		}
+		if r.URL.Path != tt.path {
+			t.Errorf("original request modified: %q", r.URL.Path)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/admin/users", nil)
+	router.ServeHTTP(w, r)
+	if w.Header().Get("X-Sub") != "1" {
+		t.Error("sub router middleware not applied")
+	}
+
+	if recv := catchPanic(func() { router.Mount("/admin", sub) }); recv == nil {
+		t.Error("expected panic for conflicting mount")
+	}
+	if recv := catchPanic(func() { router.Mount("admin", sub) }); recv == nil {
+		t.Error("expected panic for prefix without leading '/'")
+	}
+}
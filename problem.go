@@ -0,0 +1,48 @@
+package httprouter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Problem 是 RFC 9457（原 RFC 7807）定义的 problem details 对象，
+// 由 ProblemJSONErrorHandler 以 application/problem+json 格式写出。
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+
+	// Allowed 是 405 回复中允许的方法列表（见 AllowedMethodsFromContext），其他状态码时省略
+	Allowed []string `json:"allowed,omitempty"`
+
+	// Errors 是 400 回复中未通过校验的字段（见 ValidationErrors 与 POSTJSON），其他情况下省略
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// ProblemJSONErrorHandler 是以 application/problem+json 格式回复错误的 ErrorHandlerFunc，
+// 可通过 SetErrorHandler 使用。405 回复会在 allowed 字段中列出允许的方法，与 Allow 头部一致：
+//
+//	{"type":"about:blank","title":"Method Not Allowed","status":405,"allowed":["GET","OPTIONS"]}
+//
+// 请求错误为 ValidationErrors 时（见 RequestErrorFromContext），errors 字段列出未通过校验的字段。
+func ProblemJSONErrorHandler(w http.ResponseWriter, req *http.Request, statusCode int) {
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+	}
+	if statusCode == http.StatusMethodNotAllowed {
+		p.Allowed = AllowedMethodsFromContext(req.Context())
+	}
+	var ve ValidationErrors
+	if errors.As(RequestErrorFromContext(req.Context()), &ve) {
+		p.Errors = ve
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/problem+json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(p)
+}
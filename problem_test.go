@@ -0,0 +1,54 @@
+package httprouter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProblemJSONErrorHandler(t *testing.T) {
+	router := New()
+	router.SetErrorHandler(ProblemJSONErrorHandler)
+	router.GET("/items", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.POST("/items", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodDelete, "/items", nil)
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("want 405 problem+json, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	allow := strings.Split(w.Header().Get("Allow"), ", ")
+	want := Problem{Type: "about:blank", Title: "Method Not Allowed", Status: 405, Allowed: []string{"GET", "OPTIONS", "POST"}}
+	if !reflect.DeepEqual(p, want) || !reflect.DeepEqual(p.Allowed, allow) {
+		t.Errorf("want %+v matching Allow %v, got %+v", want, allow, p)
+	}
+
+	// other errors carry no allowed methods
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/missing", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "allowed") {
+		t.Errorf("unexpected 404 reply: %d %s", w.Code, w.Body.String())
+	}
+
+	// the allowed methods are also available to MethodNotAllowed handlers
+	var got []string
+	router.MethodNotAllowed = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = AllowedMethodsFromContext(r.Context())
+	})
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodDelete, "/items", nil)
+	router.ServeHTTP(w, r)
+	if !reflect.DeepEqual(got, want.Allowed) {
+		t.Errorf("want allowed methods %v in context, got %v", want.Allowed, got)
+	}
+}
@@ -0,0 +1,103 @@
+package httprouter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit 为路由设置独立的限流器（令牌桶），与全局限流互不影响：
+// 每个键每秒补充 rate 个令牌，最多积累 burst 个，每个请求消耗一个令牌。
+// 令牌不足时以 429 Too Many Requests（经由错误处理器）拒绝请求，并设置 Retry-After 头部（秒）。
+//
+// key 从请求计算限流键，为 nil 时使用客户端 IP（RemoteAddr 去掉端口）。
+// 限流状态保存在路由上；空闲到令牌已经补满的键与新键没有区别，会被定期清理，
+// 因此内存占用只与最近活跃的键的数量有关。时间由 Router.Clock 提供。
+func (rt *Route) RateLimit(rate float64, burst int, key func(*http.Request) string) *Route {
+	if rate <= 0 || burst < 1 {
+		panic("rate limit requires a positive rate and a burst of at least 1")
+	}
+	if key == nil {
+		key = clientIP
+	}
+	l := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+	return rt.addGuard(func(w http.ResponseWriter, req *http.Request) int {
+		ok, retryAfter := l.allow(key(req), rt.router.now())
+		if ok {
+			return 0
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return http.StatusTooManyRequests
+	})
+}
+
+// clientIP 返回请求的客户端 IP（RemoteAddr 去掉端口）。
+func clientIP(req *http.Request) string {
+	return stripHostPort(req.RemoteAddr)
+}
+
+// rateLimiter 是按键区分的令牌桶限流器。
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // 每秒补充的令牌数
+	burst     float64 // 令牌桶容量
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow 尝试为 key 消耗一个令牌，失败时返回需要等待的时间。
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = l.refill(b, now)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// refill 返回桶在 now 时的令牌数。
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(l.burst, b.tokens+elapsed*l.rate)
+}
+
+// sweep 在每经过一个补满周期（burst/rate）时删除令牌已经补满的桶。
+func (l *rateLimiter) sweep(now time.Time) {
+	period := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < period {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
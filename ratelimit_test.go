@@ -0,0 +1,83 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouteRateLimit(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var errorCode int
+	router := New()
+	router.Clock = func() time.Time { return now }
+	router.SetErrorHandler(func(w http.ResponseWriter, _ *http.Request, code int) {
+		errorCode = code
+		w.WriteHeader(code)
+	})
+	router.GET("/expensive", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).RateLimit(0.5, 2, nil)
+	router.GET("/cheap", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	serve := func(path, addr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = addr
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := serve("/expensive", "10.0.0.1:1000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within burst rejected: %d", i, w.Code)
+		}
+	}
+	w := serve("/expensive", "10.0.0.1:2000")
+	if w.Code != http.StatusTooManyRequests || errorCode != http.StatusTooManyRequests {
+		t.Fatalf("want 429 via error handler, got %d (%d)", w.Code, errorCode)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("want Retry-After 2, got %q", got)
+	}
+
+	// other clients and other routes are unaffected
+	if w := serve("/expensive", "10.0.0.2:1000"); w.Code != http.StatusOK {
+		t.Errorf("other client limited: %d", w.Code)
+	}
+	if w := serve("/cheap", "10.0.0.1:1000"); w.Code != http.StatusOK {
+		t.Errorf("other route limited: %d", w.Code)
+	}
+
+	now = now.Add(2 * time.Second)
+	if w := serve("/expensive", "10.0.0.1:1000"); w.Code != http.StatusOK {
+		t.Errorf("token not refilled: %d", w.Code)
+	}
+	if w := serve("/expensive", "10.0.0.1:1000"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("want 429 after refilled token was used, got %d", w.Code)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := &rateLimiter{rate: 1, burst: 2, buckets: make(map[string]*tokenBucket)}
+
+	l.allow("a", now)
+	l.allow("b", now)
+	now = now.Add(time.Second)
+	l.allow("b", now)
+	l.allow("b", now)
+	if len(l.buckets) != 2 {
+		t.Fatalf("want 2 buckets, got %d", len(l.buckets))
+	}
+
+	// "a" is full again after 2s and removed, "b" still has a deficit
+	now = now.Add(1500 * time.Millisecond)
+	l.allow("c", now)
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("idle bucket not removed")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("active bucket removed")
+	}
+}
@@ -0,0 +1,83 @@
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ResourceIndexer 是资源控制器的可选方法：GET /resources
+type ResourceIndexer interface {
+	Index(http.ResponseWriter, *http.Request, Params)
+}
+
+// ResourceShower 是资源控制器的可选方法：GET /resources/:id
+type ResourceShower interface {
+	Show(http.ResponseWriter, *http.Request, Params)
+}
+
+// ResourceCreator 是资源控制器的可选方法：POST /resources
+type ResourceCreator interface {
+	Create(http.ResponseWriter, *http.Request, Params)
+}
+
+// ResourceUpdater 是资源控制器的可选方法：PUT /resources/:id
+type ResourceUpdater interface {
+	Update(http.ResponseWriter, *http.Request, Params)
+}
+
+// ResourceDeleter 是资源控制器的可选方法：DELETE /resources/:id
+type ResourceDeleter interface {
+	Delete(http.ResponseWriter, *http.Request, Params)
+}
+
+// Resource 为一个 REST 资源一次性注册路由。
+// controller 可以实现 ResourceIndexer、ResourceShower、ResourceCreator、
+// ResourceUpdater 与 ResourceDeleter 中的任意几个，未实现的操作不会注册：
+//
+//	GET    path       -> Index
+//	GET    path/:id   -> Show
+//	POST   path       -> Create
+//	PUT    path/:id   -> Update
+//	DELETE path/:id   -> Delete
+//
+// 如果 controller 一个方法都没有实现，则 panic。
+func (r *Router) Resource(path string, controller interface{}) {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	g := r.Group("/")
+	g.implicit = true
+	g.Resource(path, controller)
+}
+
+// Resource 是 Group 的 router.Resource 的快捷方式，路径相对于组前缀。
+func (g *Group) Resource(relativePath string, controller interface{}) {
+	collection := strings.TrimSuffix(relativePath, "/")
+	item := collection + "/:id"
+
+	registered := false
+	if c, ok := controller.(ResourceIndexer); ok {
+		g.Handle(http.MethodGet, collection, c.Index)
+		registered = true
+	}
+	if c, ok := controller.(ResourceShower); ok {
+		g.Handle(http.MethodGet, item, c.Show)
+		registered = true
+	}
+	if c, ok := controller.(ResourceCreator); ok {
+		g.Handle(http.MethodPost, collection, c.Create)
+		registered = true
+	}
+	if c, ok := controller.(ResourceUpdater); ok {
+		g.Handle(http.MethodPut, item, c.Update)
+		registered = true
+	}
+	if c, ok := controller.(ResourceDeleter); ok {
+		g.Handle(http.MethodDelete, item, c.Delete)
+		registered = true
+	}
+	if !registered {
+		panic("resource controller for path '" + joinGroupPath(g.prefix, relativePath) +
+			"' implements none of Index, Show, Create, Update or Delete")
+	}
+}
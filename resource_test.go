@@ -0,0 +1,85 @@
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type readOnlyController struct {
+	called *string
+}
+
+func (c readOnlyController) Index(_ http.ResponseWriter, _ *http.Request, _ Params) {
+	*c.called = "index"
+}
+
+func (c readOnlyController) Show(_ http.ResponseWriter, _ *http.Request, ps Params) {
+	*c.called = "show:" + ps.ByName("id")
+}
+
+type fullController struct {
+	readOnlyController
+}
+
+func (c fullController) Create(_ http.ResponseWriter, _ *http.Request, _ Params) {
+	*c.called = "create"
+}
+
+func (c fullController) Update(_ http.ResponseWriter, _ *http.Request, ps Params) {
+	*c.called = "update:" + ps.ByName("id")
+}
+
+func (c fullController) Delete(_ http.ResponseWriter, _ *http.Request, ps Params) {
+	*c.called = "delete:" + ps.ByName("id")
+}
+
+func TestRouterResource(t *testing.T) {
+	var called string
+	router := New()
+	router.Resource("/photos/", readOnlyController{&called})
+	router.Group("/api").Resource("/users", fullController{readOnlyController{&called}})
+
+	tests := []struct {
+		method, path string
+		code         int
+		want         string
+	}{
+		{http.MethodGet, "/photos", http.StatusOK, "index"},
+		{http.MethodGet, "/photos/3", http.StatusOK, "show:3"},
+		{http.MethodPost, "/photos", http.StatusMethodNotAllowed, ""},
+		{http.MethodDelete, "/photos/3", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/api/users", http.StatusOK, "index"},
+		{http.MethodGet, "/api/users/7", http.StatusOK, "show:7"},
+		{http.MethodPost, "/api/users", http.StatusOK, "create"},
+		{http.MethodPut, "/api/users/7", http.StatusOK, "update:7"},
+		{http.MethodDelete, "/api/users/7", http.StatusOK, "delete:7"},
+	}
+	for _, tt := range tests {
+		called = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || called != tt.want {
+			t.Errorf("%s %s: want %d/%q, got %d/%q", tt.method, tt.path, tt.code, tt.want, w.Code, called)
+		}
+	}
+
+	want := []RouteInfo{
+		{http.MethodGet, "/api/users", true},
+		{http.MethodPost, "/api/users", true},
+		{http.MethodDelete, "/api/users/:id", true},
+		{http.MethodGet, "/api/users/:id", true},
+		{http.MethodPut, "/api/users/:id", true},
+		{http.MethodGet, "/photos", false},
+		{http.MethodGet, "/photos/:id", false},
+	}
+	if got := router.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes:\nwant %v\n got %v", want, got)
+	}
+
+	if recv := catchPanic(func() { router.Resource("/empty", struct{}{}) }); recv == nil {
+		t.Error("no panic for controller without resource methods")
+	}
+}
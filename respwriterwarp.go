@@ -1,7 +1,11 @@
 package httprouter // 或者你项目的包名
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 )
 
 // errorCapturingResponseWriter 用于在 FileServer 处理时捕获错误状态码，
@@ -116,16 +120,25 @@ func (ecw *errorCapturingResponseWriter) Write(data []byte) (int, error) {
 
 // Flush 尝试刷新缓冲的数据到客户端。
 // 仅当未捕获错误且原始 ResponseWriter 支持 http.Flusher 时才执行。
+// 与其他包装器一致，响应尚未开始时先隐式写出 200 OK 头部，保证 Flush 立即生效（例如流式响应）。
 func (ecw *errorCapturingResponseWriter) Flush() {
 	if flusher, ok := ecw.w.(http.Flusher); ok {
-		if !ecw.capturedErrorSignal && ecw.responseStarted {
-			flusher.Flush()
-		}
 		// 如果 capturedErrorSignal 为 true，我们不希望刷新任何 FileServer 可能已缓冲的错误内容（理论上不应有）。
-		// 如果 responseStarted 为 false (且非错误)，则刷新也无意义。
+		if ecw.capturedErrorSignal {
+			return
+		}
+		if !ecw.responseStarted {
+			ecw.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
 	}
 }
 
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+func (ecw *errorCapturingResponseWriter) Unwrap() http.ResponseWriter {
+	return ecw.w
+}
+
 // processAfterFileServer 在 http.FileServer.ServeHTTP 调用完成后执行。
 // 如果之前捕获了错误信号 (capturedErrorSignal is true) 并且响应尚未开始，
 // 它将调用配置的 ErrorHandlerFunc 来处理错误。
@@ -151,3 +164,256 @@ func (ecw *errorCapturingResponseWriter) processAfterFileServer() {
 	// 这种混合情况非常复杂，此时覆盖已发送的部分响应通常是不可能的或不安全的。
 	// 当前逻辑假设一旦 responseStarted (for success)，我们就不能再用 ErrorHandler 回退。
 }
+
+// statusCapturingResponseWriter 记录处理过程中写出的状态码与字节数，
+// 并可在首次写出头部之前执行回调（例如补充 Server-Timing 头部）。
+type statusCapturingResponseWriter struct {
+	w                 http.ResponseWriter // 原始的 ResponseWriter
+	status            int                 // 实际写出的状态码，未写出时为 0
+	size              int                 // 已写出的响应体字节数
+	started           bool                // 标记响应头部是否已经写出
+	beforeWriteHeader func(http.Header)   // 首次写出头部之前调用，可为 nil
+}
+
+// newStatusCapturingResponseWriter 创建一个包装 w 的 statusCapturingResponseWriter。
+func newStatusCapturingResponseWriter(w http.ResponseWriter) *statusCapturingResponseWriter {
+	return &statusCapturingResponseWriter{w: w}
+}
+
+// Header 代理到原始 ResponseWriter 的 Header()。
+func (scw *statusCapturingResponseWriter) Header() http.Header {
+	return scw.w.Header()
+}
+
+// WriteHeader 记录状态码并写出头部。
+// 1xx 信息性响应（101 除外）不会被视为响应开始。
+func (scw *statusCapturingResponseWriter) WriteHeader(statusCode int) {
+	if scw.started {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		scw.w.WriteHeader(statusCode)
+		return
+	}
+	if scw.beforeWriteHeader != nil {
+		scw.beforeWriteHeader(scw.w.Header())
+	}
+	scw.status = statusCode
+	scw.started = true
+	scw.w.WriteHeader(statusCode)
+}
+
+// Write 写入响应体，必要时隐式写出 200 OK 头部。
+func (scw *statusCapturingResponseWriter) Write(data []byte) (int, error) {
+	if !scw.started {
+		scw.WriteHeader(http.StatusOK)
+	}
+	n, err := scw.w.Write(data)
+	scw.size += n
+	return n, err
+}
+
+// Flush 在原始 ResponseWriter 支持 http.Flusher 时刷新缓冲的数据。
+func (scw *statusCapturingResponseWriter) Flush() {
+	if flusher, ok := scw.w.(http.Flusher); ok {
+		if !scw.started {
+			scw.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+func (scw *statusCapturingResponseWriter) Unwrap() http.ResponseWriter {
+	return scw.w
+}
+
+// headResponseWriter 是 Route.WithHEAD 与 AutoHead 使用的 ResponseWriter，丢弃响应体并统计其长度，
+// 以便在处理结束后补充 Content-Length。头部延迟到 finish（或 Flush）时才写出。
+type headResponseWriter struct {
+	w       http.ResponseWriter // 原始的 ResponseWriter
+	status  int                 // 处理函数设置的状态码，未设置时为 0
+	size    int64               // 被丢弃的响应体字节数
+	started bool                // 标记头部是否已经写出
+}
+
+func (hw *headResponseWriter) Header() http.Header {
+	return hw.w.Header()
+}
+
+// WriteHeader 记录状态码。1xx 信息性响应（101 除外）直接写出。
+func (hw *headResponseWriter) WriteHeader(statusCode int) {
+	if hw.started || hw.status != 0 {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		hw.w.WriteHeader(statusCode)
+		return
+	}
+	hw.status = statusCode
+}
+
+// Write 丢弃数据，只统计长度。
+func (hw *headResponseWriter) Write(data []byte) (int, error) {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hw.size += int64(len(data))
+	return len(data), nil
+}
+
+// Flush 立即写出头部（此后无法再补充 Content-Length）并刷新。
+func (hw *headResponseWriter) Flush() {
+	hw.writeHeader(false)
+	if flusher, ok := hw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish 在处理函数返回后写出头部，必要时补充 Content-Length。
+func (hw *headResponseWriter) finish() {
+	hw.writeHeader(true)
+}
+
+func (hw *headResponseWriter) writeHeader(complete bool) {
+	if hw.started {
+		return
+	}
+	hw.started = true
+	status := hw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	h := hw.w.Header()
+	if complete && h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified && status >= 200 {
+		h.Set("Content-Length", strconv.FormatInt(hw.size, 10))
+	}
+	hw.w.WriteHeader(status)
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+func (hw *headResponseWriter) Unwrap() http.ResponseWriter {
+	return hw.w
+}
+
+// trackingResponseWriter 记录响应是否已经开始写出，以及连接是否已被处理程序接管（Hijack），
+// 使 panic 恢复等路由器自身的回复不会破坏已经写出一部分的响应，也不会写入已被接管的连接。
+// 响应开始之后再次调用的 WriteHeader 被忽略；接管之后的 WriteHeader 与 Write 不再传递给原始 ResponseWriter。
+// 路由器为每个请求使用它，见 Router.ServeHTTP。
+type trackingResponseWriter struct {
+	w        http.ResponseWriter // 原始的 ResponseWriter
+	started  bool                // 标记响应头部是否已经写出
+	hijacked bool                // 标记连接是否已被接管
+}
+
+// newTrackingResponseWriter 为一个请求创建 trackingResponseWriter，并返回交给处理程序的 ResponseWriter。
+// 每个请求单独分配，不做池化：被 HardTimeout 放弃的处理程序仍可能经由 Unwrap 拿到它，
+// 复用会让其写入或接管之后其他客户端的连接。
+// 原始 ResponseWriter 支持 http.Pusher 时返回的 ResponseWriter 同样支持，与未包装时一致。
+func newTrackingResponseWriter(w http.ResponseWriter) (*trackingResponseWriter, http.ResponseWriter) {
+	tw := &trackingResponseWriter{w: w}
+	if _, ok := w.(http.Pusher); ok {
+		return tw, trackingPusher{tw}
+	}
+	return tw, tw
+}
+
+// trackingPusher 为支持 http.Pusher 的原始 ResponseWriter 转发 Push。
+type trackingPusher struct {
+	*trackingResponseWriter
+}
+
+// Push 转发给原始 ResponseWriter，连接被接管之后返回 http.ErrHijacked。
+func (tp trackingPusher) Push(target string, opts *http.PushOptions) error {
+	if tp.hijacked {
+		return http.ErrHijacked
+	}
+	// 与 http.ResponseController 一样沿 Unwrap 查找，tw.w 可能是路由器自己的其他包装器
+	rw := tp.w
+	for {
+		switch t := rw.(type) {
+		case http.Pusher:
+			return t.Push(target, opts)
+		case interface{ Unwrap() http.ResponseWriter }:
+			rw = t.Unwrap()
+		default:
+			return http.ErrNotSupported
+		}
+	}
+}
+
+// trackerOf 返回 w 所使用的 trackingResponseWriter，w 不是由 newTrackingResponseWriter 返回时为 nil。
+func trackerOf(w http.ResponseWriter) *trackingResponseWriter {
+	switch tw := w.(type) {
+	case *trackingResponseWriter:
+		return tw
+	case trackingPusher:
+		return tw.trackingResponseWriter
+	}
+	return nil
+}
+
+func (tw *trackingResponseWriter) Header() http.Header {
+	return tw.w.Header()
+}
+
+// WriteHeader 写出头部。1xx 信息性响应（101 除外）不会被视为响应开始。
+func (tw *trackingResponseWriter) WriteHeader(statusCode int) {
+	if tw.hijacked || tw.started {
+		return
+	}
+	if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+		tw.started = true
+	}
+	tw.w.WriteHeader(statusCode)
+}
+
+// Write 写入响应体，在连接被接管之后返回 http.ErrHijacked。
+func (tw *trackingResponseWriter) Write(data []byte) (int, error) {
+	if tw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	tw.started = true
+	return tw.w.Write(data)
+}
+
+// ReadFrom 使 io.Copy 仍然可以使用原始 ResponseWriter 的 io.ReaderFrom（例如 sendfile）。
+func (tw *trackingResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if tw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	tw.started = true
+	return io.Copy(tw.w, src)
+}
+
+// WriteString 与 Write 相同，使 io.WriteString 仍然可以使用原始 ResponseWriter 的 io.StringWriter。
+func (tw *trackingResponseWriter) WriteString(s string) (int, error) {
+	if tw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	tw.started = true
+	return io.WriteString(tw.w, s)
+}
+
+// Flush 在原始 ResponseWriter 支持 http.Flusher 且连接未被接管时刷新缓冲的数据。
+func (tw *trackingResponseWriter) Flush() {
+	if flusher, ok := tw.w.(http.Flusher); ok && !tw.hijacked {
+		tw.started = true
+		flusher.Flush()
+	}
+}
+
+// Hijack 通过 http.ResponseController 接管连接（可以穿过其他包装器），成功时记录下来。
+func (tw *trackingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(tw.w).Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+func (tw *trackingResponseWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
@@ -0,0 +1,389 @@
+package httprouter
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Route 表示一条已注册的路由，由 Handle 及其快捷方法（GET、POST 等）返回。
+// 可以通过 Route 的方法为路由追加“匹配后分派”规则：
+// trie 树匹配成功后，按添加顺序依次检查这些规则，第一个适用的规则决定实际执行的处理函数，
+// 都不适用时执行注册时提供的默认处理函数。
+//
+// 除分派规则外，还可以追加“守卫”：守卫在分派之前执行，
+// 可以拒绝请求并交由路由器以给定的状态码回复。
+//
+// Route 的方法应在开始处理请求之前调用，它们不是并发安全的。
+type Route struct {
+	router   *Router
+	method   string
+	path     string
+	handle   Handle
+	guards   []routeGuard
+	matchers []routeMatcher
+	produces string
+
+	correlationHeader string
+
+	// table 是路由注册所在的路由表
+	table *routeTable
+
+	// chain 是包含组中间件的完整处理链（不含 SaveMatchedRoutePath 的包装）
+	chain Handle
+
+	meta map[string]interface{}
+
+	// acl 是通过 AllowIPs 与 DenyIPs 设置的访问控制列表
+	acl *ipACL
+}
+
+// WithMeta 为路由附加一项元数据，可通过 Meta 读取，
+// 通过 HandleX 注册的处理函数也可以从 RouteContext.Meta 中直接取得。
+// 重复设置同一个键时后者生效。
+func (rt *Route) WithMeta(key string, value interface{}) *Route {
+	if rt.meta == nil {
+		rt.meta = make(map[string]interface{})
+	}
+	rt.meta[key] = value
+	return rt
+}
+
+// Meta 返回路由的元数据，没有元数据时返回 nil。返回的 map 不应被修改。
+func (rt *Route) Meta() map[string]interface{} {
+	return rt.meta
+}
+
+// RouteContext 汇集了一次路由匹配的全部信息，供通过 HandleX 注册的处理函数使用，
+// 免去多次从上下文中查找的开销。
+type RouteContext struct {
+	// Pattern 是匹配到的路由模式（包含组前缀），例如 "/users/:id"
+	Pattern string
+
+	// Params 是从请求路径中捕获的参数
+	Params Params
+
+	// Meta 是通过 Route.WithMeta 附加的路由元数据，可能为 nil，不应被修改
+	Meta map[string]interface{}
+}
+
+// RouteContextHandle 是接收 RouteContext 的请求处理函数，见 Router.HandleX。
+type RouteContextHandle func(http.ResponseWriter, *http.Request, RouteContext)
+
+// HandleX 与 Handle 相同，但注册的处理函数接收 RouteContext 而不是 Params。
+// 它是面向插件式处理函数的适配器，路由的匹配与分派规则与 Handle 完全一致。
+func (r *Router) HandleX(method, path string, handle RouteContextHandle) *Route {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	var rt *Route
+	rt = r.Handle(method, path, func(w http.ResponseWriter, req *http.Request, ps Params) {
+		handle(w, req, RouteContext{Pattern: rt.path, Params: ps, Meta: rt.meta})
+	})
+	return rt
+}
+
+// GETX 是 router.HandleX(http.MethodGet, path, handle) 的快捷方式
+func (r *Router) GETX(path string, handle RouteContextHandle) *Route {
+	return r.HandleX(http.MethodGet, path, handle)
+}
+
+// POSTX 是 router.HandleX(http.MethodPost, path, handle) 的快捷方式
+func (r *Router) POSTX(path string, handle RouteContextHandle) *Route {
+	return r.HandleX(http.MethodPost, path, handle)
+}
+
+// PUTX 是 router.HandleX(http.MethodPut, path, handle) 的快捷方式
+func (r *Router) PUTX(path string, handle RouteContextHandle) *Route {
+	return r.HandleX(http.MethodPut, path, handle)
+}
+
+// PATCHX 是 router.HandleX(http.MethodPatch, path, handle) 的快捷方式
+func (r *Router) PATCHX(path string, handle RouteContextHandle) *Route {
+	return r.HandleX(http.MethodPatch, path, handle)
+}
+
+// DELETEX 是 router.HandleX(http.MethodDelete, path, handle) 的快捷方式
+func (r *Router) DELETEX(path string, handle RouteContextHandle) *Route {
+	return r.HandleX(http.MethodDelete, path, handle)
+}
+
+// WithHEAD 为一个 GET 路由在同一路径注册 HEAD 路由：HEAD 请求执行与 GET 完全相同的处理链
+// （组中间件、守卫与处理函数），但响应体被丢弃。
+// 如果处理函数没有设置 Content-Length，则在处理结束后按 GET 响应体的长度设置，
+// 因此 HEAD 与 GET 的响应头部一致；为此响应头部会延迟到处理函数返回后才写出（除非处理函数调用了 Flush）。
+// 对非 GET 路由调用时 panic。
+func (rt *Route) WithHEAD() *Route {
+	if rt.method != http.MethodGet {
+		panic("WithHEAD requires a GET route, got " + rt.method + " " + rt.path)
+	}
+	rt.router.handle(http.MethodHead, rt.path, headHandle(rt.chain), nil)
+	return rt
+}
+
+// Name 为路由命名，之后可以通过 Router.URL 按名称生成路由的 URL。
+// 名称在路由表内必须唯一，重复时 panic。
+// 通过 Group 注册的路由以包含组前缀的完整路径登记，生成的 URL 同样包含组前缀。
+func (rt *Route) Name(name string) *Route {
+	if name == "" {
+		panic("route name must not be empty")
+	}
+	r := rt.router
+	r.mutate(func() {
+		t := rt.table
+		if t == r.liveTable() {
+			// 写时复制时登记到正在构建的副本中
+			t = r.routes
+		}
+		if t.names == nil {
+			t.names = make(map[string]*Route)
+		}
+		if existing, ok := t.names[name]; ok {
+			panic("route name '" + name + "' is already used by route '" + existing.method + " " + existing.path + "'")
+		}
+		t.names[name] = rt
+	})
+	return rt
+}
+
+// routeMatcher 根据请求选择一个替代处理函数，返回 nil 表示该规则不适用。
+type routeMatcher func(*http.Request) Handle
+
+// routeGuard 检查请求是否可以由该路由处理。
+// 返回 0 表示通过，否则返回用于拒绝请求的 HTTP 状态码；
+// 拒绝时守卫可以先设置响应头部（例如 Retry-After），但不应写出响应。
+type routeGuard func(http.ResponseWriter, *http.Request) int
+
+// Method 返回路由注册的 HTTP 方法。
+func (rt *Route) Method() string {
+	return rt.method
+}
+
+// Path 返回路由注册的完整路径（包含组前缀）。
+func (rt *Route) Path() string {
+	return rt.path
+}
+
+// serve 是实际注册到 trie 树中的处理函数，负责按规则分派请求。
+func (rt *Route) serve(w http.ResponseWriter, req *http.Request, ps Params) {
+	// 路由器以其他方法调用本路由时（目前只有自动 OPTIONS 回复），
+	// 只借用本路由的中间件链，不执行路由自身的逻辑。
+	// 通过 Lookup 获得的处理函数可能以 nil 请求调用，这里需要兼容。
+	if req != nil && req.Method != rt.method {
+		if reply, ok := req.Context().Value(autoOPTIONSKey{}).(http.Handler); ok {
+			reply.ServeHTTP(w, req)
+			return
+		}
+	}
+	for _, guard := range rt.guards {
+		if code := guard(w, req); code != 0 {
+			rt.router.reject(w, req, code)
+			return
+		}
+	}
+	if rt.produces != "" {
+		w.Header().Set("Content-Type", rt.produces)
+	}
+	if rt.correlationHeader != "" && req != nil {
+		if id := RequestIDFromContext(req.Context()); id != "" {
+			w.Header().Set(rt.correlationHeader, id)
+		}
+	}
+	for _, match := range rt.matchers {
+		if h := match(req); h != nil {
+			h(w, req, ps)
+			return
+		}
+	}
+	rt.handle(w, req, ps)
+}
+
+// addMatcher 追加一条匹配后分派规则。
+func (rt *Route) addMatcher(m routeMatcher) *Route {
+	rt.matchers = append(rt.matchers, m)
+	return rt
+}
+
+// Produces 声明路由响应的内容类型：在处理函数执行之前设置 Content-Type 头部。
+// 处理函数仍然可以覆盖它（后设置者生效）。
+// 该头部在守卫通过之后设置，对通过 Route 追加的替代处理函数同样有效。
+func (rt *Route) Produces(contentType string) *Route {
+	rt.produces = contentType
+	return rt
+}
+
+// ContentType 返回通过 Produces 声明的内容类型，未声明时返回空字符串。
+func (rt *Route) ContentType() string {
+	return rt.produces
+}
+
+// CorrelationHeader 让路由把 RequestID 中间件分配的请求 ID 额外写入名为 name 的响应头部，
+// 适用于期望 X-Correlation-ID 等特定头部名称的客户端。
+// 头部在守卫通过之后、处理函数执行之前设置；请求上下文中没有请求 ID 时不设置。
+func (rt *Route) CorrelationHeader(name string) *Route {
+	if name == "" {
+		panic("correlation header name must not be empty")
+	}
+	rt.correlationHeader = http.CanonicalHeaderKey(name)
+	return rt
+}
+
+// addGuard 追加一个守卫。
+func (rt *Route) addGuard(g routeGuard) *Route {
+	rt.guards = append(rt.guards, g)
+	return rt
+}
+
+// Host 将路由限制为只处理 Host 与给定主机名之一相同的请求（忽略端口与大小写）。
+// 主机名不匹配时，路由表现得如同未注册：请求交由 NotFound 处理；
+// 如果启用了 Router.MisdirectedHostHandling，则改为回复 421 Misdirected Request。
+func (rt *Route) Host(hosts ...string) *Route {
+	if len(hosts) == 0 {
+		panic("at least one host is required")
+	}
+	allowed := make([]string, len(hosts))
+	for i, h := range hosts {
+		allowed[i] = strings.ToLower(stripHostPort(h))
+	}
+	return rt.addGuard(func(_ http.ResponseWriter, req *http.Request) int {
+		host := strings.ToLower(stripHostPort(req.Host))
+		for _, h := range allowed {
+			if h == host {
+				return 0
+			}
+		}
+		if rt.router.MisdirectedHostHandling {
+			return http.StatusMisdirectedRequest
+		}
+		return http.StatusNotFound
+	})
+}
+
+// Except 将一个 catch-all 路由限制为不处理位于给定前缀之下的请求，
+// 这些请求表现得如同该路由未注册：交由 NotFound 处理。
+// 典型用法是单页应用的回退路由：
+//
+//	router.GET("/*path", spa).Except("/api", "/assets")
+//
+// 前缀按路径段匹配：前缀 "/api" 匹配 "/api" 与 "/api/users"，但不匹配 "/apis"。
+// 前缀与请求的完整路径比较。如果路由路径中没有 catch-all 参数，则 panic。
+// 由于根 catch-all 与同一方法下的其他路由冲突，被排除的请求通常由 NotFound 处理，
+// 例如把 NotFound 设置为提供 API 路由的另一个路由器。
+func (rt *Route) Except(prefixes ...string) *Route {
+	if !strings.Contains(rt.path, "/*") {
+		panic("Except requires a catch-all route, got path '" + rt.path + "'")
+	}
+	excluded := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		if len(p) < 1 || p[0] != '/' {
+			panic("excluded prefix must begin with '/' in prefix '" + p + "'")
+		}
+		excluded[i] = strings.TrimSuffix(p, "/")
+	}
+	return rt.addGuard(func(_ http.ResponseWriter, req *http.Request) int {
+		path := req.URL.Path
+		for _, p := range excluded {
+			if strings.HasPrefix(path, p) && (len(path) == len(p) || path[len(p)] == '/') {
+				return http.StatusNotFound
+			}
+		}
+		return 0
+	})
+}
+
+// Active 将路由限制为只在时间窗口 [from, to) 内生效，窗口之外路由表现得如同未注册：请求交由 NotFound 处理。
+// from 或 to 为零值表示该端不设限。适用于定时的维护页面或季节性端点。
+// 当前时间由 Router.Clock 提供（未设置时使用 time.Now），测试时可以替换。
+//
+// 同一方法与路径只能注册一个路由，因此不会出现两个窗口重叠的同名路由；
+// 如需在不同时间段使用不同的处理函数，请在一个路由上使用 Select 按时间选择。
+// 另外，窗口之外的路由不会回退到其他能匹配同一请求的模式（例如 /sale/now 失效时不会改用 /sale/:id），
+// 这与 trie 树的匹配规则一致。
+func (rt *Route) Active(from, to time.Time) *Route {
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		panic("active window must end after it starts")
+	}
+	return rt.addGuard(func(http.ResponseWriter, *http.Request) int {
+		now := rt.router.now()
+		if (!from.IsZero() && now.Before(from)) || (!to.IsZero() && !now.Before(to)) {
+			return http.StatusNotFound
+		}
+		return 0
+	})
+}
+
+// stripHostPort 去掉 host 中的端口部分（如果有）。
+func stripHostPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// Select 是最通用的匹配后分派规则：路由匹配成功后调用 key 计算一个键，
+// 并从 handlers 中选择对应的处理函数；键不存在时该规则不适用，
+// 继续尝试后续规则，最终回退到注册时提供的默认处理函数。
+// 按版本、Accept、协议等请求属性分派都可以用它来表达。
+// handlers 会被复制，之后修改传入的 map 不会影响路由。
+func (rt *Route) Select(key func(*http.Request) string, handlers map[string]Handle) *Route {
+	if key == nil {
+		panic("select key function must not be nil")
+	}
+	hs := make(map[string]Handle, len(handlers))
+	for k, h := range handlers {
+		if h == nil {
+			panic("handle for select key '" + k + "' must not be nil")
+		}
+		hs[k] = h
+	}
+	return rt.addMatcher(func(req *http.Request) Handle {
+		return hs[key(req)]
+	})
+}
+
+// WhenContentLengthOver 在请求的 Content-Length 大于 n 时改用 alt 处理请求。
+// 长度未知的请求（ContentLength 为 -1，例如分块传输编码）被视为超过阈值，
+// 因为此类请求的请求体大小无法事先确定。
+func (rt *Route) WhenContentLengthOver(n int64, alt Handle) *Route {
+	if alt == nil {
+		panic("alternative handle must not be nil")
+	}
+	return rt.addMatcher(func(req *http.Request) Handle {
+		if req.ContentLength < 0 || req.ContentLength > n {
+			return alt
+		}
+		return nil
+	})
+}
+
+// RequireCookie 要求请求携带名为 name 的 Cookie，缺少时以 400 Bad Request（经由错误处理器）拒绝请求。
+func (rt *Route) RequireCookie(name string) *Route {
+	if name == "" {
+		panic("cookie name must not be empty")
+	}
+	return rt.addGuard(func(_ http.ResponseWriter, req *http.Request) int {
+		if _, err := req.Cookie(name); err != nil {
+			return http.StatusBadRequest
+		}
+		return 0
+	})
+}
+
+// WhenCookie 在请求携带名为 name、值为 value 的 Cookie 时改用 alt 处理请求，
+// 适用于按预览或 beta 测试 Cookie 逐步放量。value 为空时只要求 Cookie 存在，不限定其值。
+// Cookie 不匹配时该规则不适用，继续尝试后续规则，最终回退到注册时提供的处理函数。
+func (rt *Route) WhenCookie(name, value string, alt Handle) *Route {
+	if name == "" {
+		panic("cookie name must not be empty")
+	}
+	if alt == nil {
+		panic("alternative handle must not be nil")
+	}
+	return rt.addMatcher(func(req *http.Request) Handle {
+		if c, err := req.Cookie(name); err == nil && (value == "" || c.Value == value) {
+			return alt
+		}
+		return nil
+	})
+}
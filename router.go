@@ -81,9 +81,19 @@ package httprouter
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Handle 是一个可以注册到路由以处理 HTTP 请求的函数。
@@ -128,6 +138,33 @@ func ParamsFromContext(ctx context.Context) Params {
 	return p
 }
 
+type closestMatchKey struct{}
+
+// ClosestMatchFromContext 返回未匹配请求的路径在路由树中能够匹配到的最长前缀，
+// 即查找失败前到达的最深节点所对应的请求路径部分（参数段按请求中的实际值计入）。
+// 仅在启用 Router.TrackClosestMatch 时由路由器在调用 NotFound 处理程序之前设置，否则返回空字符串。
+func ClosestMatchFromContext(ctx context.Context) string {
+	m, _ := ctx.Value(closestMatchKey{}).(string)
+	return m
+}
+
+type matchedPatternKey struct{}
+
+// MatchedPatternFromContext 返回匹配到的路由模式，即注册时使用的完整路径，
+// 例如 "/api/users/:id"（包含组前缀）、"/static/*filepath"（ServeFiles）或 "/files/:name?"（两种形式相同）。
+// 启用 CaseInsensitive 时同样保持注册时的大小写。
+// 仅在启用 Router.StoreRoutePattern 或存在通过 UsePostMatch 注册的匹配后中间件时，
+// 由路由器在调用处理程序之前设置，否则返回空字符串。
+func MatchedPatternFromContext(ctx context.Context) string {
+	p, _ := ctx.Value(matchedPatternKey{}).(string)
+	return p
+}
+
+// RoutePatternFromContext 与 MatchedPatternFromContext 相同，返回匹配到的路由模式。
+func RoutePatternFromContext(ctx context.Context) string {
+	return MatchedPatternFromContext(ctx)
+}
+
 // MatchedRoutePathParam 是存储匹配路由路径的 Param 名称，
 // 如果设置了 Router.SaveMatchedRoutePath。
 var MatchedRoutePathParam = "$matchedRoutePath"
@@ -150,6 +187,66 @@ type RecoveryHandlerFunc func(http.ResponseWriter, *http.Request, interface{})
 // 它接收状态码以及标准的ResponseWriter和Request。
 type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, statusCode int)
 
+// ErrorReason 说明路由器回复错误的原因，供 SetErrorHandlerExt 设置的错误处理函数区分同一状态码的不同来源，
+// 例如 404 是确实没有路由、只差尾部斜杠，还是静态文件不存在。
+type ErrorReason int
+
+const (
+	// ReasonOther 是其他原因，例如处理程序通过路由器回复的错误
+	ReasonOther ErrorReason = iota
+	// ReasonNotFound 表示没有匹配的路由
+	ReasonNotFound
+	// ReasonTrailingSlash 表示没有匹配的路由，但存在只差尾部斜杠的路由，重定向被关闭或不适用于该请求
+	ReasonTrailingSlash
+	// ReasonMethodNotAllowed 表示路径存在，但不允许请求的方法
+	ReasonMethodNotAllowed
+	// ReasonUnknownMethod 表示请求的方法没有注册任何路由，按 UnknownMethodStatus 回复
+	ReasonUnknownMethod
+	// ReasonPanic 表示处理请求时发生了 panic
+	ReasonPanic
+	// ReasonStaticMiss 表示静态文件（ServeFiles、StaticFile、未匹配路由的静态文件处理等）不存在
+	ReasonStaticMiss
+	// ReasonStaticError 表示静态文件服务的其他错误，例如读取失败或禁止访问
+	ReasonStaticError
+	// ReasonDraining 表示路由器正在排空，拒绝新请求（见 BeginDrain）
+	ReasonDraining
+	// ReasonTooManySegments 表示请求路径的段数超过 MaxSegments
+	ReasonTooManySegments
+	// ReasonRejected 表示请求匹配到路由，但被路由的守卫拒绝
+	ReasonRejected
+	// ReasonInvalidBody 表示请求体无法解析（例如 POSTJSON）
+	ReasonInvalidBody
+	// ReasonMiddleware 表示请求被本包提供的中间件拒绝，例如限流、超时或请求体过大
+	ReasonMiddleware
+)
+
+var errorReasonNames = [...]string{
+	ReasonOther:            "other",
+	ReasonNotFound:         "not found",
+	ReasonTrailingSlash:    "trailing slash",
+	ReasonMethodNotAllowed: "method not allowed",
+	ReasonUnknownMethod:    "unknown method",
+	ReasonPanic:            "panic",
+	ReasonStaticMiss:       "static miss",
+	ReasonStaticError:      "static error",
+	ReasonDraining:         "draining",
+	ReasonTooManySegments:  "too many segments",
+	ReasonRejected:         "rejected",
+	ReasonInvalidBody:      "invalid body",
+	ReasonMiddleware:       "middleware",
+}
+
+// String 返回原因的简短描述，便于记录日志或作为指标的标签。
+func (reason ErrorReason) String() string {
+	if reason >= 0 && int(reason) < len(errorReasonNames) {
+		return errorReasonNames[reason]
+	}
+	return "ErrorReason(" + strconv.Itoa(int(reason)) + ")"
+}
+
+// ErrorHandlerFuncExt 与 ErrorHandlerFunc 相同，但额外接收错误的原因，见 SetErrorHandlerExt。
+type ErrorHandlerFuncExt func(w http.ResponseWriter, r *http.Request, statusCode int, reason ErrorReason)
+
 // defaultErrorHandler 是一个默认的 ErrorHandlerFunc 实现。
 // 它简单地使用 http.Error 来发送带有状态码和相应文本的响应。
 func defaultErrorHandler(w http.ResponseWriter, r *http.Request, statusCode int) {
@@ -167,33 +264,107 @@ func defaultErrorHandler(w http.ResponseWriter, r *http.Request, statusCode int)
 
 // Router 是一个 http.Handler，可用于通过可配置的路由将请求分派到不同的处理程序函数。
 type Router struct {
-	trees map[string]*node
+	// routes 是路由注册的目标路由表，通常与当前生效的路由表相同，Swap 期间则是正在构建的新路由表
+	routes *routeTable
+
+	// table 是当前生效的路由表，请求期间只通过它读取路由
+	table atomic.Pointer[routeTable]
 
-	paramsPool sync.Pool
-	maxParams  uint16
+	// swapMu 使 Swap、HandleBatch 以及开始处理请求之后的路由注册依次执行
+	swapMu sync.Mutex
+
+	// serving 表示路由器已经开始处理请求，此后的路由注册以写时复制的方式进行，见 HandleBatch
+	serving atomic.Bool
+
+	// batching 表示正在执行 Swap 或 HandleBatch，期间的注册直接写入正在构建的路由表
+	batching atomic.Bool
+
+	// batchMu 保护 Swap 与 HandleBatch 期间对正在构建的路由表的写入，
+	// build 中的注册与其他 goroutine 的注册因此不会并发修改它
+	batchMu sync.Mutex
+
+	// paramsAllocs 统计 Params 池未命中（新分配 Params）的次数，见 AllocStats
+	paramsAllocs atomic.Uint64
 
 	// Middlewares 是应用于所有请求的全局中间件列表。
 	// 中间件按照在 Use 方法中添加的顺序执行。
 	Middlewares []Middleware
 
+	// PostMatchMiddlewares 是在路由匹配成功之后、调用处理程序之前执行的中间件列表，见 UsePostMatch。
+	PostMatchMiddlewares []Middleware
+
+	// 如果启用，路由器在调用匹配到的处理程序之前将路由模式放入请求上下文，可通过 MatchedPatternFromContext 获取。
+	// 与 SaveMatchedRoutePath 不同，它不包装处理程序，也不占用 Params：
+	// 路由模式在注册时记录在 trie 树中，匹配后直接读取。
+	// 对启用之前注册的路由同样生效。
+	StoreRoutePattern bool
+
+	// AlwaysStoreParams 如果启用，路由器为没有参数的路由同样在请求上下文中存放 Params（空的非 nil 切片），
+	// 使 ParamsFromContext 对所有匹配到的路由都返回非 nil 的值，
+	// 方便总是从上下文读取参数的中间件（例如为 chi 等框架编写的中间件）区分“没有参数”与“没有经过路由”。
+	// 代价是每个没有参数的请求多一次上下文与请求的复制（少量的内存分配）。
+	// 默认情况下只有带参数的路由才会存放 Params。
+	AlwaysStoreParams bool
+
 	// 如果启用，在调用处理程序之前将匹配的路由路径添加到 http.Request 上下文。
 	// 匹配的路由路径只添加到启用此选项时注册的路由处理程序。
 	SaveMatchedRoutePath bool
 
 	// 如果当前路由无法匹配，但存在带（或不带）尾部斜杠的路径处理程序，则启用自动重定向。
 	// 例如，如果请求 /foo/ 但只存在 /foo 的路由，则客户端将被重定向到 /foo，
-	// 对于 GET 请求使用 http 状态码 301，对于所有其他请求方法使用 308。
+	// 对于 GET 请求默认使用 http 状态码 301，对于所有其他请求方法使用 308（见 RedirectStatusGET）。
 	RedirectTrailingSlash bool
 
+	// MergeTrailingSlash 如果启用，只差尾部斜杠的请求直接由注册的路由处理，不再重定向：
+	// 例如只注册了 /foo 时，/foo/ 同样调用 /foo 的处理程序（反之亦然），省去一次往返，
+	// 也避免某些客户端在重定向后丢失 POST 请求体。它优先于 RedirectTrailingSlash，
+	// 并同样用于 405 的 Allow 头部与 RedirectPath 的判断。
+	// 请求的 URL 保持不变，Params 与直接请求注册路径时相同，
+	// SaveMatchedRoutePath 与 MatchedPatternFromContext 记录的是注册的路由模式。
+	MergeTrailingSlash bool
+
 	// 如果启用，路由器会尝试修复当前请求路径，如果没有为其注册处理程序。
 	// 首先，会移除诸如 ../ 或 // 等多余的路径元素。
 	// 然后，路由器会对清理后的路径进行不区分大小写的查找。
-	// 如果找到了该路由的处理程序，路由器会以状态码 301（GET 请求）和 308（所有其他请求方法）
+	// 如果找到了该路由的处理程序，路由器会以状态码 301（GET 请求）和 308（所有其他请求方法，见 RedirectStatusGET）
 	// 重定向到修正后的路径。
 	// 例如，/FOO 和 /..//Foo 可以被重定向到 /foo。
 	// RedirectTrailingSlash 与此选项无关。
 	RedirectFixedPath bool
 
+	// CaseInsensitive 如果启用，路由匹配不区分大小写：路由模式与请求路径的静态部分都转换为小写后再进行匹配，
+	// 例如 "/Users/:ID" 直接处理 "/users/42" 与 "/USERS/42"，不需要 RedirectFixedPath 的重定向往返
+	// （启用本选项时 RedirectFixedPath 只在清理路径时才有作用）。
+	// 参数名与约束保持不变，参数值（以及约束检查的值）保持请求中的原始大小写，例如 ps.ByName("ID") 为 "42"。
+	// 只转换编码长度不变的大小写映射，这包括 ASCII 字母与绝大多数 Unicode 字母。
+	// 必须在注册路由之前设置：路由树中保存的是转换后的模式，因此 Routes 等列出的是小写形式，
+	// 只有大小写不同的两个模式（例如 "/Users" 与 "/users"）视为同一个路由，重复注册会 panic。
+	CaseInsensitive bool
+
+	// DecodeParams 如果启用，路由匹配使用请求的原始编码路径（URL.EscapedPath），
+	// 然后对每个参数值进行 URL 解码：例如 "/files/:name" 匹配 "/files/my%2Ffile" 时，
+	// %2F 不会分隔路径段，ps.ByName("name") 为 "my/file"；"/files/my%20file" 得到 "my file"。
+	// 未启用时匹配使用已解码的 URL.Path，"/files/my%2Ffile" 视为两个路径段。
+	// 注册的静态部分按编码后的形式比较，包含需要编码的字符（例如空格）的路由模式应写成编码形式。
+	// 全匹配参数同样被解码；尾部斜杠与路径修正的重定向保留原始编码，DefaultPathParam 仍使用 URL.Path。
+	// 此时 RedirectPath 与 Explain 的 path 参数也应使用编码形式。
+	DecodeParams bool
+
+	// RedirectNonIdempotent 控制 RedirectTrailingSlash 与 RedirectFixedPath 是否也重定向
+	// GET 与 HEAD 之外的请求（POST、PUT、PATCH、DELETE 等，使用 308）。
+	// 一些较旧的客户端在收到 308 后不会重新发送请求体，禁用此选项后，
+	// 这些请求不会被重定向，而是按未匹配到路由处理（NotFound，或在适用时回复 405），
+	// GET 与 HEAD 请求仍然照常重定向。New 返回的路由器默认启用（保持原有行为）。
+	RedirectNonIdempotent bool
+
+	// RedirectStatusGET 与 RedirectStatusOther 是 RedirectTrailingSlash 与 RedirectFixedPath 重定向使用的状态码，
+	// 分别用于 GET 请求与其他请求。New 返回的路由器默认为 301 与 308；
+	// 例如迁移期间可以改为 302 与 307，避免客户端长期缓存 301。
+	// 应当通过 SetRedirectStatus 设置，它会检查状态码是否为 3xx；
+	// 直接赋值为 0 或 3xx 之外的值时使用默认值。
+	RedirectStatusGET   int
+	RedirectStatusOther int
+
 	// 如果启用，当当前请求无法路由时，路由器会检查是否允许使用其他方法。
 	// 如果是这种情况，请求会以“不允许使用的方法”和 HTTP 状态码 405 进行响应。
 	// 如果没有允许的其他方法，则将请求委托给 NotFound 处理程序。
@@ -203,13 +374,24 @@ type Router struct {
 	// 自定义 OPTIONS 处理程序优先于自动回复。
 	HandleOPTIONS bool
 
+	// 如果启用，注册 GET 路由时会在同一路径自动注册 HEAD 路由（与 Route.WithHEAD 相同）：
+	// HEAD 请求执行 GET 路由的完整处理链，响应头部与状态码保持不变，响应体被丢弃；
+	// 处理函数没有设置 Content-Length 时按 GET 响应体的长度补充，与 http.ServeContent 对 HEAD 请求的处理一致。
+	// 显式注册的 HEAD 路由始终优先：GET 之前注册的不会被覆盖，GET 之后注册的会取代自动生成的路由。
+	// 只对启用之后注册的 GET 路由生效。
+	AutoHead bool
+
 	// 一个可选的 http.Handler，在自动 OPTIONS 请求时调用。
 	// 只有当 HandleOPTIONS 为 true 且未设置特定路径的 OPTIONS 处理程序时，才会调用此处理程序。
 	// 在调用处理程序之前会设置 "Allowed" 头部。
 	GlobalOPTIONS http.Handler
 
-	// 全局 (*) 允许方法的缓存值
-	globalAllowed string
+	// 如果启用，自动 OPTIONS 回复会在该路径已注册路由的组/路由级中间件链中执行，
+	// 使挂在真实处理程序上的中间件（例如设置 CORS 头部的中间件）也能处理预检请求。
+	// 当路径为多个方法注册了路由时，使用 Allow 列表中排序第一的方法对应路由的中间件链。
+	// 注意：该链中的所有中间件（包括鉴权等）都会对 OPTIONS 请求执行。
+	// 全局中间件（Use）始终包裹自动 OPTIONS 回复，与此选项无关。
+	OPTIONSRouteMiddleware bool
 
 	// 可配置的 http.Handler，当找不到匹配的路由时调用。
 	// 如果未设置，则使用 http.NotFound。
@@ -224,6 +406,8 @@ type Router struct {
 	// 如果设置，当 panic 发生并被恢复时，会调用此函数。
 	// 它接收原始的 ResponseWriter、Request 和 panic 的值 (interface{})。
 	// 如果未设置，则 panic 会继续传播（回到 net/http 的 ServeHTTP，可能导致连接关闭）。
+	// 升级请求（例如 WebSocket）的处理程序接管（Hijack）连接之后发生 panic 时，路由器不再写入任何回复，
+	// RecoveryHandler 只用于记录，它写入的内容会被丢弃。
 	RecoveryHandler RecoveryHandlerFunc
 
 	// FileSystemForUnmatched 用于在没有匹配到预定义路由时服务静态文件。
@@ -234,12 +418,176 @@ type Router struct {
 	// 使用 FileSystemForUnmatched 指定的文件系统。
 	ServeUnmatchedAsStatic bool
 
+	// UnmatchedStaticFilter 如果设置，启用 ServeUnmatchedAsStatic 时只有它返回 true 的请求才尝试作为静态文件处理，
+	// 其余请求直接交给默认路由或 NotFound，不访问文件系统，例如只为 /static/ 之下的路径查找文件，
+	// 避免 API 的 404 产生磁盘查找。它在访问文件系统之前调用，nil 表示尝试所有未匹配的请求。
+	UnmatchedStaticFilter func(*http.Request) bool
+
+	// StaticContextAware 如果启用，静态文件服务（ServeFiles、ServeFileSystems、StaticFile 与未匹配路由的静态文件处理）
+	// 在每次读取文件之前检查请求上下文，客户端断开连接或请求被取消后立即中止传输，
+	// 而不是等到写入连接失败。启用后无法使用 sendfile 等零拷贝传输。
+	StaticContextAware bool
+
+	// EmitServerTiming 如果启用，会在响应中追加 Server-Timing 头部，
+	// 报告路由匹配 (route) 与处理程序 (handler) 的耗时（毫秒）。
+	// 如果响应在处理程序返回前已经开始写出，handler 耗时统计到首次写出头部为止；
+	// 如果外层中间件已经写出了响应，则该头部会被忽略，不影响正常响应。
+	// 默认关闭。
+	EmitServerTiming bool
+
+	// UnknownMethodStatus 指定路由器如何回复使用了未注册任何路由的方法（例如自造的动词）的请求：
+	//   - 0（默认）：保持原有行为，根据路径是否存在于其他方法返回 405 或 404；
+	//   - http.StatusNotFound：总是交由 NotFound 处理；
+	//   - http.StatusMethodNotAllowed：总是回复 405，Allow 头部列出该路径（或整个服务器）允许的方法；
+	//   - http.StatusNotImplemented：回复 501 Not Implemented（经由错误处理器）。
+	// 在 HandleOPTIONS 启用时，OPTIONS 请求不受此选项影响。
+	UnknownMethodStatus int
+
+	// MethodOverrideHeader 如果非空（通常为 "X-HTTP-Method-Override"），POST 请求可以通过该头部
+	// 指定路由使用的方法，供只能发送 GET/POST 的旧客户端与 HTML 表单使用。
+	// 只接受 PUT、PATCH 与 DELETE（忽略大小写），其他值被忽略，请求仍按 POST 路由。
+	// 替换的方法用于路由匹配、405 的 Allow 头部与 UnknownMethodStatus 的判断；
+	// 全局中间件在路由之前执行，看到的是原始请求。
+	MethodOverrideHeader string
+
+	// MethodOverrideRewrite 如果启用，使用 MethodOverrideHeader 替换方法时，
+	// 处理程序收到的请求（的副本）的 Method 也被改写；否则保持为 POST。
+	MethodOverrideRewrite bool
+
+	// FaviconMissingStatus 是 Favicon 注册的路由在图标文件不存在时回复的状态码：
+	// 0 或 http.StatusNoContent 表示回复 204 No Content（使浏览器不再重试，避免 404 日志噪音），
+	// http.StatusNotFound 表示回复 404（经由错误处理器）。
+	FaviconMissingStatus int
+
+	// Validator 是 POSTJSON 在解码请求体之后调用的可选校验函数，参数为指向请求结构体的指针，
+	// 例如基于结构体标签的校验器。返回 ValidationErrors 可以在错误回复中带出字段错误。
+	Validator func(v interface{}) error
+
+	// MaxJSONBodyBytes 是 POSTJSON 读取的请求体的最大字节数，超出时回复 413 Request Entity Too Large。
+	// 0 表示使用默认的 1 MiB，负数表示不限制（例如已经由 MaxBodyBytes 中间件限制时）。
+	MaxJSONBodyBytes int64
+
+	// MaxRequestParams 限制路由可以声明的路径参数数量（包括 catch-all 参数），0 表示不限制。
+	// 请求捕获的参数与匹配到的路由声明的参数一一对应，无论请求路径有多少段都不会更多，
+	// 因此限制在注册时检查：注册参数更多的路由时 panic（TryHandle 返回 ErrInvalidPath）。
+	// 与 SaveMatchedRoutePath 一样，只影响设置之后注册的路由。SaveMatchedRoutePath 添加的参数不计入。
+	MaxRequestParams uint16
+
+	// MaxSegments 限制请求路径的段数（按 '/' 计数），超出时不进行路由查找，
+	// 直接回复 414 URI Too Long（经由错误处理器）。
+	// 与按字节计算的长度限制不同，它防止包含成千上万个斜杠的路径在 trie 遍历中浪费时间。
+	// 0 表示不限制。
+	MaxSegments int
+
+	// OnRegister 是一个可选的回调，在每条路由成功注册之后调用（注册失败发生 panic 时不调用），
+	// 接收注册的方法与完整路径（包含组前缀）。
+	// 通过 Group、ServeFiles、ANY 等方式注册的路由同样会触发它。
+	// 可用于维护外部路由表、记录日志或自动生成文档。
+	OnRegister func(method, path string)
+
+	// AnyMethods 是 ANY（包括 Group.ANY）为路由注册的方法列表，为 nil 时使用 DefaultMethodsForAny。
+	// 它只影响这个路由器，适合在同一进程中使用多个路由器的场景；设置为空列表时调用 ANY 会 panic。
+	AnyMethods []string
+
+	// OnRequest 是一个可选的回调，在 ServeHTTP 开始处理每个请求时（全局中间件之前）调用。
+	OnRequest func(*http.Request)
+
+	// OnResponse 是一个可选的回调，在 ServeHTTP 处理完每个请求之后调用，
+	// 接收请求、回复的状态码、写出的响应体字节数以及处理耗时，用于记录日志或指标，
+	// 而无需为每个路由包裹中间件或 ResponseWriter。
+	// 它覆盖所有的回复：路由处理程序、NotFound、MethodNotAllowed、重定向、错误处理器，
+	// 以及 panic 恢复后的回复（通常为 500）。处理程序没有写出任何内容时状态码为 200，
+	// 连接被处理程序接管（Hijack，例如 WebSocket）时为 101。
+	// 设置后 ServeHTTP 会使用一个记录状态码的 ResponseWriter 包装，未设置时没有额外开销。
+	OnResponse func(req *http.Request, status int, bytes int, dur time.Duration)
+
+	// ParamsContextKeys 是除 ParamsKey 之外额外存放 Params 的上下文键列表。
+	// 用于与期望从其他键读取参数的第三方库互操作。
+	ParamsContextKeys []interface{}
+
+	// ParamsEncoder 是一个可选的函数，在 Params 存入上下文（ParamsKey 及 ParamsContextKeys）之后调用，
+	// 可以返回以任意形式（例如其他路由器的参数格式）附加了参数的新上下文。
+	// 它适用于路由器将 Params 放入上下文的所有位置：ServeHTTP、Handler/HandlerFunc 与 ServeFiles。
+	ParamsEncoder func(ctx context.Context, ps Params) context.Context
+
+	// DefaultHeaders 中的头部在处理每个请求之前（路由匹配之前）写入响应，
+	// 因此同样适用于错误、重定向与 OPTIONS 等由路由器生成的响应。
+	// 适合集中设置 Server、默认 Cache-Control 之类的通用头部，无需编写中间件。
+	// 处理程序可以覆盖它们：之后的 Header().Set 替换默认值，Header().Add 在默认值之后追加，
+	// Header().Del 删除默认值。键应使用规范形式（见 http.CanonicalHeaderKey）。
+	DefaultHeaders http.Header
+
+	// PreHandler 是一个可选的全局“闸门”，在路由匹配之前对每个请求调用。
+	// 它在全局中间件（Use）之内、路由匹配之前执行，是核心路由逻辑的第一步。
+	// 返回 false 表示请求已被处理（PreHandler 应自行写出响应），路由器不再继续；
+	// 返回 true 则继续正常的路由流程。
+	// 适用于维护模式（对所有请求回复 503）之类的简单场景，无需编写中间件。
+	PreHandler func(http.ResponseWriter, *http.Request) bool
+
+	// MisdirectedHostHandling 如果启用，当请求的 Host 与通过 Route.Host 限制的路由不匹配时，
+	// 回复 421 Misdirected Request（经由错误处理器）而不是 404。
+	// 这在 HTTP/2 连接复用（connection coalescing）场景下语义更准确。
+	MisdirectedHostHandling bool
+
+	// DrainAllowedPaths 是停止接收新请求（见 BeginDrain）期间仍然正常处理的路径列表，
+	// 通常是 /healthz 之类的健康检查路径，以便负载均衡器在排空期间仍能探测实例状态。
+	// 路径需要与请求路径完全相等。
+	DrainAllowedPaths []string
+
+	// DrainExempt 是一个可选的函数，在排空期间对不在 DrainAllowedPaths 中的请求调用，
+	// 返回 true 时请求照常处理，例如按路径前缀或请求头部识别负载均衡器的探测请求。
+	// 它只在排空期间调用，不影响正常请求的性能。
+	DrainExempt func(*http.Request) bool
+
+	// RetryAfter 如果大于 0，路由器经由错误处理器回复 503 Service Unavailable 时
+	// （例如排空期间，或 HardTimeout 超时）会设置 Retry-After 头部（秒，向上取整），提示客户端稍后重试。
+	// 如果响应中已经设置了 Retry-After，则保持不变。未设置时，排空期间的回复仍带有 5 秒的 Retry-After。
+	RetryAfter time.Duration
+
+	// MalformedPathHandler 是一个可选的 http.Handler，用于处理路径编码不一致的请求：
+	// 请求 URL 的 RawPath 包含无效的百分号编码，或者解码后与 Path 不一致
+	// （通常来自异常的边缘或爬虫流量，或错误的代理改写）。
+	// 检查在全局中间件之前、针对路由器收到的原始请求进行，中间件之后对 Path 的改写不受影响。
+	// 如果未设置（默认），不做检查，这类请求照常匹配。
+	MalformedPathHandler http.Handler
+
+	// Clock 是一个可选的函数，返回路由器使用的当前时间（例如 Route.Active 的时间窗口判断）。
+	// 未设置时使用 time.Now，测试时可以替换为固定的时钟。
+	Clock func() time.Time
+
+	// TrackClosestMatch 如果启用，在调用 NotFound 处理程序之前，
+	// 路由器会在请求方法的路由树中查找请求路径能够匹配到的最长前缀，
+	// 并放入请求上下文，可通过 ClosestMatchFromContext 获取，用于给出“您是否要访问 /users？”之类的提示。
+	// 只有在请求未匹配到路由且设置了 NotFound 时才会额外遍历一次路由树，不影响正常请求的性能。
+	TrackClosestMatch bool
+
+	// defaultHandle 与 defaultHandles 是通过 Default 与 DefaultMethod 设置的默认路由
+	defaultHandle  Handle
+	defaultHandles map[string]Handle
+
+	// draining 标记路由器是否正在排空、停止接收新请求，见 BeginDrain
+	draining atomic.Bool
+
+	// inFlight 是当前正在处理的请求数量
+	inFlight atomic.Int64
+
 	// ErrorHandler 是一个统一的错误处理函数。
 	// 当 NotFound 或 MethodNotAllowed 为 nil 时，或者在 panic 恢复且 RecoveryHandler 为 nil 时，
 	// 此函数将被调用来处理错误。
 	// 默认为 defaultErrorHandler，它使用 http.Error。
 	errorHandler              ErrorHandlerFunc
 	isDefaultErrorHandlerUsed bool
+
+	// errorHandlers 是按状态码注册的错误处理函数，优先于 errorHandler
+	errorHandlers map[int]ErrorHandlerFunc
+
+	// errorHandlerExt 是通过 SetErrorHandlerExt 设置的接收错误原因的错误处理函数，优先于 errorHandler
+	errorHandlerExt ErrorHandlerFuncExt
+
+	// groupErrorHandlers 是通过 Group.SetErrorHandler 为组设置的错误处理函数，键为组前缀在 trie 树中的形式，
+	// groupErrorTree 是由这些前缀按路径段组成的树，用于找出包含请求路径的最内层的组，见 groupErrorHandlerFor
+	groupErrorHandlers map[string]ErrorHandlerFunc
+	groupErrorTree     *groupErrorNode
 }
 
 // 确保 Router 符合 http.Handler 接口
@@ -251,6 +599,9 @@ func New() *Router {
 	r := &Router{
 		RedirectTrailingSlash:  true,
 		RedirectFixedPath:      true,
+		RedirectNonIdempotent:  true,
+		RedirectStatusGET:      http.StatusMovedPermanently,
+		RedirectStatusOther:    http.StatusPermanentRedirect,
 		HandleMethodNotAllowed: true,
 		HandleOPTIONS:          true,
 		Middlewares:            make([]Middleware, 0),
@@ -259,6 +610,33 @@ func New() *Router {
 	return r
 }
 
+// SetRedirectStatus 设置 RedirectStatusGET 与 RedirectStatusOther，任一状态码不是 3xx 时 panic。
+func (r *Router) SetRedirectStatus(get, other int) {
+	if !isRedirectStatus(get) || !isRedirectStatus(other) {
+		panic(fmt.Sprintf("redirect status codes must be 3xx, got %d and %d", get, other))
+	}
+	r.RedirectStatusGET = get
+	r.RedirectStatusOther = other
+}
+
+func isRedirectStatus(code int) bool {
+	return code >= 300 && code < 400
+}
+
+// redirectStatus 返回重定向 method 请求使用的状态码，见 RedirectStatusGET 与 RedirectStatusOther。
+func (r *Router) redirectStatus(method string) int {
+	if method == http.MethodGet {
+		if isRedirectStatus(r.RedirectStatusGET) {
+			return r.RedirectStatusGET
+		}
+		return http.StatusMovedPermanently
+	}
+	if isRedirectStatus(r.RedirectStatusOther) {
+		return r.RedirectStatusOther
+	}
+	return http.StatusPermanentRedirect
+}
+
 // setDefaultErrorHandler 将路由器的错误处理器设置为默认实现。
 func (r *Router) setDefaultErrorHandler() {
 	r.errorHandler = defaultErrorHandler
@@ -276,6 +654,30 @@ func (r *Router) SetErrorHandler(handler ErrorHandlerFunc) {
 	}
 }
 
+// SetErrorHandlerFor 为指定的状态码注册错误处理函数。
+// 路由器产生该状态码的错误时优先使用它，未注册的状态码回退到通用的错误处理函数（SetErrorHandler）。
+// 传入 nil 会移除该状态码的处理函数。
+// 按状态码注册的处理函数不影响 IsUsingDefaultErrorHandler 的结果，后者只反映通用的错误处理函数。
+func (r *Router) SetErrorHandlerFor(statusCode int, handler ErrorHandlerFunc) {
+	if handler == nil {
+		delete(r.errorHandlers, statusCode)
+		return
+	}
+	if r.errorHandlers == nil {
+		r.errorHandlers = make(map[int]ErrorHandlerFunc)
+	}
+	r.errorHandlers[statusCode] = handler
+}
+
+// SetErrorHandlerExt 设置接收错误原因（ErrorReason）的错误处理函数，用于更细致的日志与指标，
+// 例如区分确实不存在的路由、只差尾部斜杠的路径与不存在的静态文件。
+// 设置后它取代 SetErrorHandler 设置的通用错误处理函数；按状态码注册的处理函数（SetErrorHandlerFor）
+// 与组的错误处理函数（Group.SetErrorHandler）仍然优先。传入 nil 会移除它，恢复使用通用的错误处理函数。
+// NotFound 与 MethodNotAllowed 处理程序设置时同样优先于它。
+func (r *Router) SetErrorHandlerExt(handler ErrorHandlerFuncExt) {
+	r.errorHandlerExt = handler
+}
+
 // GetErrorHandler 返回当前配置的错误处理函数。
 // 注意：直接比较返回的函数与 defaultErrorHandler 可能不可靠。
 // 请使用 Router.IsUsingDefaultErrorHandler() 来检查是否正在使用默认处理器。
@@ -293,11 +695,346 @@ func (r *Router) IsUsingDefaultErrorHandler() bool {
 	return r.isDefaultErrorHandlerUsed
 }
 
+// BeginDrain 开始排空：路由器对新请求回复 503 Service Unavailable（经由错误处理器，
+// 带有 Retry-After 头部，见 RetryAfter），已经在处理中的请求不受影响，会正常完成。
+// 排空的判断在全局中间件与 PreHandler 之前进行，被拒绝的请求不会经过它们。
+// DrainAllowedPaths 中的路径以及 DrainExempt 返回 true 的请求不受影响。
+// 这适用于滚动部署：在关闭监听器之前先停止接收新的工作，
+// 可以配合 InFlight 等待处理中的请求全部完成。
+// 正常请求只需一次原子读取即可判断是否处于排空状态。
+func (r *Router) BeginDrain() {
+	r.draining.Store(true)
+}
+
+// EndDrain 结束排空，路由器重新开始正常处理新请求。
+func (r *Router) EndDrain() {
+	r.draining.Store(false)
+}
+
+// StopAccepting 与 BeginDrain 相同。
+func (r *Router) StopAccepting() {
+	r.BeginDrain()
+}
+
+// ResumeAccepting 与 EndDrain 相同。
+func (r *Router) ResumeAccepting() {
+	r.EndDrain()
+}
+
+// IsAccepting 返回路由器当前是否正常接收新请求。
+func (r *Router) IsAccepting() bool {
+	return !r.draining.Load()
+}
+
+// InFlight 返回当前正在由路由器处理的请求数量。
+func (r *Router) InFlight() int64 {
+	return r.inFlight.Load()
+}
+
+// now 返回 Clock 提供的当前时间，未设置 Clock 时使用 time.Now。
+func (r *Router) now() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
+}
+
+// malformedPath 报告 URL 的 RawPath 是否包含无效的百分号编码或与 Path 不一致。
+// RawPath 为空（最常见的情况）时 Path 就是唯一的路径形式，无需检查。
+func malformedPath(u *url.URL) bool {
+	if u.RawPath == "" {
+		return false
+	}
+	p, err := url.PathUnescape(u.RawPath)
+	return err != nil || p != u.Path
+}
+
+// defaultDrainRetryAfter 是未设置 RetryAfter 时排空回复的 Retry-After。
+const defaultDrainRetryAfter = 5 * time.Second
+
+// serveDraining 以 503 回复排空期间的请求，并像路由处理程序一样从错误处理器的 panic 中恢复。
+// 回复总是带有 Retry-After 头部：未设置 RetryAfter 时使用 defaultDrainRetryAfter。
+func (r *Router) serveDraining(w http.ResponseWriter, req *http.Request) {
+	defer r.recv(w, req)
+	if r.RetryAfter <= 0 && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(defaultDrainRetryAfter/time.Second)))
+	}
+	r.serveError(w, req, http.StatusServiceUnavailable, ReasonDraining)
+}
+
+// serveMalformedPath 调用 MalformedPathHandler，并像路由处理程序一样从 panic 中恢复。
+func (r *Router) serveMalformedPath(w http.ResponseWriter, req *http.Request) {
+	defer r.recv(w, req)
+	r.MalformedPathHandler.ServeHTTP(w, req)
+}
+
+// treePattern 返回路由模式在 trie 树中的形式：启用 CaseInsensitive 时静态部分转换为小写。
+func (r *Router) treePattern(path string) string {
+	if r.CaseInsensitive {
+		return foldPattern(path)
+	}
+	return path
+}
+
+// routePath 返回用于在 trie 树中查找的请求路径，见 CaseInsensitive。
+func (r *Router) routePath(path string) string {
+	if r.CaseInsensitive {
+		return foldCase(path)
+	}
+	return path
+}
+
+// decodeParams 就地对参数值进行 URL 解码（DecodeParams），跳过 MatchedRoutePathParam。
+// EscapedPath 总是有效的编码，解码失败时保留原始值。
+func decodeParams(ps Params) {
+	for i := range ps {
+		if ps[i].Key == MatchedRoutePathParam || !strings.Contains(ps[i].Value, "%") {
+			continue
+		}
+		if v, err := url.PathUnescape(ps[i].Value); err == nil {
+			ps[i].Value = v
+		}
+	}
+}
+
+// drainAllowed 返回在停止接收新请求期间是否仍应处理该路径（DrainAllowedPaths）。
+func (r *Router) drainAllowed(path string) bool {
+	for _, p := range r.DrainAllowedPaths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// serveError 使用配置的错误处理器回复给定的错误状态码，reason 是错误的原因。
+// 组的错误处理函数与按状态码注册的处理函数优先于通用的错误处理函数。
+func (r *Router) serveError(w http.ResponseWriter, req *http.Request, statusCode int, reason ErrorReason) {
+	if statusCode == http.StatusServiceUnavailable && r.RetryAfter > 0 && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(r.RetryAfter.Seconds()))))
+	}
+	if h := r.groupErrorHandlerFor(req); h != nil {
+		h(w, req, statusCode)
+	} else if h, ok := r.errorHandlers[statusCode]; ok {
+		h(w, req, statusCode)
+	} else if r.errorHandlerExt != nil {
+		r.errorHandlerExt(w, req, statusCode, reason)
+	} else if r.errorHandler != nil {
+		r.errorHandler(w, req, statusCode)
+	} else {
+		defaultErrorHandler(w, req, statusCode)
+	}
+}
+
+// groupErrorHandlerFor 返回处理 req 的错误时使用的组错误处理函数，没有时返回 nil：
+// req 匹配到通过组注册的路由时，使用该组（或设置了处理函数的最内层的上级组）的处理函数，
+// 匹配到直接在路由器上注册的路由时不使用组的处理函数；
+// 没有匹配到路由时，使用前缀包含请求路径的最内层的组的处理函数。
+func (r *Router) groupErrorHandlerFor(req *http.Request) ErrorHandlerFunc {
+	if len(r.groupErrorHandlers) == 0 {
+		return nil
+	}
+	t := r.liveTable()
+	method := r.routeMethod(req)
+	path := req.URL.Path
+	if r.DecodeParams {
+		path = req.URL.EscapedPath()
+	}
+	routePath := r.routePath(path)
+	if root := t.trees[method]; root != nil {
+		pattern := root.matchedFoldedPattern(routePath, path)
+		if pattern == "" && r.MergeTrailingSlash {
+			pattern = root.matchedFoldedPattern(toggleTrailingSlash(routePath), toggleTrailingSlash(path))
+		}
+		if pattern != "" {
+			prefix, ok := t.groupPrefixes[method+" "+pattern]
+			if !ok {
+				return nil
+			}
+			routePath = r.treePattern(prefix)
+		}
+	}
+	return r.groupErrorTree.lookup(routePath)
+}
+
+// groupErrorNode 是组错误处理函数的前缀树中的一个节点，对应组前缀的一个路径段。
+// 与路由的 trie 树不同，同一位置的静态段与参数段可以共存，因为不同方法的路由可以分别使用它们。
+type groupErrorNode struct {
+	handler ErrorHandlerFunc
+
+	static map[string]*groupErrorNode
+	params []*groupErrorNode
+
+	// 参数段的原始文本（例如 ":id(\d+)"）与编译后的约束，catchAll 表示 catch-all 段
+	segment    string
+	constraint *regexp.Regexp
+	catchAll   bool
+}
+
+// insert 为组前缀 prefix 设置错误处理函数。
+func (n *groupErrorNode) insert(prefix string, handler ErrorHandlerFunc) {
+	for prefix != "/" && prefix != "" {
+		var seg string
+		seg, prefix = cutSegment(prefix[1:])
+		n = n.child(seg)
+	}
+	n.handler = handler
+}
+
+// child 返回路径段 seg 对应的子节点，不存在时创建。
+func (n *groupErrorNode) child(seg string) *groupErrorNode {
+	if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+		if n.static == nil {
+			n.static = make(map[string]*groupErrorNode)
+		}
+		c := n.static[seg]
+		if c == nil {
+			c = new(groupErrorNode)
+			n.static[seg] = c
+		}
+		return c
+	}
+	for _, c := range n.params {
+		if c.segment == seg {
+			return c
+		}
+	}
+	c := &groupErrorNode{segment: seg, catchAll: seg[0] == '*'}
+	if _, constraint := splitParam(seg); constraint != "" && !c.catchAll {
+		c.constraint = regexp.MustCompile("^(?:" + constraint + ")$")
+	}
+	n.params = append(n.params, c)
+	return c
+}
+
+// lookup 返回包含 path 的最内层的组的错误处理函数，没有时返回 nil。
+// 静态段优先于参数段；参数段匹配满足约束的任意非空段，catch-all 段匹配剩余的全部路径。
+func (n *groupErrorNode) lookup(path string) ErrorHandlerFunc {
+	if n.catchAll || path == "" || path == "/" {
+		return n.handler
+	}
+	seg, rest := cutSegment(path[1:])
+	if c := n.static[seg]; c != nil {
+		if h := c.lookup(rest); h != nil {
+			return h
+		}
+	}
+	for _, c := range n.params {
+		// 匹配到路由时查找的是组前缀本身，其中的参数段与节点的原文相同
+		if c.catchAll || c.segment == seg || (seg != "" && (c.constraint == nil || c.constraint.MatchString(seg))) {
+			if h := c.lookup(rest); h != nil {
+				return h
+			}
+		}
+	}
+	return n.handler
+}
+
+// cutSegment 返回 s 中第一个 '/' 之前的部分，以及从该 '/' 开始的剩余部分。
+func cutSegment(s string) (segment, rest string) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// withParams 返回存放了 Params 的新上下文。
+// Params 总是存放在 ParamsKey 下，以保证 ParamsFromContext 可用，
+// 随后按 ParamsContextKeys 与 ParamsEncoder 的配置进行额外的存放。
+// 如果路由器是通过 MountRouter 挂载的子路由器，外层捕获的参数会合并进来。
+func (r *Router) withParams(ctx context.Context, ps Params) context.Context {
+	ps = mergeMountParams(ctx, ps)
+	ctx = context.WithValue(ctx, ParamsKey, ps)
+	for _, key := range r.ParamsContextKeys {
+		ctx = context.WithValue(ctx, key, ps)
+	}
+	if r.ParamsEncoder != nil {
+		ctx = r.ParamsEncoder(ctx, ps)
+	}
+	return ctx
+}
+
+// serveNotFound 使用 NotFound 处理程序（如果设置）或错误处理器回复 404，reason 是错误的原因。
+func (r *Router) serveNotFound(w http.ResponseWriter, req *http.Request, reason ErrorReason) {
+	if r.NotFound != nil && r.groupErrorHandlerFor(req) == nil {
+		if r.TrackClosestMatch {
+			var closest string
+			if root := r.liveTable().trees[r.routeMethod(req)]; root != nil {
+				// 折叠大小写不改变长度，按长度取回原始路径的前缀
+				closest = req.URL.Path[:len(root.closestMatch(r.routePath(req.URL.Path)))]
+			}
+			req = req.WithContext(context.WithValue(req.Context(), closestMatchKey{}, closest))
+		}
+		r.NotFound.ServeHTTP(w, req)
+	} else {
+		r.serveError(w, req, http.StatusNotFound, reason)
+	}
+}
+
+type allowedMethodsKey struct{}
+
+// AllowedMethodsFromContext 返回 405 回复或自动 OPTIONS 回复中允许的方法列表，
+// 顺序与 Allow 头部一致（已排序，HandleOPTIONS 启用时包含 OPTIONS），无需再拆分头部。
+// 路由器在调用 MethodNotAllowed 处理程序或错误处理器回复 405 之前、以及调用 GlobalOPTIONS 之前将其放入请求上下文，
+// 便于处理程序在响应体中给出允许的方法；其他情况下返回 nil。
+func AllowedMethodsFromContext(ctx context.Context) []string {
+	allowed, _ := ctx.Value(allowedMethodsKey{}).([]string)
+	return allowed
+}
+
+// withAllowedMethods 将 Allow 头部的方法列表放入请求上下文，见 AllowedMethodsFromContext。
+func withAllowedMethods(req *http.Request, allow string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), allowedMethodsKey{}, strings.Split(allow, ", ")))
+}
+
+// tooManySegments 报告 path 中的段数是否超过 max，计数超过 max 后立即返回。
+func tooManySegments(path string, max int) bool {
+	n := 0
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' {
+			if n++; n > max {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveMethodNotAllowed 设置 Allow 头部，并使用 MethodNotAllowed 处理程序（如果设置）或错误处理器回复 405。
+func (r *Router) serveMethodNotAllowed(w http.ResponseWriter, req *http.Request, allow string) {
+	if allow != "" {
+		w.Header().Set("Allow", allow)
+		req = withAllowedMethods(req, allow)
+	}
+	if r.MethodNotAllowed != nil && r.groupErrorHandlerFor(req) == nil {
+		r.MethodNotAllowed.ServeHTTP(w, req)
+	} else {
+		r.serveError(w, req, http.StatusMethodNotAllowed, ReasonMethodNotAllowed)
+	}
+}
+
+// reject 以给定的状态码拒绝一个已匹配到路由的请求。
+// 404 与未匹配到路由时的处理方式相同。
+func (r *Router) reject(w http.ResponseWriter, req *http.Request, statusCode int) {
+	if statusCode == http.StatusNotFound {
+		r.serveNotFound(w, req, ReasonRejected)
+		return
+	}
+	r.serveError(w, req, statusCode, ReasonRejected)
+}
+
 // Group 代表一个路由组，具有一个路径前缀。
 type Group struct {
 	router      *Router      // 指向主 Router
 	prefix      string       // 该组的路径前缀
 	middlewares []Middleware // group级中间件
+	values      []groupValue // 通过 WithValue 附加到组的上下文值
+	implicit    bool         // 由 Router 的方法内部创建、代表路由器本身的根组，其路由不记为通过组注册
+}
+
+// groupValue 是通过 Group.WithValue 附加的一个上下文值
+type groupValue struct {
+	key, value interface{}
 }
 
 // Group 创建一个新的路由组，所有通过该组注册的路由都将带有给定的路径前缀。
@@ -326,19 +1063,7 @@ func (r *Router) Group(prefix string) *Group {
 	}
 }
 
-func (r *Router) getParams() *Params {
-	ps, _ := r.paramsPool.Get().(*Params)
-	*ps = (*ps)[0:0] // 重置切片
-	return ps
-}
-
-func (r *Router) putParams(ps *Params) {
-	if ps != nil {
-		r.paramsPool.Put(ps)
-	}
-}
-
-func (r *Router) saveMatchedRoutePath(path string, handle Handle) Handle {
+func (r *Router) saveMatchedRoutePath(t *routeTable, path string, handle Handle) Handle {
 	return func(w http.ResponseWriter, req *http.Request, ps Params) {
 		// 确保即使 ps 为 nil（例如，没有路径参数的路由但启用了 SaveMatchedRoutePath），
 		// 我们也能正确处理。
@@ -346,7 +1071,7 @@ func (r *Router) saveMatchedRoutePath(path string, handle Handle) Handle {
 		var psp *Params // 用于回收
 
 		if ps == nil {
-			psp = r.getParams()       // 从池中获取一个新的 *Params
+			psp = t.getParams()       // 从池中获取一个新的 *Params
 			*psp = (*psp)[:cap(*psp)] // 扩展到底层数组的容量，确保有空间
 			if cap(*psp) == 0 {       // 如果池返回的是一个零容量的切片
 				temp := make(Params, 1)
@@ -370,9 +1095,9 @@ func (r *Router) saveMatchedRoutePath(path string, handle Handle) Handle {
 		handle(w, req, paramsToUse)
 
 		if psp != nil { // 如果我们从池中分配了新的 *Params，则将其放回
-			r.putParams(psp)
+			t.putParams(psp)
 		}
-		// 注意：原始的 ps (如果非 nil) 会由 ServeHTTP 中的 defer r.putParams(ps) 回收
+		// 注意：原始的 ps (如果非 nil) 会由 ServeHTTP 中的 defer putParams(ps) 回收
 	}
 }
 
@@ -383,21 +1108,35 @@ func (r *Router) Use(middleware ...Middleware) {
 	r.Middlewares = append(r.Middlewares, middleware...)
 }
 
+// UsePostMatch 添加一个或多个匹配后中间件。
+// 与 Use 添加的全局中间件不同，它们在路由匹配成功之后才执行，只包裹匹配到的处理程序，
+// 因此可以通过 ParamsFromContext 和 MatchedPatternFromContext 读取参数与路由模式。
+// 未匹配的请求（404、405、重定向、自动 OPTIONS）不会经过它们。
+//
+// 完整的执行顺序为：
+//
+//	Use 中间件 -> 路由匹配 -> UsePostMatch 中间件 -> 组中间件 -> 路由守卫 -> 处理程序
+//
+// 同一阶段内的中间件按照添加的顺序从外向内执行。
+func (r *Router) UsePostMatch(middleware ...Middleware) {
+	r.PostMatchMiddlewares = append(r.PostMatchMiddlewares, middleware...)
+}
+
 // HTTP method shortcuts
-func (r *Router) GET(path string, handle Handle)     { r.Handle(http.MethodGet, path, handle) }
-func (r *Router) HEAD(path string, handle Handle)    { r.Handle(http.MethodHead, path, handle) }
-func (r *Router) OPTIONS(path string, handle Handle) { r.Handle(http.MethodOptions, path, handle) }
-func (r *Router) POST(path string, handle Handle)    { r.Handle(http.MethodPost, path, handle) }
-func (r *Router) PUT(path string, handle Handle)     { r.Handle(http.MethodPut, path, handle) }
-func (r *Router) PATCH(path string, handle Handle)   { r.Handle(http.MethodPatch, path, handle) }
-func (r *Router) DELETE(path string, handle Handle)  { r.Handle(http.MethodDelete, path, handle) }
-func (r *Router) Get(path string, handle Handle)     { r.Handle(http.MethodGet, path, handle) }
-func (r *Router) Head(path string, handle Handle)    { r.Handle(http.MethodHead, path, handle) }
-func (r *Router) Options(path string, handle Handle) { r.Handle(http.MethodOptions, path, handle) }
-func (r *Router) Post(path string, handle Handle)    { r.Handle(http.MethodPost, path, handle) }
-func (r *Router) Put(path string, handle Handle)     { r.Handle(http.MethodPut, path, handle) }
-func (r *Router) Patch(path string, handle Handle)   { r.Handle(http.MethodPatch, path, handle) }
-func (r *Router) Delete(path string, handle Handle)  { r.Handle(http.MethodDelete, path, handle) }
+func (r *Router) GET(path string, h Handle) *Route     { return r.Handle(http.MethodGet, path, h) }
+func (r *Router) HEAD(path string, h Handle) *Route    { return r.Handle(http.MethodHead, path, h) }
+func (r *Router) OPTIONS(path string, h Handle) *Route { return r.Handle(http.MethodOptions, path, h) }
+func (r *Router) POST(path string, h Handle) *Route    { return r.Handle(http.MethodPost, path, h) }
+func (r *Router) PUT(path string, h Handle) *Route     { return r.Handle(http.MethodPut, path, h) }
+func (r *Router) PATCH(path string, h Handle) *Route   { return r.Handle(http.MethodPatch, path, h) }
+func (r *Router) DELETE(path string, h Handle) *Route  { return r.Handle(http.MethodDelete, path, h) }
+func (r *Router) Get(path string, h Handle) *Route     { return r.Handle(http.MethodGet, path, h) }
+func (r *Router) Head(path string, h Handle) *Route    { return r.Handle(http.MethodHead, path, h) }
+func (r *Router) Options(path string, h Handle) *Route { return r.Handle(http.MethodOptions, path, h) }
+func (r *Router) Post(path string, h Handle) *Route    { return r.Handle(http.MethodPost, path, h) }
+func (r *Router) Put(path string, h Handle) *Route     { return r.Handle(http.MethodPut, path, h) }
+func (r *Router) Patch(path string, h Handle) *Route   { return r.Handle(http.MethodPatch, path, h) }
+func (r *Router) Delete(path string, h Handle) *Route  { return r.Handle(http.MethodDelete, path, h) }
 
 /*
 // GET 是 router.Handle(http.MethodGet, path, handle) 的快捷方式
@@ -472,7 +1211,8 @@ func (r *Router) Delete(path string, handle Handle) {
 }
 */
 
-// DefaultMethodsForAny 定义了 ANY 方法将注册的 HTTP 方法列表
+// DefaultMethodsForAny 定义了 ANY 方法默认注册的 HTTP 方法列表，路由器可以通过 AnyMethods 单独配置。
+// 修改它会影响进程中所有未设置 AnyMethods 的路由器，并且不能与注册并发进行。
 var DefaultMethodsForAny = []string{
 	http.MethodGet,
 	http.MethodPost,
@@ -483,12 +1223,126 @@ var DefaultMethodsForAny = []string{
 	http.MethodOptions,
 }
 
-// ANY 为所有 DefaultMethodsForAny 中定义的方法注册相同的处理函数。
+// ANY 为 AnyMethods（未设置时为 DefaultMethodsForAny）中的所有方法注册相同的处理函数。
 // 这对于捕获所有类型的请求到单个端点非常有用。
+// 注册是原子的：如果任何一个方法的注册会发生冲突，则在修改任何 trie 树之前 panic，
+// 不会留下只注册了部分方法的路由。
 func (r *Router) ANY(path string, handle Handle) {
-	for _, method := range DefaultMethodsForAny {
-		r.Handle(method, path, handle)
+	r.Match(r.anyMethods(), path, handle)
+}
+
+// anyMethods 返回 ANY 注册的方法列表，AnyMethods 被设置为空列表时 panic。
+func (r *Router) anyMethods() []string {
+	if r.AnyMethods == nil {
+		return DefaultMethodsForAny
+	}
+	if len(r.AnyMethods) == 0 {
+		panic("AnyMethods must not be empty")
+	}
+	return r.AnyMethods
+}
+
+// Match 为 methods 中列出的每个方法注册相同的处理函数，例如：
+//
+//	router.Match([]string{http.MethodGet, http.MethodPost}, "/search", search)
+//
+// 与 ANY 不同，它只注册给出的方法，Allow 头部（OPTIONS 与 405 回复）也只列出这些方法。
+// 重复的方法只注册一次；methods 为空或包含空的方法名时 panic。
+// 与 ANY 一样，注册是原子的：任何一个方法的注册会发生冲突时，在修改任何 trie 树之前 panic。
+func (r *Router) Match(methods []string, path string, handle Handle) {
+	methods = matchMethods(methods)
+	r.mutate(func() {
+		for _, method := range methods {
+			r.checkRoute(method, path, handle)
+		}
+		for _, method := range methods {
+			r.addRoute(method, path, handle, nil, false)
+		}
+	})
+}
+
+// matchMethods 检查 Match 的方法列表并去除重复的方法。
+func matchMethods(methods []string) []string {
+	if len(methods) == 0 {
+		panic("methods must not be empty")
+	}
+	unique := make([]string, 0, len(methods))
+	for _, method := range methods {
+		if method == "" {
+			panic("method must not be empty")
+		}
+		if !slices.Contains(unique, method) {
+			unique = append(unique, method)
+		}
+	}
+	return unique
+}
+
+// checkRoute 以“试运行”的方式检查注册给定路由是否会 panic（参数无效或与已有路由冲突），
+// 检查在 trie 树的副本上进行，不会修改路由器。与 addRoute 一样，只能在 mutate 中调用。
+func (r *Router) checkRoute(method, path string, handle Handle) {
+	if method == "" {
+		panic("method must not be empty")
+	}
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+
+	root := new(node)
+	if t := r.routes; t != nil {
+		if existing := t.trees[method]; existing != nil {
+			root = existing.clone()
+		}
+	}
+	addPattern(root, r.treePattern(path), path, handle)
+	r.checkParamCount(path)
+}
+
+// checkParamCount 在路由模式声明的参数数量超过 MaxRequestParams 时 panic。
+func (r *Router) checkParamCount(path string) {
+	if n := len(paramNames(path)); r.MaxRequestParams > 0 && n > int(r.MaxRequestParams) {
+		panic("path '" + path + "' declares " + strconv.Itoa(n) + " params, more than MaxRequestParams (" +
+			strconv.Itoa(int(r.MaxRequestParams)) + ")")
+	}
+}
+
+// splitOptionalParam 检查路径的最后一段是否是可选命名参数（例如 "/files/:name?"），
+// 如果是，返回去掉该段的路径 "/files" 与带有必需参数的路径 "/files/:name"。
+// '?' 出现在其他参数上时 panic。
+func splitOptionalParam(path string) (base, full string, ok bool) {
+	i := strings.LastIndexByte(path, '/')
+	for rest := path; ; {
+		wildcard, j, _ := findWildcard(rest)
+		if j < 0 {
+			break
+		}
+		rest = rest[j+len(wildcard):]
+		if strings.HasSuffix(wildcard, "?") && (wildcard[0] != ':' || rest != "" || path[i+1] != ':') {
+			panic("only a named parameter forming the last path segment can be optional in path '" + path + "'")
+		}
+	}
+	if !strings.HasSuffix(path, "?") || path[i+1] != ':' {
+		return "", "", false
+	}
+	base = path[:i]
+	if base == "" {
+		base = "/"
+	}
+	return base, path[:len(path)-1], true
+}
+
+// addPattern 将路由模式 path（trie 树中的形式，见 treePattern）添加到树中，可选参数的两种形式共享同一个处理函数。
+// pattern 是注册时使用的原始路由模式，记录在树中，见 MatchedPatternFromContext。
+func addPattern(root *node, path, pattern string, handle Handle) {
+	if base, full, ok := splitOptionalParam(path); ok {
+		root.addPatternRoute(full, pattern, handle)
+		root.addPatternRoute(base, pattern, handle)
+		return
 	}
+	root.addPatternRoute(path, pattern, handle)
 }
 
 // --- 定义group方式 ---
@@ -554,58 +1408,74 @@ func joinGroupPath(prefix, relativePath string) string {
 }
 
 // Handle 是 Group 的 router.Handle 的快捷方式
-func (g *Group) Handle(method, relativePath string, handle Handle) {
+func (g *Group) Handle(method, relativePath string, handle Handle) *Route {
+	// 调用主 Router 的注册逻辑，组中间件包裹在路由分派之外
+	return g.handle(method, joinGroupPath(g.prefix, relativePath), handle)
+}
+
+// HandleWith 是 Group 的 router.HandleWith 的快捷方式，给出的中间件在组中间件之内执行。
+func (g *Group) HandleWith(method, relativePath string, handle Handle, middleware ...Middleware) *Route {
+	return g.handleWith(method, joinGroupPath(g.prefix, relativePath), handle, append(append([]Middleware(nil), g.chain()...), middleware...))
+}
+
+// handle 以组中间件注册路由，并将其记录为通过组注册的路由。
+func (g *Group) handle(method, fullPath string, handle Handle) *Route {
+	return g.handleWith(method, fullPath, handle, g.chain())
+}
+
+// handleWith 以给出的中间件注册路由，并将其记录为通过组注册的路由；两者一同生效。
+func (g *Group) handleWith(method, fullPath string, handle Handle, middlewares []Middleware) *Route {
+	var rt *Route
+	g.router.mutate(func() {
+		rt = g.addRoute(method, fullPath, handle, middlewares)
+	})
+	return rt
+}
+
+// addRoute 以给出的中间件注册路由并将其记录为通过组注册的路由，与 Router.addRoute 一样只能在 mutate 中调用。
+func (g *Group) addRoute(method, fullPath string, handle Handle, middlewares []Middleware) *Route {
+	rt := g.router.addRoute(method, fullPath, handle, middlewares, false)
+	if !g.implicit {
+		g.router.markGrouped(method, fullPath)
+		g.router.setGroupPrefix(method, fullPath, g.prefix)
+	}
+	return rt
+}
 
-	// 调用主 Router 的 Handle 方法
-	finalHandle := applyGroupMiddlewares(g.middlewares, handle)
-	g.router.Handle(method, joinGroupPath(g.prefix, relativePath), finalHandle)
+// Match 是 Group 的 router.Match 的快捷方式，组中间件包裹在路由分派之外。
+func (g *Group) Match(methods []string, relativePath string, handle Handle) {
+	methods = matchMethods(methods)
+	fullPath := joinGroupPath(g.prefix, relativePath)
+	g.router.mutate(func() {
+		for _, method := range methods {
+			g.router.checkRoute(method, fullPath, handle)
+		}
+		for _, method := range methods {
+			g.addRoute(method, fullPath, handle, g.chain())
+		}
+	})
 }
 
 // Handler 是 Group 的 router.Handler 的快捷方式
-func (g *Group) Handler(method, relativePath string, handler http.Handler) {
+func (g *Group) Handler(method, relativePath string, handler http.Handler) *Route {
 	// 1. 创建一个 httprouter.Handle 来包装原始的 http.Handler
 	//    这个 Handle 的作用是将 router 解析的 Params 放入上下文中。
 	intermediateHandle := func(w http.ResponseWriter, r *http.Request, p Params) {
 		if len(p) > 0 {
 			ctx := r.Context()
-			ctx = context.WithValue(ctx, ParamsKey, p)
+			ctx = g.router.withParams(ctx, p)
 			r = r.WithContext(ctx)
 		}
 		handler.ServeHTTP(w, r)
 	}
 
-	// 2. 应用组中间件到这个 intermediateHandle 上
-	finalHandle := applyGroupMiddlewares(g.middlewares, intermediateHandle)
-
-	// 3. 注册最终的、被组中间件包裹的 Handle
-	g.router.Handle(method, joinGroupPath(g.prefix, relativePath), finalHandle)
+	// 2. 注册这个 Handle，组中间件会被应用在它之外
+	return g.handle(method, joinGroupPath(g.prefix, relativePath), intermediateHandle)
 }
 
 // HandlerFunc 是 Group 的 router.HandlerFunc 的快捷方式
 func (g *Group) HandlerFunc(method, path string, handler http.HandlerFunc) {
-	fullPath := g.prefix
-	if path != "" && path != "/" {
-		if path[0] == '/' {
-			if g.prefix == "/" {
-				fullPath = path
-			} else {
-				fullPath += path
-			}
-		} else {
-			if g.prefix == "/" {
-				fullPath += path
-			} else {
-				fullPath += "/" + path
-			}
-		}
-	} else if path == "/" && g.prefix != "/" {
-		if g.prefix != "/" {
-			fullPath += "/"
-		}
-	} else if path == "" && g.prefix == "/" {
-		fullPath = "/"
-	}
-	g.router.HandlerFunc(method, fullPath, handler)
+	g.handleWith(method, joinGroupPath(g.prefix, path), g.router.handlerHandle(handler), nil)
 }
 
 // ServeFiles 是 Group 的 router.ServeFiles 的快捷方式
@@ -614,104 +1484,351 @@ func (g *Group) ServeFiles(relativePath string, root http.FileSystem) {
 		panic("path for ServeFiles must end with /*filepath in path '" + relativePath + "'")
 	}
 
-	fileServer := http.FileServer(root)
-
-	// 创建一个 httprouter.Handle 来服务文件
-	fileServeHandle := func(w http.ResponseWriter, req *http.Request, ps Params) {
-		originalPath := req.URL.Path
-		req.URL.Path = ps.ByName("filepath") // 从 Params 中获取实际文件路径
-		if len(ps) > 0 {                     // 将 Params 放入上下文，以保持一致性
-			ctx := req.Context()
-			ctx = context.WithValue(ctx, ParamsKey, ps)
-			req = req.WithContext(ctx)
+	// 注册这个 Handle，组中间件会被应用在它之外
+	g.handle(http.MethodGet, joinGroupPath(g.prefix, relativePath), g.router.filesHandle(root))
+}
+
+// SetErrorHandler 为组设置错误处理函数，例如让 /api 之下返回 JSON 格式的错误而站点的其余部分返回 HTML。
+// 通过该组（或其子组）注册的路由产生的错误都交给它处理，包括 405、
+// 处理程序中的 panic（未设置 RecoveryHandler 时）、守卫的拒绝以及静态文件服务的错误；
+// 直接在路由器或其他组上注册的路由即使路径位于组前缀之下也不受影响。
+// 没有匹配到路由的请求（404 与 405），路径位于组前缀之下时同样交给它处理，
+// 前缀中的参数段匹配任意段（满足约束时）。
+// 它优先于路由器的 NotFound、MethodNotAllowed 与 SetErrorHandler/SetErrorHandlerFor 设置的处理函数；
+// 嵌套的组分别设置时，最内层的组生效。
+// 同一前缀的组共享同一个错误处理函数，传入 nil 会移除它，之后回退到上级组或路由器的处理函数。
+// 与 Router.SetErrorHandler 一样，应在开始处理请求之前调用。
+func (g *Group) SetErrorHandler(handler ErrorHandlerFunc) {
+	r := g.router
+	prefix := r.treePattern(g.prefix)
+	if handler == nil {
+		delete(r.groupErrorHandlers, prefix)
+	} else {
+		if r.groupErrorHandlers == nil {
+			r.groupErrorHandlers = make(map[string]ErrorHandlerFunc)
 		}
-		fileServer.ServeHTTP(w, req)
-		req.URL.Path = originalPath // 恢复原始路径
+		r.groupErrorHandlers[prefix] = handler
 	}
 
-	// 应用组中间件到这个 fileServeHandle
-	finalFileServeHandle := applyGroupMiddlewares(g.middlewares, fileServeHandle)
-
-	// 注册这个被包裹的 Handle
-	g.router.Handle(http.MethodGet, joinGroupPath(g.prefix, relativePath), finalFileServeHandle)
+	tree := new(groupErrorNode)
+	for p, h := range r.groupErrorHandlers {
+		tree.insert(p, h)
+	}
+	r.groupErrorTree = tree
 }
 
 func (g *Group) Use(middleware ...Middleware) {
 	g.middlewares = append(g.middlewares, middleware...)
 }
-func (g *Group) GET(relativePath string, handle Handle) {
-	g.Handle(http.MethodGet, relativePath, handle)
-}
-func (g *Group) HEAD(relativePath string, handle Handle) {
-	g.Handle(http.MethodHead, relativePath, handle)
+
+// Group 在当前组之下创建一个子组，子组的前缀是两者拼接后的完整路径，
+// 因此通过子组注册的路由（以及具名路由生成的 URL）包含所有上级组的前缀。
+// 子组继承当前组已添加的中间件（复制而不是共享切片）：请求先经过上级组的中间件，再经过子组自己的中间件；
+// 之后在子组上 Use 的中间件不影响当前组，之后在当前组上 Use 的中间件也不影响已创建的子组。
+func (g *Group) Group(prefix string) *Group {
+	if len(prefix) == 0 || prefix[0] != '/' {
+		panic("group prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	sub := g.router.Group(joinGroupPath(g.prefix, prefix))
+	sub.middlewares = append([]Middleware(nil), g.middlewares...)
+	sub.values = append([]groupValue(nil), g.values...)
+	return sub
 }
-func (g *Group) OPTIONS(relativePath string, handle Handle) {
-	g.Handle(http.MethodOptions, relativePath, handle)
+
+// With 返回当前组的副本，副本在当前组的中间件之后追加 middleware，当前组本身不受影响，
+// 适合为单个路由附加一次性的中间件：
+//
+//	g.With(auth).GET("/admin", adminHandle)
+//
+// 副本与当前组共享前缀与路由器，中间件与上下文值则是复制的：
+// 之后在任意一方上 Use 或 WithValue 都不会影响另一方。
+func (g *Group) With(middleware ...Middleware) *Group {
+	c := *g
+	c.middlewares = append(append([]Middleware(nil), g.middlewares...), middleware...)
+	c.values = append([]groupValue(nil), g.values...)
+	return &c
 }
-func (g *Group) POST(relativePath string, handle Handle) {
-	g.Handle(http.MethodPost, relativePath, handle)
+
+// If 用于按条件注册路由，在注册期（而不是请求期）决定路由是否存在，
+// 避免在注册代码中到处书写 if env == "dev" 之类的判断：
+//
+//	router.If(debug).GET("/debug/vars", varsHandle)
+//
+// cond 为 true 时返回根路径上的组，路由正常注册；为 false 时返回一个游离的组，
+// 通过它注册的路由会被丢弃，不会出现在路由器中（路径格式错误等注册期检查仍然生效）。
+func (r *Router) If(cond bool) *Group {
+	if !cond {
+		return discardGroup("/")
+	}
+	g := r.Group("/")
+	g.implicit = true
+	return g
 }
-func (g *Group) PUT(relativePath string, handle Handle) {
-	g.Handle(http.MethodPut, relativePath, handle)
+
+// If 是 Router.If 的组版本：cond 为 true 时返回 g 本身，为 false 时返回一个具有相同前缀的游离组，
+// 通过它注册的路由会被丢弃。
+func (g *Group) If(cond bool) *Group {
+	if !cond {
+		return discardGroup(g.prefix)
+	}
+	return g
 }
-func (g *Group) PATCH(relativePath string, handle Handle) {
-	g.Handle(http.MethodPatch, relativePath, handle)
+
+// discardGroup 返回一个属于独立路由器的组，注册到其中的路由不会被使用。
+func discardGroup(prefix string) *Group {
+	return New().Group(prefix)
 }
-func (g *Group) DELETE(relativePath string, handle Handle) {
-	g.Handle(http.MethodDelete, relativePath, handle)
+
+// WithValue 为组附加一个上下文值：之后通过该组注册的每个路由，
+// 其请求上下文中都可以通过 key 取得 value，无需为静态的组级数据（例如租户配置）编写中间件。
+// 多次调用会累积；值在组中间件之前注入，因此组中间件也可以读取它们。
+// 子组继承父组已附加的值，同一个 key 由最内层（最后附加）的值生效。
+// 与 Use 一样，只影响之后注册的路由。
+func (g *Group) WithValue(key, value interface{}) {
+	if key == nil {
+		panic("nil key")
+	}
+	g.values = append(g.values, groupValue{key: key, value: value})
 }
-func (g *Group) Get(relativePath string, handle Handle) {
-	g.Handle(http.MethodGet, relativePath, handle)
+
+// chain 返回注册路由时使用的组中间件链，附加的上下文值作为最外层注入。
+func (g *Group) chain() []Middleware {
+	if len(g.values) == 0 {
+		return g.middlewares
+	}
+	values := g.values
+	inject := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			for _, v := range values {
+				ctx = context.WithValue(ctx, v.key, v.value)
+			}
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+	return append([]Middleware{inject}, g.middlewares...)
+}
+func (g *Group) GET(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodGet, relativePath, handle)
+}
+func (g *Group) HEAD(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodHead, relativePath, handle)
+}
+func (g *Group) OPTIONS(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodOptions, relativePath, handle)
+}
+func (g *Group) POST(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodPost, relativePath, handle)
 }
-func (g *Group) Head(relativePath string, handle Handle) {
-	g.Handle(http.MethodHead, relativePath, handle)
+func (g *Group) PUT(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodPut, relativePath, handle)
 }
-func (g *Group) Options(relativePath string, handle Handle) {
-	g.Handle(http.MethodOptions, relativePath, handle)
+func (g *Group) PATCH(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodPatch, relativePath, handle)
 }
-func (g *Group) Post(relativePath string, handle Handle) {
-	g.Handle(http.MethodPost, relativePath, handle)
+func (g *Group) DELETE(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodDelete, relativePath, handle)
 }
-func (g *Group) Put(relativePath string, handle Handle) {
-	g.Handle(http.MethodPut, relativePath, handle)
+func (g *Group) Get(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodGet, relativePath, handle)
 }
-func (g *Group) Patch(relativePath string, handle Handle) {
-	g.Handle(http.MethodPatch, relativePath, handle)
+func (g *Group) Head(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodHead, relativePath, handle)
 }
-func (g *Group) Delete(relativePath string, handle Handle) {
-	g.Handle(http.MethodDelete, relativePath, handle)
+func (g *Group) Options(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodOptions, relativePath, handle)
+}
+func (g *Group) Post(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodPost, relativePath, handle)
+}
+func (g *Group) Put(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodPut, relativePath, handle)
+}
+func (g *Group) Patch(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodPatch, relativePath, handle)
+}
+func (g *Group) Delete(relativePath string, handle Handle) *Route {
+	return g.Handle(http.MethodDelete, relativePath, handle)
 }
 
-// ANY 为组内路径注册一个处理所有 DefaultMethodsForAny 中定义的方法的 Handler。
+// ANY 为组内路径注册一个处理路由器 AnyMethods（未设置时为 DefaultMethodsForAny）中所有方法的 Handler。
+// 与 Router.ANY 一样，注册是原子的：任何一个方法的注册会发生冲突时，在修改任何 trie 树之前 panic。
 func (g *Group) ANY(path string, handle Handle) {
-	fullPath := g.prefix
-	if path != "" && path != "/" {
-		if path[0] == '/' {
-			if g.prefix == "/" {
-				fullPath = path
-			} else {
-				fullPath += path
-			}
-		} else {
-			if g.prefix == "/" {
-				fullPath += path
-			} else {
-				fullPath += "/" + path
-			}
+	fullPath := joinGroupPath(g.prefix, path)
+	methods := matchMethods(g.router.anyMethods())
+	g.router.mutate(func() {
+		for _, method := range methods {
+			g.router.checkRoute(method, fullPath, handle)
 		}
-	} else if path == "/" && g.prefix != "/" {
-		if g.prefix != "/" {
-			fullPath += "/"
+		for _, method := range methods {
+			g.addRoute(method, fullPath, handle, nil)
 		}
-	} else if path == "" && g.prefix == "/" {
-		fullPath = "/"
-	}
-	g.router.ANY(fullPath, handle) // 委托给 Router 的 ANY 方法
+	})
 }
 
 // Handle 使用给定的路径和方法注册新的请求处理程序。
-// ... (方法内部逻辑保持不变)
-func (r *Router) Handle(method, path string, handle Handle) {
+// method 可以是任意方法名，包括 PROPFIND、MKCOL 等非标准（例如 WebDAV）方法，
+// 它们与标准方法一样参与路由、Lookup 以及 Allow 头部（OPTIONS 与 405 回复）的计算。
+// 返回的 *Route 可用于为该路由追加匹配后分派规则。
+//
+// 路径的最后一段可以是以 '?' 结尾的可选命名参数，例如 "/files/:name?"：
+// 它同时匹配 "/files/report.pdf" 与 "/files"，后者的 Params.ByName("name") 返回空字符串。
+// 两种情况共享同一个 Route（以及它的守卫与分派规则），SaveMatchedRoutePath 记录的都是 "/files/:name?"。
+//
+// 命名参数可以带有正则表达式约束，例如 "/users/:id(\d+)"，约束需要匹配整个段。
+//
+// 同一位置的静态段与参数（或 catch-all）不能共存，例如 "/users/:id" 与 "/users/me"，后注册的一方会被拒绝。
+// 带约束的参数同样占据整个位置："/users/:id(\d+)" 与 "/users/me"、"/users/:id(\d+)" 与 "/users/:name([a-z]+)"
+// 都不能同时注册。段不满足约束时不会转而尝试同一位置的其他路由，请求按未匹配处理（例如交给 NotFound）。
+// 同名的 catch-all 可以带不同的后缀共存，例如 "/src/*filepath" 与 "/src/*filepath/raw"，
+// 此时更具体的后者优先匹配，ConflictReport 列出这类路由。
+// 路径无效或与已注册的路由冲突时 panic；需要以错误的形式处理这些情况时使用 TryHandle，
+// 返回的 RouteError.Existing 给出与之冲突的已注册路由模式。
+func (r *Router) Handle(method, path string, handle Handle) *Route {
+	return r.handle(method, path, handle, nil)
+}
+
+// HandleWith 与 Handle 相同，但为这一条路由附加中间件，无需为此创建 Group。
+// 中间件的包裹方式与组中间件相同（按照给出的顺序从外向内执行），
+// 通过 Use 添加的全局中间件仍然在它们之外执行，处理函数收到的 Params 不受影响。
+//
+//	router.HandleWith(http.MethodPost, "/admin/reload", reload, auth, audit)
+func (r *Router) HandleWith(method, path string, handle Handle, middleware ...Middleware) *Route {
+	return r.handle(method, path, handle, middleware)
+}
+
+// TryHandle 注册路由时可能返回的错误，可以通过 errors.Is 判断类别。
+var (
+	ErrEmptyMethod   = errors.New("httprouter: method must not be empty")
+	ErrInvalidPath   = errors.New("httprouter: invalid path")
+	ErrNilHandler    = errors.New("httprouter: handle must not be nil")
+	ErrRouteConflict = errors.New("httprouter: route conflicts with an existing route")
+)
+
+// RouteError 描述 TryHandle 拒绝注册的路由。
+type RouteError struct {
+	Method string
+	Path   string
+
+	// Err 是错误类别：ErrEmptyMethod、ErrInvalidPath、ErrNilHandler 或 ErrRouteConflict
+	Err error
+
+	// Existing 是与之冲突的已注册路由模式，仅用于 ErrRouteConflict，无法确定时为空
+	Existing string
+
+	// Detail 是具体原因，与 Handle 在同样情况下 panic 的消息相同
+	Detail string
+}
+
+func (e *RouteError) Error() string {
+	msg := e.Err.Error() + ": " + e.Method + " " + e.Path
+	if e.Existing != "" {
+		msg += " (existing route '" + e.Existing + "')"
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// TryHandle 与 Handle 相同，但在路由无法注册时返回错误而不是 panic，适用于在运行时根据配置注册路由。
+// 返回的错误是 *RouteError，其类别（Err）可以通过 errors.Is 判断：
+//   - ErrEmptyMethod：method 为空；
+//   - ErrNilHandler：handle 为 nil；
+//   - ErrInvalidPath：路径不以 '/' 开头或模式本身无效（例如参数没有名称、约束不是有效的正则表达式），
+//     或者声明的参数多于 MaxRequestParams；
+//   - ErrRouteConflict：与已注册的路由冲突（包括重复注册），Existing 给出冲突的已注册路由模式。
+//
+// 返回错误时路由表保持不变。
+func (r *Router) TryHandle(method, path string, handle Handle) error {
+	var err error
+	r.mutate(func() {
+		if err = r.validateRoute(method, path, handle); err == nil {
+			r.addRoute(method, path, handle, nil, false)
+		}
+	})
+	return err
+}
+
+// validateRoute 检查路由能否注册到 r.routes，不能时返回 *RouteError。
+func (r *Router) validateRoute(method, path string, handle Handle) error {
+	fail := func(kind error, existing, detail string) error {
+		return &RouteError{Method: method, Path: path, Err: kind, Existing: existing, Detail: detail}
+	}
+	switch {
+	case method == "":
+		return fail(ErrEmptyMethod, "", "")
+	case handle == nil:
+		return fail(ErrNilHandler, "", "")
+	case len(path) < 1 || path[0] != '/':
+		return fail(ErrInvalidPath, "", "path must begin with '/' in path '"+path+"'")
+	}
+
+	// 在空树上插入时发生的 panic 来自模式本身
+	if detail, ok := registrationPanic(func() { addPattern(new(node), path, path, handle) }); ok {
+		return fail(ErrInvalidPath, "", detail)
+	}
+	if detail, ok := registrationPanic(func() { r.checkParamCount(path) }); ok {
+		return fail(ErrInvalidPath, "", detail)
+	}
+
+	tp := r.treePattern(path)
+	t := r.routes
+	if t == nil || t.trees[method] == nil || (method == http.MethodHead && t.autoHead[tp]) {
+		return nil
+	}
+	root := t.trees[method]
+	detail, ok := registrationPanic(func() { addPattern(root.clone(), tp, path, handle) })
+	if !ok {
+		return nil
+	}
+	// 找出与之冲突的已注册路由：单独与它一起插入时同样失败
+	existing := ""
+	root.walk("", func(p, pattern string, h Handle) {
+		if existing != "" {
+			return
+		}
+		if _, ok := registrationPanic(func() {
+			pair := new(node)
+			pair.addRoute(p, h)
+			addPattern(pair, tp, path, handle)
+		}); ok {
+			// 报告注册时的路由模式，例如可选参数路由的 "/files/:name?" 而不是它在树中的某一种形式
+			existing = pattern
+		}
+	})
+	return fail(ErrRouteConflict, existing, detail)
+}
+
+// registrationPanic 执行 fn，返回它 panic 时的消息。
+func registrationPanic(fn func()) (detail string, panicked bool) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			detail, panicked = fmt.Sprint(rcv), true
+		}
+	}()
+	fn()
+	return "", false
+}
+
+// handle 是 Handle 的内部实现。
+// middlewares 是组级中间件，它们包裹在路由分派（Route.serve）之外，
+// 因此通过 Route 追加的替代处理函数同样会经过这些中间件。
+func (r *Router) handle(method, path string, handle Handle, middlewares []Middleware) *Route {
+	var route *Route
+	r.mutate(func() {
+		route = r.addRoute(method, path, handle, middlewares, false)
+	})
+	return route
+}
+
+// addRoute 将路由添加到 r.routes，调用方负责与请求处理之间的同步（见 mutate）。
+// autoHead 表示这是 AutoHead 为 GET 路由自动生成的 HEAD 路由。
+func (r *Router) addRoute(method, path string, handle Handle, middlewares []Middleware, autoHead bool) *Route {
 	varsCount := uint16(0)
 
 	if method == "" {
@@ -723,109 +1840,246 @@ func (r *Router) Handle(method, path string, handle Handle) {
 	if handle == nil {
 		panic("handle must not be nil")
 	}
+	r.checkParamCount(path)
+
+	route := &Route{router: r, method: method, path: path, handle: handle}
+	handle = applyGroupMiddlewares(middlewares, route.serve)
+	if len(middlewares) > 0 {
+		// 将路由器放入上下文，供本包提供的中间件使用错误处理器
+		grouped := handle
+		handle = func(w http.ResponseWriter, req *http.Request, ps Params) {
+			grouped(w, r.withRouter(req), ps)
+		}
+	}
+
+	t := r.routes
+	if t == nil {
+		t = &routeTable{}
+		r.routes = t
+		r.table.Store(t)
+	}
+	route.table = t
+
+	route.chain = handle
 
 	if r.SaveMatchedRoutePath {
 		varsCount++
-		handle = r.saveMatchedRoutePath(path, handle)
+		handle = r.saveMatchedRoutePath(t, path, handle)
 	}
 
-	if r.trees == nil {
-		r.trees = make(map[string]*node)
+	if t.trees == nil {
+		t.trees = make(map[string]*node)
 	}
 
-	root := r.trees[method]
+	tp := r.treePattern(path)
+	if method == http.MethodHead && !autoHead && t.autoHead[tp] {
+		// 显式注册的 HEAD 路由取代自动生成的路由
+		r.removeRoute(http.MethodHead, path)
+	}
+
+	root := t.trees[method]
 	if root == nil {
 		root = new(node)
-		r.trees[method] = root
+		t.trees[method] = root
 
-		r.globalAllowed = r.allowed("*", "") // 更新全局允许的方法
+		t.globalAllowed = r.computeAllowed(t, "*", "") // 更新全局允许的方法
 	}
 
-	root.addRoute(path, handle)
+	addPattern(root, tp, path, handle)
+	t.clearAllowedCache()
+
+	if r.SaveMatchedRoutePath {
+		if t.savesMatchedPath == nil {
+			t.savesMatchedPath = make(map[string]bool)
+		}
+		if base, full, ok := splitOptionalParam(tp); ok {
+			t.savesMatchedPath[method+" "+base] = true
+			t.savesMatchedPath[method+" "+full] = true
+		} else {
+			t.savesMatchedPath[method+" "+tp] = true
+		}
+	}
+
+	if method == http.MethodHead {
+		if autoHead {
+			if t.autoHead == nil {
+				t.autoHead = make(map[string]bool)
+			}
+			t.autoHead[tp] = true
+		} else {
+			t.explicitHead++
+		}
+	}
 
 	// 更新 maxParams
-	if paramsCount := countParams(path); paramsCount+varsCount > r.maxParams {
-		r.maxParams = paramsCount + varsCount
+	if paramsCount := countParams(path); paramsCount+varsCount > t.maxParams {
+		t.maxParams = paramsCount + varsCount
 	}
 
 	// 延迟初始化 paramsPool 分配函数
-	if r.paramsPool.New == nil && r.maxParams > 0 {
-		r.paramsPool.New = func() interface{} {
-			ps := make(Params, 0, r.maxParams)
-			return &ps
+	r.initParamsPool(t)
+
+	if r.OnRegister != nil {
+		r.OnRegister(method, path)
+	}
+
+	if method == http.MethodGet && r.AutoHead {
+		r.addAutoHead(t, route)
+	}
+
+	return route
+}
+
+// addAutoHead 为 GET 路由 rt 注册自动生成的 HEAD 路由，见 AutoHead。
+// 路径已经显式注册了 HEAD 路由（或与显式注册的 HEAD 路由冲突）时不注册。
+func (r *Router) addAutoHead(t *routeTable, rt *Route) {
+	if t.explicitHead > 0 && t.trees[http.MethodHead] != nil {
+		conflict := func() (conflict bool) {
+			defer func() {
+				conflict = recover() != nil
+			}()
+			addPattern(t.trees[http.MethodHead].clone(), r.treePattern(rt.path), rt.path, rt.handle)
+			return false
+		}()
+		if conflict {
+			return
 		}
 	}
+	r.addRoute(http.MethodHead, rt.path, headHandle(rt.chain), nil, true)
+}
+
+// headHandle 返回以 HEAD 请求执行 chain 的处理函数：响应体被丢弃，
+// 未设置 Content-Length 时按丢弃的响应体长度补充，见 headResponseWriter。
+func headHandle(chain Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		hw := &headResponseWriter{w: w}
+		chain(hw, req, ps)
+		hw.finish()
+	}
 }
 
 // Handler 是一个适配器，允许将 http.Handler 用作请求处理程序。
 // Params 在请求上下文中可以通过 ParamsKey 获取。
 // **重要**: req.Context() 会被用于传递 Params。
-func (r *Router) Handler(method, path string, handler http.Handler) {
-	r.Handle(method, path,
-		func(w http.ResponseWriter, req *http.Request, p Params) {
-			// 确保即使 p 为空 (例如没有路径参数的路由)，我们也不会尝试将 nil 存入 context
-			// 虽然 context.WithValue(ctx, key, nil) 是合法的，但 ParamsFromContext 会返回 nil Params。
-			// 只有当 p 实际有值时（或者 SaveMatchedRoutePath 导致 p 被创建），才将其放入 context。
-			if len(p) > 0 { // 检查 len(p) 而不是 p != nil，因为 p 可能是空的非 nil 切片
-				ctx := req.Context()
-				ctx = context.WithValue(ctx, ParamsKey, p)
-				req = req.WithContext(ctx) // 使用新的 context，其中包含 Params
-			}
-			handler.ServeHTTP(w, req) // req 现在携带了更新后的 context
-		},
-	)
+func (r *Router) Handler(method, path string, handler http.Handler) *Route {
+	return r.Handle(method, path, r.handlerHandle(handler))
+}
+
+// handlerHandle 返回调用 handler 的 Handle，参数放入请求上下文，见 Handler。
+func (r *Router) handlerHandle(handler http.Handler) Handle {
+	return func(w http.ResponseWriter, req *http.Request, p Params) {
+		// 确保即使 p 为空 (例如没有路径参数的路由)，我们也不会尝试将 nil 存入 context
+		// 虽然 context.WithValue(ctx, key, nil) 是合法的，但 ParamsFromContext 会返回 nil Params。
+		// 只有当 p 实际有值时（或者 SaveMatchedRoutePath 导致 p 被创建），才将其放入 context。
+		if len(p) > 0 { // 检查 len(p) 而不是 p != nil，因为 p 可能是空的非 nil 切片
+			ctx := req.Context()
+			ctx = r.withParams(ctx, p)
+			req = req.WithContext(ctx) // 使用新的 context，其中包含 Params
+		}
+		handler.ServeHTTP(w, req) // req 现在携带了更新后的 context
+	}
 }
 
 // HandlerFunc 是一个适配器，允许将 http.HandlerFunc 用作请求处理程序。
-func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
-	r.Handler(method, path, handler)
+func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) *Route {
+	return r.Handler(method, path, handler)
 }
 
 // ServeFiles 从给定的文件系统根目录提供文件。
-// ... (方法内部逻辑基本保持不变, 但注意 context 的传递)
+// path 必须以 "/*filepath" 结尾，文件路径取自 filepath 参数，例如 "/src/*filepath" 下的 "/src/a.go" 提供 root 中的 "/a.go"。
+// 文件不存在等错误回复会交给路由器配置的 NotFound 或错误处理器（见 SetErrorHandler），
+// 未配置时使用 http.FileServer 自己的回复。
 func (r *Router) ServeFiles(path string, root http.FileSystem) {
 	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
 		panic("path must end with /*filepath in path '" + path + "'")
 	}
-
-	fileServer := http.FileServer(root)
-
-	r.GET(path, func(w http.ResponseWriter, req *http.Request, ps Params) {
-		originalPath := req.URL.Path // 保存原始路径，如果需要的话
-		req.URL.Path = ps.ByName("filepath")
-
-		// 将 Params 存储到请求的 context 中，供后续可能需要的中间件或 handler 使用
-		// 虽然 fileServer.ServeHTTP 可能不直接使用它，但保持一致性是好的
-		if len(ps) > 0 {
-			ctx := req.Context()
-			ctx = context.WithValue(ctx, ParamsKey, ps) // Store the VALUE in context
-			req = req.WithContext(ctx)                  // Use the new context
-		}
-
-		// 检查客户端是否已断开连接
-		// 注意: fileServer.ServeHTTP 内部可能也会处理 context，但这提供了一个额外的检查点
-		// 不过，通常对于静态文件服务，这种检查可能不是必须的，除非文件非常大或传输慢
-		// select {
-		// case <-req.Context().Done():
-		// 	 // 客户端断开，可以记录日志或提前返回，但通常 ServeHTTP 会处理
-		// 	 return
-		// default:
-		// }
-
-		fileServer.ServeHTTP(w, req)
-		req.URL.Path = originalPath // 恢复原始路径，以防请求对象被重用或检查
-	})
+	r.GET(path, r.filesHandle(root))
 }
 
 // ServeUnmatched 配置路由器将所有未匹配的路由尝试作为静态文件处理。
 // fs 指定了静态文件的根目录。
-func (r *Router) ServeUnmatched(fs http.FileSystem) {
+// 可选的 filter 决定哪些请求尝试静态文件（见 UnmatchedStaticFilter），给出多个时都返回 true 才尝试：
+//
+//	router.ServeUnmatched(http.Dir("public"), func(req *http.Request) bool {
+//		return strings.HasPrefix(req.URL.Path, "/static/")
+//	})
+func (r *Router) ServeUnmatched(fs http.FileSystem, filter ...func(*http.Request) bool) {
 	r.FileSystemForUnmatched = fs
 	r.ServeUnmatchedAsStatic = true
+	switch len(filter) {
+	case 0:
+		r.UnmatchedStaticFilter = nil
+	case 1:
+		r.UnmatchedStaticFilter = filter[0]
+	default:
+		filters := slices.Clone(filter)
+		r.UnmatchedStaticFilter = func(req *http.Request) bool {
+			for _, f := range filters {
+				if !f(req) {
+					return false
+				}
+			}
+			return true
+		}
+	}
 }
 
+// DefaultPathParam 是默认路由处理程序接收的参数名称，其值为完整的请求路径。
+const DefaultPathParam = "path"
+
+// Default 设置默认路由：没有匹配到任何路由、不是 405 且没有对应的静态文件的请求，
+// 在交给 NotFound 之前由 handle 处理。handle 通过 DefaultPathParam 参数接收完整的请求路径，
+// 参数同样会放入请求上下文。这相当于一个对所有方法生效、优先级最低的 catch-all 路由，
+// 而无需为每个方法注册 /*path。
+//
+// 优先级为：具体路由（及重定向、405、自动 OPTIONS）> 静态文件（ServeUnmatched）> 默认路由 > NotFound。
+// 启用 ServeUnmatched 时，只有文件系统中不存在请求路径时才会调用默认路由。
+func (r *Router) Default(handle Handle) {
+	r.defaultHandle = handle
+}
+
+// DefaultMethod 为指定的方法设置默认路由，优先于 Default 设置的默认路由。见 Default。
+func (r *Router) DefaultMethod(method string, handle Handle) {
+	if method == "" {
+		panic("method must not be empty")
+	}
+	if r.defaultHandles == nil {
+		r.defaultHandles = make(map[string]Handle)
+	}
+	r.defaultHandles[method] = handle
+}
+
+// defaultFor 返回该方法的默认路由，不存在时返回 nil。
+func (r *Router) defaultFor(method string) Handle {
+	if h := r.defaultHandles[method]; h != nil {
+		return h
+	}
+	return r.defaultHandle
+}
+
+// staticFileExists 报告 fs 中是否存在请求路径对应的文件或目录。
+func staticFileExists(fs http.FileSystem, p string) bool {
+	f, err := fs.Open(path.Clean("/" + p))
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// recv 从处理请求时发生的 panic 中恢复，交给 RecoveryHandler 或以 500 回复（经由错误处理器）。
+// 处理程序已经开始写出响应（例如流式响应写了一部分）或已接管连接（Hijack）时，
+// 再写入 500 只会破坏已发送的响应，此时只调用 RecoveryHandler（如果设置）用于记录：
+// 它再次写出的头部被忽略，连接被接管后写入的内容被丢弃。
 func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 	if rcv := recover(); rcv != nil {
+		if tw := trackerOf(w); tw != nil && (tw.started || tw.hijacked) {
+			if r.RecoveryHandler != nil {
+				r.RecoveryHandler(w, req, rcv)
+			}
+			return
+		}
+
 		// 在调用 RecoveryHandler 之前，检查请求上下文是否已取消（客户端断开连接）
 		// 这有助于避免在客户端已经离开时尝试写入响应。
 		select {
@@ -844,10 +2098,8 @@ func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 
 		if r.RecoveryHandler != nil {
 			r.RecoveryHandler(w, req, rcv)
-		} else if r.errorHandler != nil { // 使用统一的错误处理器处理 panic
-			r.errorHandler(w, req, http.StatusInternalServerError)
-		} else {
-			defaultErrorHandler(w, req, http.StatusInternalServerError)
+		} else { // 使用统一的错误处理器处理 panic
+			r.serveError(w, req, http.StatusInternalServerError, ReasonPanic)
 		}
 	}
 }
@@ -855,10 +2107,11 @@ func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 // Lookup 允许手动查找方法 + 路径组合。
 // ... (方法内部逻辑保持不变)
 func (r *Router) Lookup(method, path string) (Handle, Params, bool) {
-	if root := r.trees[method]; root != nil {
-		handle, ps, tsr := root.getValue(path, r.getParams)
+	t := r.liveTable()
+	if root := t.trees[method]; root != nil {
+		handle, ps, tsr := root.getFoldedValue(r.routePath(path), path, t.getParams)
 		if handle == nil {
-			r.putParams(ps) // 确保即使未找到处理程序，获取的 params 也能被放回
+			t.putParams(ps) // 确保即使未找到处理程序，获取的 params 也能被放回
 			return nil, nil, tsr
 		}
 		// if ps == nil { // ps 可能是空的非 nil 切片，这是有效的
@@ -873,26 +2126,156 @@ func (r *Router) Lookup(method, path string) (Handle, Params, bool) {
 	return nil, nil, false
 }
 
-func (r *Router) allowed(path, reqMethod string) (allow string) {
+// LookupInto 与 Lookup 相同，但参数写入调用方提供的 ps（先被重置为空），不使用内部的 Params 池，
+// 适合在循环中反复查找的调度器：复用同一个 ps 时，匹配参数路由不产生任何内存分配
+// （启用 CaseInsensitive 时转换路径仍需分配）。
+// ps 的容量小于路由器中最多的参数个数时会被替换为足够大的切片，之后的调用即可直接复用。
+// 返回后 *ps 持有匹配到的参数（未匹配时为空），与 ps 共享底层数组：
+// ps 的生命周期由调用方负责，在下一次使用 ps 查找之前必须用完或复制这些参数。
+func (r *Router) LookupInto(method, path string, ps *Params) (Handle, bool) {
+	*ps = (*ps)[:0]
+	t := r.liveTable()
+	root := t.trees[method]
+	if root == nil {
+		return nil, false
+	}
+	if cap(*ps) < int(t.maxParams) {
+		*ps = make(Params, 0, t.maxParams)
+	}
+	handle, _, tsr := root.getFoldedValue(r.routePath(path), path, func() *Params { return ps })
+	if handle == nil {
+		*ps = (*ps)[:0]
+	}
+	return handle, tsr
+}
+
+// LookupPattern 与 Lookup 相同，但同时返回匹配到的路由模式，例如 "/users/:id"，
+// 不需要启用 SaveMatchedRoutePath，适合作为指标的标签。
+// 模式与 MatchedPatternFromContext 相同，是注册时记录的路由模式：通过组注册的路由包含所有组前缀；
+// 可选参数的路由两种形式都返回 "/files/:name?"；启用 CaseInsensitive 时保持注册时的大小写。
+// 没有匹配到路由时模式为空。
+func (r *Router) LookupPattern(method, path string) (Handle, Params, string, bool) {
+	t := r.liveTable()
+	root := t.trees[method]
+	if root == nil {
+		return nil, nil, "", false
+	}
+	routePath := r.routePath(path)
+	handle, ps, tsr := root.getFoldedValue(routePath, path, t.getParams)
+	if handle == nil {
+		t.putParams(ps)
+		return nil, nil, "", tsr
+	}
+	var params Params
+	if ps != nil {
+		params = *ps
+	}
+	return handle, params, root.matchedFoldedPattern(routePath, path), tsr
+}
+
+// RedirectPath 返回 ServeHTTP 对 method 与 path 的请求进行重定向时的目标路径，以及是否会重定向，
+// 但不执行重定向，可用于在自定义的处理程序中构造重定向回复。
+// 判断与 ServeHTTP 完全相同：path 匹配到路由时不重定向；否则按 RedirectTrailingSlash 添加或去除尾部斜杠，
+// 再按 RedirectFixedPath 对 CleanPath 清理后的路径进行不区分大小写的查找；
+// 同样遵循 RedirectNonIdempotent，不重定向 CONNECT 请求与根路径 "/"。
+// 重定向使用的状态码见 RedirectStatusGET。
+// 启用 DecodeParams 时，path 应与 ServeHTTP 匹配时使用的路径一样是编码形式（URL.EscapedPath），返回的目标路径同样是编码形式。
+func (r *Router) RedirectPath(method, path string) (string, bool) {
+	root := r.liveTable().trees[method]
+	if root == nil {
+		return "", false
+	}
+	handle, _, tsr := root.getValue(r.routePath(path), nil)
+	if handle != nil {
+		return "", false
+	}
+	if tsr && r.MergeTrailingSlash {
+		if handle, _, _ := root.getValue(r.routePath(toggleTrailingSlash(path)), nil); handle != nil {
+			return "", false
+		}
+	}
+	return r.redirectTarget(root, method, path, tsr)
+}
+
+// toggleTrailingSlash 返回去掉（以 '/' 结尾时）或添加尾部斜杠后的路径。
+func toggleTrailingSlash(path string) string {
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+// redirectTarget 返回在 root 中没有匹配到路由的请求应当重定向到的路径，tsr 是查找给出的尾部斜杠建议。
+func (r *Router) redirectTarget(root *node, method, path string, tsr bool) (string, bool) {
+	if method == http.MethodConnect || path == "/" ||
+		!(r.RedirectNonIdempotent || method == http.MethodGet || method == http.MethodHead) {
+		return "", false
+	}
+	if tsr && r.RedirectTrailingSlash {
+		return toggleTrailingSlash(path), true
+	}
+	if r.RedirectFixedPath {
+		return root.findCaseInsensitivePath(CleanPath(path), r.RedirectTrailingSlash)
+	}
+	return "", false
+}
+
+// allowedCacheKey 是 allowedCache 的键。
+// allowed 的结果还取决于 HandleOPTIONS 与 MergeTrailingSlash，因此也将它们纳入键中。
+type allowedCacheKey struct {
+	path               string
+	reqMethod          string
+	handleOPTIONS      bool
+	mergeTrailingSlash bool
+}
+
+// allowed 返回给定路径（或服务器范围的 "*"）允许的方法列表，用于 Allow 头部。
+// 特定路径的结果缓存在有界的 allowedCache 中，在路由表变更时清空。
+func (r *Router) allowed(path, reqMethod string) string {
+	return r.allowedIn(r.liveTable(), path, reqMethod)
+}
+
+// allowedIn 与 allowed 相同，但使用给定的路由表。
+func (r *Router) allowedIn(t *routeTable, path, reqMethod string) (allow string) {
+	if path == "*" {
+		return r.computeAllowed(t, path, reqMethod)
+	}
+	path = r.routePath(path)
+
+	key := allowedCacheKey{path: path, reqMethod: reqMethod, handleOPTIONS: r.HandleOPTIONS, mergeTrailingSlash: r.MergeTrailingSlash}
+	if allow, ok := t.allowedCache.get(key); ok {
+		return allow
+	}
+
+	allow = r.computeAllowed(t, path, reqMethod)
+	t.allowedCache.put(key, allow)
+	return allow
+}
+
+// computeAllowed 扫描路由表中所有方法的 trie 树，计算允许的方法列表。
+func (r *Router) computeAllowed(t *routeTable, path, reqMethod string) (allow string) {
 	allowedMethods := make([]string, 0, 9) // 预分配容量
 
 	if path == "*" { // 服务器范围
-		if reqMethod == "" { // 内部调用以刷新缓存 (r.globalAllowed)
-			for method := range r.trees {
+		if reqMethod == "" { // 内部调用以刷新缓存 (t.globalAllowed)
+			for method := range t.trees {
 				if method == http.MethodOptions {
 					continue
 				}
 				allowedMethods = append(allowedMethods, method)
 			}
 		} else {
-			return r.globalAllowed // 直接返回缓存的全局允许方法
+			return t.globalAllowed // 直接返回缓存的全局允许方法
 		}
 	} else { // 特定路径
-		for method := range r.trees {
+		for method, root := range t.trees {
 			if method == reqMethod || method == http.MethodOptions {
 				continue
 			}
-			handle, _, _ := r.trees[method].getValue(path, nil) // getValue 不需要 params 池进行检查
+			handle, _, tsr := root.getValue(path, nil) // getValue 不需要 params 池进行检查
+			if handle == nil && tsr && r.MergeTrailingSlash {
+				handle, _, _ = root.getValue(toggleTrailingSlash(path), nil)
+			}
 			if handle != nil {
 				allowedMethods = append(allowedMethods, method)
 			}
@@ -916,6 +2299,80 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 	return "" // 如果没有允许的方法，则返回空字符串
 }
 
+// routeMethod 返回路由 req 时使用的方法：MethodOverrideHeader 指定了有效的替换方法时为该方法，
+// 否则为 req.Method。
+func (r *Router) routeMethod(req *http.Request) string {
+	if r.MethodOverrideHeader == "" || req.Method != http.MethodPost {
+		return req.Method
+	}
+	switch m := strings.ToUpper(req.Header.Get(r.MethodOverrideHeader)); m {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return m
+	}
+	return req.Method
+}
+
+// serveUnknownMethod 按 UnknownMethodStatus 回复使用了未注册方法的请求。
+func (r *Router) serveUnknownMethod(w http.ResponseWriter, req *http.Request, t *routeTable, path string) {
+	switch r.UnknownMethodStatus {
+	case http.StatusNotFound:
+		r.serveNotFound(w, req, ReasonUnknownMethod)
+	case http.StatusMethodNotAllowed:
+		allow := r.allowedIn(t, path, r.routeMethod(req))
+		if allow == "" {
+			allow = t.globalAllowed
+		}
+		r.serveMethodNotAllowed(w, req, allow)
+	default:
+		r.serveError(w, req, r.UnknownMethodStatus, ReasonUnknownMethod)
+	}
+}
+
+// autoOPTIONSKey 是自动 OPTIONS 回复在请求上下文中的键。
+// 当 OPTIONSRouteMiddleware 启用时，路由器会以 OPTIONS 请求调用另一方法的路由，
+// Route.serve 据此执行自动回复而不是路由的处理函数。
+type autoOPTIONSKey struct{}
+
+// serveAutoOPTIONS 自动回复 OPTIONS 请求，allow 是该路径允许的方法列表。
+func (r *Router) serveAutoOPTIONS(w http.ResponseWriter, req *http.Request, t *routeTable, path, allow string) {
+	reply := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", allow)
+		if r.GlobalOPTIONS != nil {
+			r.GlobalOPTIONS.ServeHTTP(w, withAllowedMethods(req, allow))
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	if r.OPTIONSRouteMiddleware {
+		// allow 已排序，选择第一个注册了该路径的方法
+		for _, method := range strings.Split(allow, ", ") {
+			root := t.trees[method]
+			if method == http.MethodOptions || root == nil {
+				continue
+			}
+			handle, psPtr, _ := root.getFoldedValue(r.routePath(path), path, t.getParams)
+			if handle == nil {
+				t.putParams(psPtr)
+				continue
+			}
+			var params Params
+			if psPtr != nil {
+				params = *psPtr
+				defer t.putParams(psPtr)
+			}
+			ctx := context.WithValue(req.Context(), autoOPTIONSKey{}, reply)
+			if len(params) > 0 {
+				ctx = r.withParams(ctx, params)
+			}
+			handle(w, req.WithContext(ctx), params)
+			return
+		}
+	}
+
+	reply.ServeHTTP(w, req)
+}
+
 // applyMiddleware 是一个辅助函数，用于将全局中间件应用于给定的 http.Handler。
 // ... (方法内部逻辑保持不变)
 func (r *Router) applyMiddleware(handler http.Handler) http.Handler {
@@ -931,6 +2388,46 @@ func (r *Router) applyMiddleware(handler http.Handler) http.Handler {
 // **重要**: req.Context() 在这里是源头，它会被传递下去。
 // 中间件和最终的路由处理函数都可以访问和使用这个上下文。
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.serving.Load() {
+		r.serving.Store(true)
+	}
+
+	if r.OnRequest != nil {
+		r.OnRequest(req)
+	}
+	// 记录响应是否已开始写出以及连接是否被接管（例如 WebSocket），
+	// 使 panic 恢复不会再写入已经开始的响应或已被接管的连接
+	tracker, tracked := newTrackingResponseWriter(w)
+	if r.OnResponse != nil {
+		scw := newStatusCapturingResponseWriter(w)
+		start := time.Now()
+		defer func() {
+			status := scw.status
+			if status == 0 {
+				status = http.StatusOK
+				if tracker.hijacked {
+					status = http.StatusSwitchingProtocols
+				}
+			}
+			r.OnResponse(req, status, scw.size, time.Since(start))
+		}()
+		tracker.w = scw
+	}
+	w = tracked
+
+	// 排空期间，除允许的路径与 DrainExempt 放行的请求外一律回复 503，不经过中间件与 PreHandler
+	if r.draining.Load() && !r.drainAllowed(req.URL.Path) &&
+		(r.DrainExempt == nil || !r.DrainExempt(req)) {
+		r.serveDraining(w, req)
+		return
+	}
+
+	// 编码不一致的路径交给 MalformedPathHandler，不进行匹配
+	if r.MalformedPathHandler != nil && malformedPath(req.URL) {
+		r.serveMalformedPath(w, req)
+		return
+	}
+
 	// 在最外层设置 panic 恢复。
 	// defer r.recv(w, req) // 移动到匿名函数内部，以确保它在 applyMiddleware 之后执行的 handler 的 panic 也能捕获
 	// 并且确保在核心逻辑执行前应用中间件
@@ -941,22 +2438,87 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// 它是中间件链中的“最内层”处理程序。
 	coreRoutingAndHandling := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		// 确保在核心处理逻辑中也捕获panic，这样 RecoveryHandler 能正确获取 w, req
-		defer func() {
-			// 使用原始的 w 和 req (ServeHTTP 的参数) 进行恢复，
-			// 因为中间件可能替换了 writer 或 request
-			r.recv(w, req)
-		}()
+		// 使用原始的 w 和 req (ServeHTTP 的参数) 进行恢复，
+		// 因为中间件可能替换了 writer 或 request。
+		// recover 只有在被延迟调用的函数中直接调用时才有效，因此必须直接 defer r.recv，
+		// 不能再包一层匿名函数。
+		defer r.recv(w, req)
+
+		r.inFlight.Add(1)
+		defer r.inFlight.Add(-1)
+
+		// 写入默认响应头部，处理程序可以覆盖它们
+		if len(r.DefaultHeaders) > 0 {
+			h := writer.Header()
+			for k, v := range r.DefaultHeaders {
+				h[k] = append([]string(nil), v...)
+			}
+		}
+
+		if r.PreHandler != nil && !r.PreHandler(writer, request) {
+			return
+		}
+
+		// 段数过多的路径不进行匹配
+		if r.MaxSegments > 0 && tooManySegments(request.URL.Path, r.MaxSegments) {
+			r.serveError(writer, request, http.StatusRequestURITooLong, ReasonTooManySegments)
+			return
+		}
+
+		// 启用 Server-Timing 时，包装 writer 以便在首次写出头部之前补充耗时信息
+		var timing *serverTiming
+		if r.EmitServerTiming {
+			timing = newServerTiming()
+			scw := newStatusCapturingResponseWriter(writer)
+			scw.beforeWriteHeader = timing.writeHeader
+			writer = scw
+			defer timing.finish(scw)
+		}
+
+		// 路由使用的方法，可能由 MethodOverrideHeader 替换
+		method := r.routeMethod(request)
+		if r.MethodOverrideRewrite && method != request.Method {
+			request = request.WithContext(request.Context())
+			request.Method = method
+		}
 
 		// path 现在从 request 获取，因为中间件可能修改了 request.URL.Path
 		currentPath := request.URL.Path
-
-		if root := r.trees[request.Method]; root != nil {
-			handle, psPtr, tsr := root.getValue(currentPath, r.getParams) // psPtr is *Params
+		// matchPath 是匹配路由使用的路径，启用 DecodeParams 时为原始编码形式
+		matchPath := currentPath
+		if r.DecodeParams {
+			matchPath = request.URL.EscapedPath()
+		}
+		// 在 trie 树中查找使用的路径，启用 CaseInsensitive 时为小写形式
+		routePath := r.routePath(matchPath)
+
+		// 整个请求使用同一份路由表，即使期间发生了 Swap
+		t := r.liveTable()
+
+		// trailingSlash 记录是否存在只差尾部斜杠的路由，用于区分 404 的原因
+		trailingSlash := false
+		if root := t.trees[method]; root != nil {
+			handle, psPtr, tsr := root.getFoldedValue(routePath, matchPath, t.getParams) // psPtr is *Params
+			trailingSlash = tsr
+			// 启用 MergeTrailingSlash 时，直接使用只差尾部斜杠的路由处理，而不是重定向
+			if handle == nil && tsr && r.MergeTrailingSlash {
+				mergedRoute, mergedPath := toggleTrailingSlash(routePath), toggleTrailingSlash(matchPath)
+				if h, ps, _ := root.getFoldedValue(mergedRoute, mergedPath, t.getParams); h != nil {
+					t.putParams(psPtr)
+					handle, psPtr = h, ps
+					routePath, matchPath = mergedRoute, mergedPath
+				} else {
+					t.putParams(ps)
+				}
+			}
+			if timing != nil {
+				timing.routed()
+			}
 
 			// 将 Params 切片放回 pool。
 			// 确保即使处理程序 panic，Params 也能被回收。
 			if psPtr != nil {
-				defer r.putParams(psPtr)
+				defer t.putParams(psPtr)
 			}
 
 			if handle != nil {
@@ -964,76 +2526,87 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				if psPtr != nil {
 					params = *psPtr
 				}
+				if r.DecodeParams {
+					decodeParams(params)
+				}
 
 				// 将 Params (切片的值) 存储到请求的 context 中
-				if len(params) > 0 {
+				if len(params) > 0 || r.AlwaysStoreParams {
+					stored := params
+					if stored == nil {
+						stored = Params{} // 使 ParamsFromContext 返回非 nil 的值
+					}
 					// 使用 request.Context() 而不是 req.Context()，因为中间件可能更新了 request 的 context
 					ctx := request.Context()
-					ctx = context.WithValue(ctx, ParamsKey, params)
+					ctx = r.withParams(ctx, stored)
 					request = request.WithContext(ctx) // 更新 request 以携带新的 context
 				}
 
-				// 调用路由处理程序
-				handle(writer, request, params) // request 包含了更新后的上下文
-				return
-			} else if request.Method != http.MethodConnect && currentPath != "/" {
-				code := http.StatusMovedPermanently // 301
-				if request.Method != http.MethodGet {
-					code = http.StatusPermanentRedirect // 308
+				// 记录匹配到的路由模式，即注册时记录在 trie 树中的模式
+				if r.StoreRoutePattern || len(r.PostMatchMiddlewares) > 0 {
+					pattern := root.matchedFoldedPattern(routePath, matchPath)
+					request = request.WithContext(context.WithValue(request.Context(), matchedPatternKey{}, pattern))
 				}
 
-				if tsr && r.RedirectTrailingSlash {
-					// 创建一个新的 URL 对象进行重定向，避免修改原始请求的 URL 指针
-					redirectURL := *request.URL
-					if len(currentPath) > 1 && currentPath[len(currentPath)-1] == '/' {
-						redirectURL.Path = currentPath[:len(currentPath)-1]
-					} else {
-						redirectURL.Path = currentPath + "/"
+				// 存在匹配后中间件时，由它们包裹匹配到的处理程序
+				if len(r.PostMatchMiddlewares) > 0 {
+					var matched http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+						handle(w, req, params)
+					})
+					for i := len(r.PostMatchMiddlewares) - 1; i >= 0; i-- {
+						matched = r.PostMatchMiddlewares[i](matched)
 					}
-					http.Redirect(writer, request, redirectURL.String(), code)
+					matched.ServeHTTP(writer, request)
 					return
 				}
 
-				if r.RedirectFixedPath {
-					fixedPath, found := root.findCaseInsensitivePath(
-						CleanPath(currentPath),
-						r.RedirectTrailingSlash,
-					)
-					if found {
-						redirectURL := *request.URL
-						redirectURL.Path = fixedPath
-						http.Redirect(writer, request, redirectURL.String(), code)
-						return
+				// 调用路由处理程序
+				handle(writer, request, params) // request 包含了更新后的上下文
+				return
+			} else if target, ok := r.redirectTarget(root, method, matchPath, tsr); ok {
+				// 创建一个新的 URL 对象进行重定向，避免修改原始请求的 URL 指针
+				redirectURL := *request.URL
+				redirectURL.Path = target
+				if r.DecodeParams {
+					// target 是编码形式，保留其中的 %2F 等编码，不让它们在重定向后变成路径分隔符
+					redirectURL.RawPath = target
+					if p, err := url.PathUnescape(target); err == nil {
+						redirectURL.Path = p
 					}
 				}
+				http.Redirect(writer, request, redirectURL.String(), r.redirectStatus(method))
+				return
 			}
 		}
 
-		if request.Method == http.MethodOptions && r.HandleOPTIONS {
-			if allow := r.allowed(currentPath, http.MethodOptions); allow != "" {
-				writer.Header().Set("Allow", allow)
-				if r.GlobalOPTIONS != nil {
-					r.GlobalOPTIONS.ServeHTTP(writer, request)
-				} else {
-					writer.WriteHeader(http.StatusOK)
-				}
+		if timing != nil {
+			timing.routed()
+		}
+
+		// 路由器没有为该方法注册任何路由（例如自定义的动词）
+		if r.UnknownMethodStatus != 0 && t.trees[method] == nil &&
+			!(method == http.MethodOptions && r.HandleOPTIONS) {
+			r.serveUnknownMethod(writer, request, t, matchPath)
+			return
+		}
+
+		if method == http.MethodOptions && r.HandleOPTIONS {
+			if allow := r.allowedIn(t, matchPath, http.MethodOptions); allow != "" {
+				r.serveAutoOPTIONS(writer, request, t, matchPath, allow)
 				return
 			}
 		} else if r.HandleMethodNotAllowed {
-			if allow := r.allowed(currentPath, request.Method); allow != "" {
-				writer.Header().Set("Allow", allow)
-				if r.MethodNotAllowed != nil {
-					r.MethodNotAllowed.ServeHTTP(writer, request)
-				} else if r.errorHandler != nil {
-					r.errorHandler(writer, request, http.StatusMethodNotAllowed)
-				} else {
-					defaultErrorHandler(writer, request, http.StatusMethodNotAllowed)
-				}
+			if allow := r.allowedIn(t, matchPath, method); allow != "" {
+				r.serveMethodNotAllowed(writer, request, allow)
 				return
 			}
 		}
 
-		if r.ServeUnmatchedAsStatic && r.FileSystemForUnmatched != nil {
+		defaultHandle := r.defaultFor(method)
+
+		if r.ServeUnmatchedAsStatic && r.FileSystemForUnmatched != nil &&
+			(r.UnmatchedStaticFilter == nil || r.UnmatchedStaticFilter(request)) &&
+			(defaultHandle == nil || staticFileExists(r.FileSystemForUnmatched, currentPath)) {
 			// 确保 req.URL.Path 是原始的，如果中间件没有修改它的话。
 			// fileServer 应该基于原始请求路径查找文件。
 			// 注意：如果中间件修改了 req.URL.Path，这里的行为可能需要调整。
@@ -1041,6 +2614,9 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			// 或者，如果需要，可以传递原始的 path 变量。
 			// 为简单起见，我们使用 request.URL.Path，它可能已被中间件修改。
 			fileServer := http.FileServer(r.FileSystemForUnmatched)
+			if r.StaticContextAware {
+				fileServer = http.FileServer(contextFileSystem{fs: r.FileSystemForUnmatched, ctx: request.Context()})
+			}
 
 			// 重要的上下文考虑：如果 FileSystemForUnmatched 是一个实现了 Context-aware ServeHTTP 的 http.FileSystem,
 			// 那么 request.Context() 会被正确使用。
@@ -1050,32 +2626,35 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			// req.Context().Done() 主要用于应用层取消长时间操作。
 			//fileServer.ServeHTTP(writer, request)
 
-			if !r.isDefaultErrorHandlerUsed { // 使用布尔标记判断
-				// 用户设置了自定义错误处理器
-				// 传递 r.errorHandler 给包装器
-				ecw := newErrorCapturingResponseWriter(writer, request, r.errorHandler)
-				fileServer.ServeHTTP(ecw, request)
-				ecw.processAfterFileServer()
-			} else {
-				// 用户使用的是默认错误处理器
-				fileServer.ServeHTTP(writer, request)
-			}
+			// 文件服务器的错误回复与 ServeFiles 相同，交给 NotFound 或错误处理器
+			r.serveStatic(writer, request, request, fileServer)
 			return
 		}
 
-		if r.NotFound != nil {
-			r.NotFound.ServeHTTP(writer, request)
-		} else if r.errorHandler != nil {
-			r.errorHandler(writer, request, http.StatusNotFound)
-		} else {
-			defaultErrorHandler(writer, request, http.StatusNotFound)
-			//http.NotFound(writer, request)
+		if defaultHandle != nil {
+			ps := Params{{Key: DefaultPathParam, Value: currentPath}}
+			request = request.WithContext(r.withParams(request.Context(), ps))
+			defaultHandle(writer, request, ps)
+			return
 		}
+
+		reason := ReasonNotFound
+		if trailingSlash {
+			reason = ReasonTrailingSlash
+		}
+		r.serveNotFound(writer, request, reason)
 	}) // coreRoutingAndHandling http.HandlerFunc 结束
 
 	// 应用全局中间件到核心路由处理逻辑。
 	finalHandler := r.applyMiddleware(coreRoutingAndHandling)
 
+	// 存在全局中间件时，将路由器放入上下文，供本包提供的中间件使用错误处理器。
+	// 使用单独的变量，不重新赋值已被 coreRoutingAndHandling 捕获的 req，避免 req 逃逸到堆上
+	outer := req
+	if len(r.Middlewares) > 0 {
+		outer = r.withRouter(req)
+	}
+
 	// 执行完整的处理链（中间件 + 核心逻辑）
-	finalHandler.ServeHTTP(w, req)
+	finalHandler.ServeHTTP(w, outer)
 }
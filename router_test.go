@@ -5,12 +5,22 @@
 package httprouter
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 type mockResponseWriter struct{}
@@ -261,6 +271,72 @@ func BenchmarkAllowed(b *testing.B) {
 	})
 }
 
+func BenchmarkRouterMethodNotAllowed(b *testing.B) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch} {
+		router.Handle(method, "/path/:id", handlerFunc)
+	}
+
+	w := new(mockResponseWriter)
+	b.Run("OPTIONS", func(b *testing.B) {
+		r, _ := http.NewRequest(http.MethodOptions, "/path/1", nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			router.ServeHTTP(w, r)
+		}
+	})
+	b.Run("405", func(b *testing.B) {
+		r, _ := http.NewRequest(http.MethodDelete, "/path/1", nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			router.ServeHTTP(w, r)
+		}
+	})
+}
+
+func TestRouterAllowedCache(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	if allow := router.allowed("/path", http.MethodDelete); allow != "GET, OPTIONS" {
+		t.Fatalf("unexpected Allow value: %q", allow)
+	}
+
+	// registering a route must invalidate the cached value
+	router.POST("/path", handlerFunc)
+	if allow := router.allowed("/path", http.MethodDelete); allow != "GET, OPTIONS, POST" {
+		t.Fatalf("stale Allow value after registration: %q", allow)
+	}
+
+	router.HandleOPTIONS = false
+	if allow := router.allowed("/path", http.MethodDelete); allow != "GET, POST" {
+		t.Fatalf("stale Allow value after disabling HandleOPTIONS: %q", allow)
+	}
+
+	// arbitrary paths are bounded per shard and do not evict a hot path
+	// from the other shards; long paths are not cached at all
+	const limit = allowedCacheShards * allowedCacheShardSize
+	for i := 0; i < 4*limit; i++ {
+		router.allowed("/unknown/"+fmt.Sprint(i), http.MethodGet)
+		router.allowed("/path", http.MethodDelete)
+	}
+	if n := router.liveTable().allowedCache.len(); n > limit {
+		t.Fatalf("allowed cache grew beyond its limit: %d entries", n)
+	}
+	key := allowedCacheKey{path: "/path", reqMethod: http.MethodDelete, handleOPTIONS: false}
+	if allow, ok := router.liveTable().allowedCache.get(key); !ok || allow != "GET, POST" {
+		t.Errorf("hot path evicted: %q %v", allow, ok)
+	}
+	router.liveTable().clearAllowedCache()
+	router.allowed("/"+strings.Repeat("x", allowedCacheMaxPath), http.MethodGet)
+	if n := router.liveTable().allowedCache.len(); n != 0 {
+		t.Errorf("long path cached: %d entries", n)
+	}
+}
+
 func TestRouterOPTIONS(t *testing.T) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
 
@@ -471,6 +547,38 @@ func TestRouterNotFound(t *testing.T) {
 	}
 }
 
+func TestRouterTrackClosestMatch(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	var closest string
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		closest = ClosestMatchFromContext(req.Context())
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/5/posts", nil)
+	router.ServeHTTP(w, r)
+	if closest != "" {
+		t.Errorf("closest match set without TrackClosestMatch: %q", closest)
+	}
+
+	router.TrackClosestMatch = true
+	for path, want := range map[string]string{
+		"/users/5/posts": "/users/5",
+		"/user":          "",
+	} {
+		closest = "unset"
+		w = httptest.NewRecorder()
+		r, _ = http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound || closest != want {
+			t.Errorf("%s: want 404 with closest match %q, got %d with %q", path, want, w.Code, closest)
+		}
+	}
+}
+
 func TestRouterPanicHandler(t *testing.T) {
 	router := New()
 	panicHandled := false
@@ -499,6 +607,132 @@ func TestRouterPanicHandler(t *testing.T) {
 	}
 }
 
+// hijackRecorder is a ResponseRecorder supporting Hijack which counts the
+// writes made after the connection was hijacked.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked    bool
+	lateWrites  int
+	client, srv net.Conn
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	h.client, h.srv = net.Pipe()
+	return h.srv, bufio.NewReadWriter(bufio.NewReader(h.srv), bufio.NewWriter(h.srv)), nil
+}
+
+func (h *hijackRecorder) WriteHeader(code int) {
+	if h.hijacked {
+		h.lateWrites++
+	}
+	h.ResponseRecorder.WriteHeader(code)
+}
+
+func (h *hijackRecorder) Write(p []byte) (int, error) {
+	if h.hijacked {
+		h.lateWrites++
+	}
+	return h.ResponseRecorder.Write(p)
+}
+
+func TestRouterPanicAfterHijack(t *testing.T) {
+	router := New()
+	router.GET("/ws", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Fatalf("hijack failed: %v", err)
+		}
+		defer conn.Close()
+		panic("connection handler failed")
+	})
+	serve := func() *hijackRecorder {
+		w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+		r, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// without RecoveryHandler the default 500 reply is skipped
+	if w := serve(); !w.hijacked || w.lateWrites != 0 {
+		t.Errorf("error reply written after hijack: %d writes", w.lateWrites)
+	}
+
+	var recovered interface{}
+	router.RecoveryHandler = func(w http.ResponseWriter, _ *http.Request, rcv interface{}) {
+		recovered = rcv
+		http.Error(w, "panic", http.StatusInternalServerError)
+	}
+	var status int
+	router.OnResponse = func(_ *http.Request, s int, _ int, _ time.Duration) {
+		status = s
+	}
+	if w := serve(); w.lateWrites != 0 {
+		t.Errorf("RecoveryHandler reply written after hijack: %d writes", w.lateWrites)
+	}
+	if recovered != "connection handler failed" {
+		t.Errorf("RecoveryHandler not called after hijack: %v", recovered)
+	}
+	if status != http.StatusSwitchingProtocols {
+		t.Errorf("OnResponse: want 101 for a hijacked connection, got %d", status)
+	}
+}
+
+// headerCountingRecorder is a ResponseRecorder counting WriteHeader calls.
+type headerCountingRecorder struct {
+	*httptest.ResponseRecorder
+	headers int
+}
+
+func (h *headerCountingRecorder) WriteHeader(code int) {
+	h.headers++
+	h.ResponseRecorder.WriteHeader(code)
+}
+
+func TestRouterPanicAfterPartialResponse(t *testing.T) {
+	router := New()
+	router.GET("/stream", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("stream failed")
+	})
+	router.GET("/implicit", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("partial"))
+		panic("stream failed")
+	})
+	router.GET("/early", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusEarlyHints)
+		panic("failed before the response")
+	})
+	serve := func(path string) *headerCountingRecorder {
+		w := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, path := range []string{"/stream", "/implicit"} {
+		if w := serve(path); w.Code != http.StatusOK || w.Body.String() != "partial" || w.headers > 1 {
+			t.Errorf("%s: partial response corrupted: %d %q (%d WriteHeader calls)", path, w.Code, w.Body.String(), w.headers)
+		}
+	}
+	// informational responses do not start the response
+	if w := serve("/early"); w.headers != 2 || w.Body.String() == "" {
+		t.Errorf("/early: want an error reply after 1xx, got %d WriteHeader calls and %q", w.headers, w.Body.String())
+	}
+
+	var recovered interface{}
+	router.RecoveryHandler = func(w http.ResponseWriter, _ *http.Request, rcv interface{}) {
+		recovered = rcv
+		http.Error(w, "panic", http.StatusInternalServerError)
+	}
+	if w := serve("/stream"); w.Code != http.StatusOK || w.headers != 1 || recovered != "stream failed" {
+		t.Errorf("RecoveryHandler: %d (%d WriteHeader calls), recovered %v", w.Code, w.headers, recovered)
+	}
+}
+
 func TestRouterLookup(t *testing.T) {
 	routed := false
 	wantHandle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
@@ -565,6 +799,82 @@ func TestRouterLookup(t *testing.T) {
 	}
 }
 
+func TestRouterLookupPattern(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/users/:id", h)
+	router.GET("/files/:name?", h)
+	router.GET("/media/*path(*.mp4)", h)
+	router.Group("/api").Group("/v1").GET("/items/:item", h)
+
+	for _, tc := range []struct {
+		path, pattern string
+		params        Params
+	}{
+		{"/users/42", "/users/:id", Params{{"id", "42"}}},
+		{"/files", "/files/:name?", nil},
+		{"/files/a.txt", "/files/:name?", Params{{"name", "a.txt"}}},
+		{"/media/a/b.mp4", "/media/*path(*.mp4)", Params{{"path", "/a/b.mp4"}}},
+		{"/api/v1/items/7", "/api/v1/items/:item", Params{{"item", "7"}}},
+	} {
+		handle, ps, pattern, _ := router.LookupPattern(http.MethodGet, tc.path)
+		if handle == nil || pattern != tc.pattern || !reflect.DeepEqual(ps, tc.params) {
+			t.Errorf("%s: want %q %v, got %q %v (handle %t)", tc.path, tc.pattern, tc.params, pattern, ps, handle != nil)
+		}
+	}
+
+	ci := New()
+	ci.CaseInsensitive = true
+	ci.GET("/Users/:ID", h)
+	if handle, ps, pattern, _ := ci.LookupPattern(http.MethodGet, "/USERS/Gopher"); handle == nil || pattern != "/Users/:ID" || ps.ByName("ID") != "Gopher" {
+		t.Errorf("CaseInsensitive: want %q, got %q %v (handle %t)", "/Users/:ID", pattern, ps, handle != nil)
+	}
+
+	if handle, _, pattern, tsr := router.LookupPattern(http.MethodGet, "/users/42/"); handle != nil || pattern != "" || !tsr {
+		t.Errorf("trailing slash: want no match with tsr, got %q %t", pattern, tsr)
+	}
+	if handle, _, pattern, _ := router.LookupPattern(http.MethodPost, "/users/42"); handle != nil || pattern != "" {
+		t.Errorf("unregistered method matched %q", pattern)
+	}
+}
+
+func TestRouterLookupInto(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/users/:id/posts/:post", h)
+	router.GET("/static", h)
+
+	var ps Params // grown on first use
+	handle, tsr := router.LookupInto(http.MethodGet, "/users/1/posts/2", &ps)
+	want := Params{{"id", "1"}, {"post", "2"}}
+	if handle == nil || tsr || !reflect.DeepEqual(ps, want) {
+		t.Fatalf("want match with %v, got %v (handle %t, tsr %t)", want, ps, handle != nil, tsr)
+	}
+
+	buf := &ps[:1][0]
+	if handle, _ = router.LookupInto(http.MethodGet, "/users/3/posts/4", &ps); handle == nil || ps.ByName("post") != "4" {
+		t.Fatalf("second lookup: got %v", ps)
+	}
+	if &ps[0] != buf {
+		t.Error("LookupInto must reuse the caller's backing array")
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		router.LookupInto(http.MethodGet, "/users/1/posts/2", &ps)
+	}); allocs != 0 {
+		t.Errorf("want no allocations, got %v", allocs)
+	}
+
+	if handle, _ = router.LookupInto(http.MethodGet, "/static", &ps); handle == nil || len(ps) != 0 {
+		t.Errorf("static route: want match without params, got %v", ps)
+	}
+	if handle, tsr = router.LookupInto(http.MethodGet, "/static/", &ps); handle != nil || !tsr || len(ps) != 0 {
+		t.Errorf("trailing slash: want no match with tsr, got %v (tsr %t)", ps, tsr)
+	}
+	if handle, _ = router.LookupInto(http.MethodPost, "/static", &ps); handle != nil {
+		t.Error("unregistered method matched")
+	}
+}
+
 func TestRouterParamsFromContext(t *testing.T) {
 	routed := false
 
@@ -697,3 +1007,2898 @@ func TestRouterServeFiles(t *testing.T) {
 		t.Error("serving file failed")
 	}
 }
+
+func TestRouterServerTiming(t *testing.T) {
+	router := New()
+	router.GET("/write", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("ok"))
+	})
+	router.GET("/silent", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	// disabled by default
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/write", nil)
+	router.ServeHTTP(w, r)
+	if st := w.Header().Get("Server-Timing"); st != "" {
+		t.Fatalf("unexpected Server-Timing header: %q", st)
+	}
+
+	router.EmitServerTiming = true
+	for _, path := range []string{"/write", "/silent", "/missing"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		st := w.Header().Values("Server-Timing")
+		if len(st) != 1 || !strings.HasPrefix(st[0], "route;dur=") || !strings.Contains(st[0], ", handler;dur=") {
+			t.Errorf("%s: unexpected Server-Timing header: %q", path, st)
+		}
+	}
+
+	// the header must not break responses started by an outer middleware
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			next.ServeHTTP(w, r)
+		})
+	})
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/write", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot || w.Body.String() != "ok" {
+		t.Fatalf("response corrupted: code=%d body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestRouteWhenContentLengthOver(t *testing.T) {
+	router := New()
+	var handled string
+	router.POST("/upload/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		handled = "sync:" + ps.ByName("name")
+	}).WhenContentLengthOver(4, func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		handled = "async:" + ps.ByName("name")
+	})
+
+	tests := []struct {
+		body          string
+		contentLength int64
+		want          string
+	}{
+		{"abc", 3, "sync:f"},
+		{"abcd", 4, "sync:f"},
+		{"abcde", 5, "async:f"},
+		{"abc", -1, "async:f"}, // unknown length is treated as over the limit
+	}
+	for _, tt := range tests {
+		handled = ""
+		r, _ := http.NewRequest(http.MethodPost, "/upload/f", strings.NewReader(tt.body))
+		r.ContentLength = tt.contentLength
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if handled != tt.want {
+			t.Errorf("Content-Length %d: want %q, got %q", tt.contentLength, tt.want, handled)
+		}
+	}
+}
+
+func TestRouterCaseInsensitive(t *testing.T) {
+	router := New()
+	router.CaseInsensitive = true
+	router.GET("/Users/:ID/Posts/:PostID", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte(ps.ByName("ID") + "," + ps.ByName("PostID")))
+	})
+	router.GET("/Files/*Name(*.PDF)", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte("pdf " + ps.ByName("Name")))
+	})
+	router.GET("/Codes/:code([A-Z]+)", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte("code " + ps.ByName("code")))
+	})
+	router.GET("/Über", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("über"))
+	})
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/users/AbC/posts/XyZ", http.StatusOK, "AbC,XyZ"},
+		{http.MethodGet, "/USERS/AbC/POSTS/XyZ", http.StatusOK, "AbC,XyZ"},
+		{http.MethodGet, "/Users/abc/Posts/xyz", http.StatusOK, "abc,xyz"},
+		{http.MethodGet, "/files/Docs/Report.pdf", http.StatusOK, "pdf /Docs/Report.pdf"},
+		{http.MethodGet, "/FILES/a.PdF", http.StatusOK, "pdf /a.PdF"},
+		{http.MethodGet, "/codes/ABC", http.StatusOK, "code ABC"},
+		{http.MethodGet, "/codes/abc", http.StatusNotFound, ""},
+		{http.MethodGet, "/ÜBER", http.StatusOK, "über"},
+		{http.MethodPost, "/users/1/posts/2", http.StatusMethodNotAllowed, ""},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tc.method, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s %s: want %d %q, got %d %q", tc.method, tc.path, tc.code, tc.body, w.Code, w.Body.String())
+		}
+	}
+
+	if _, ps, _ := router.Lookup(http.MethodGet, "/uSeRs/Q/pOsTs/W"); ps.ByName("ID") != "Q" || ps.ByName("PostID") != "W" {
+		t.Errorf("Lookup: wrong params %v", ps)
+	}
+	if recv := catchPanic(func() {
+		router.GET("/users/:ID/posts/:PostID", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	}); recv == nil {
+		t.Error("registering a route differing only in case did not panic")
+	}
+	if !router.RemoveRoute(http.MethodGet, "/Über") {
+		t.Error("route not removed by its registered pattern")
+	}
+}
+
+func TestRouterDrain(t *testing.T) {
+	router := New()
+	router.DrainAllowedPaths = []string{"/healthz"}
+
+	// rejected requests skip the middleware chain and PreHandler
+	var middlewareCalls, preHandlerCalls atomic.Int32
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewareCalls.Add(1)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.PreHandler = func(http.ResponseWriter, *http.Request) bool {
+		preHandlerCalls.Add(1)
+		return true
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router.GET("/slow", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	router.GET("/fast", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/healthz", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	slow := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		r, _ := http.NewRequest(http.MethodGet, "/slow", nil)
+		router.ServeHTTP(slow, r)
+		close(finished)
+	}()
+	<-started
+
+	router.BeginDrain()
+	if router.IsAccepting() {
+		t.Fatal("router still accepting after BeginDrain")
+	}
+	if n := router.InFlight(); n != 1 {
+		t.Fatalf("wrong in-flight count: want 1, got %d", n)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/fast", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+		t.Errorf("new request during drain: want 503 with Retry-After 5, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if middlewareCalls.Load() != 1 || preHandlerCalls.Load() != 1 {
+		t.Errorf("drain reply ran middleware %d times and PreHandler %d times, want only the in-flight request",
+			middlewareCalls.Load(), preHandlerCalls.Load())
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/healthz", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("allowed path during drain: want 200, got %d", w.Code)
+	}
+
+	close(release)
+	<-finished
+	if slow.Code != http.StatusOK || slow.Body.String() != "done" {
+		t.Errorf("in-flight request was not completed: code=%d body=%q", slow.Code, slow.Body.String())
+	}
+	if n := router.InFlight(); n != 0 {
+		t.Errorf("wrong in-flight count after drain: want 0, got %d", n)
+	}
+
+	router.EndDrain()
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/fast", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("request after EndDrain: want 200, got %d", w.Code)
+	}
+
+	// StopAccepting and ResumeAccepting are aliases of BeginDrain and EndDrain
+	router.StopAccepting()
+	if router.IsAccepting() {
+		t.Error("router still accepting after StopAccepting")
+	}
+	router.ResumeAccepting()
+	if !router.IsAccepting() {
+		t.Error("router not accepting after ResumeAccepting")
+	}
+}
+
+func TestRouterOnResponse(t *testing.T) {
+	router := New()
+	router.GET("/ok", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("ok"))
+	})
+	router.GET("/empty", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops")
+	})
+
+	var requests []string
+	router.OnRequest = func(r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	}
+	var gotStatus, gotBytes int
+	var gotReq *http.Request
+	router.OnResponse = func(r *http.Request, status int, bytes int, dur time.Duration) {
+		gotReq, gotStatus, gotBytes = r, status, bytes
+		if dur < 0 {
+			t.Errorf("negative duration %v", dur)
+		}
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/ok", http.StatusOK},
+		{http.MethodGet, "/empty", http.StatusOK},
+		{http.MethodGet, "/missing", http.StatusNotFound},
+		{http.MethodDelete, "/ok", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/ok/", http.StatusMovedPermanently},
+		{http.MethodGet, "/panic", http.StatusInternalServerError},
+	} {
+		gotReq, gotStatus, gotBytes = nil, 0, -1
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tc.method, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if gotReq != r || gotStatus != tc.status || gotStatus != w.Code || gotBytes != w.Body.Len() {
+			t.Errorf("%s %s: OnResponse got status %d, %d bytes; response %d, %d bytes",
+				tc.method, tc.path, gotStatus, gotBytes, w.Code, w.Body.Len())
+		}
+	}
+	if len(requests) != 6 || requests[3] != "DELETE /ok" {
+		t.Errorf("OnRequest not called once per request: %v", requests)
+	}
+}
+
+func TestRouterDrainConcurrent(t *testing.T) {
+	const inFlight = 8
+	router := New()
+	router.RetryAfter = 5 * time.Second
+	router.DrainExempt = func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/probe/")
+	}
+	var started sync.WaitGroup
+	started.Add(inFlight)
+	release := make(chan struct{})
+	router.GET("/slow", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		started.Done()
+		<-release
+		w.Write([]byte("done"))
+	})
+	router.GET("/fast", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/probe/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	var slow sync.WaitGroup
+	codes := make(chan int, inFlight)
+	for i := 0; i < inFlight; i++ {
+		slow.Add(1)
+		go func() {
+			defer slow.Done()
+			codes <- serve("/slow").Code
+		}()
+	}
+	started.Wait()
+	router.BeginDrain()
+
+	// new requests arriving while the slow ones are still running
+	var fresh sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		fresh.Add(1)
+		go func(i int) {
+			defer fresh.Done()
+			if i%2 == 0 {
+				if w := serve("/fast"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+					t.Errorf("new request during drain: %d %q", w.Code, w.Header().Get("Retry-After"))
+				}
+			} else if w := serve("/probe/lb"); w.Code != http.StatusOK {
+				t.Errorf("exempt request during drain: want 200, got %d", w.Code)
+			}
+		}(i)
+	}
+	fresh.Wait()
+	if n := router.InFlight(); n != inFlight {
+		t.Errorf("wrong in-flight count during drain: want %d, got %d", inFlight, n)
+	}
+
+	close(release)
+	slow.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("in-flight request not completed: %d", code)
+		}
+	}
+	if n := router.InFlight(); n != 0 {
+		t.Errorf("wrong in-flight count after drain: want 0, got %d", n)
+	}
+
+	router.EndDrain()
+	if w := serve("/fast"); w.Code != http.StatusOK || !router.IsAccepting() {
+		t.Errorf("request after EndDrain: want 200, got %d", w.Code)
+	}
+}
+
+func TestRouteSelect(t *testing.T) {
+	router := New()
+	var handled string
+	h := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			handled = name + ":" + ps.ByName("id")
+		}
+	}
+	handlers := map[string]Handle{"v1": h("v1"), "v2": h("v2")}
+	router.GET("/x/:id", h("default")).Select(func(r *http.Request) string {
+		return r.Header.Get("X-Version")
+	}, handlers)
+	handlers["v3"] = h("v3") // must not affect the registered route
+
+	for version, want := range map[string]string{
+		"v1": "v1:7",
+		"v2": "v2:7",
+		"v3": "default:7",
+		"":   "default:7",
+	} {
+		handled = ""
+		r, _ := http.NewRequest(http.MethodGet, "/x/7", nil)
+		r.Header.Set("X-Version", version)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if handled != want {
+			t.Errorf("version %q: want %q, got %q", version, want, handled)
+		}
+	}
+
+	if recv := catchPanic(func() { router.GET("/y", h("y")).Select(nil, nil) }); recv == nil {
+		t.Error("no panic for nil select key function")
+	}
+}
+
+func TestRouteHost(t *testing.T) {
+	router := New()
+	routed := false
+	router.GET("/x", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	}).Host("example.com", "API.example.com:8080")
+
+	for host, want := range map[string]bool{
+		"example.com":      true,
+		"EXAMPLE.com:443":  true,
+		"api.example.com":  true,
+		"other.com":        false,
+		"www.example.com:": false,
+	} {
+		routed = false
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/x", nil)
+		r.Host = host
+		router.ServeHTTP(w, r)
+		if routed != want {
+			t.Errorf("host %q: want routed=%v, got %v", host, want, routed)
+		}
+		if !want && w.Code != http.StatusNotFound {
+			t.Errorf("host %q: want 404, got %d", host, w.Code)
+		}
+	}
+
+	router.MisdirectedHostHandling = true
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/x", nil)
+	r.Host = "other.com"
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMisdirectedRequest {
+		t.Errorf("misdirected host: want 421, got %d", w.Code)
+	}
+}
+
+func TestRouterPreHandler(t *testing.T) {
+	router := New()
+	var order []string
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "middleware")
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.GET("/x", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		order = append(order, "handle")
+	})
+
+	maintenance := false
+	router.PreHandler = func(w http.ResponseWriter, r *http.Request) bool {
+		order = append(order, "pre")
+		if maintenance {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return false
+		}
+		return true
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/x", nil)
+	router.ServeHTTP(w, r)
+	if want := []string{"middleware", "pre", "handle"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("wrong execution order: want %v, got %v", want, order)
+	}
+
+	order = nil
+	maintenance = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if want := []string{"middleware", "pre"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("PreHandler did not short-circuit: want %v, got %v", want, order)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want 503, got %d", w.Code)
+	}
+}
+
+func TestRouterOPTIONSRouteMiddleware(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	cors := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	router := New()
+	api := router.Group("/api")
+	api.Use(cors)
+	api.GET("/users/:id", handlerFunc)
+	api.POST("/users/:id", handlerFunc)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodOptions, "/api/users/1", nil)
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("group middleware ran for preflight without OPTIONSRouteMiddleware: %q", got)
+	}
+
+	router.OPTIONSRouteMiddleware = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("preflight: want 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, OPTIONS, POST" {
+		t.Errorf("unexpected Allow header: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("CORS header missing on preflight: %q", got)
+	}
+}
+
+func TestRouterANYAtomic(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.ANY("/x", handlerFunc)
+	// conflicts only in the PUT tree
+	router.PUT("/y/:id", handlerFunc)
+
+	recv := catchPanic(func() {
+		router.ANY("/y/new", handlerFunc)
+	})
+	if recv == nil {
+		t.Fatal("no panic for conflicting ANY registration")
+	}
+	for _, method := range DefaultMethodsForAny {
+		if method == http.MethodPut {
+			continue // matched by /y/:id
+		}
+		if handle, _, _ := router.Lookup(method, "/y/new"); handle != nil {
+			t.Errorf("%s /y/new was registered although ANY panicked", method)
+		}
+	}
+	if allow := router.allowed("/y/new", ""); allow != "OPTIONS, PUT" {
+		t.Errorf("partially registered ANY route is allowed for: %q", allow)
+	}
+
+	// the same holds for groups, whose routes are marked as grouped together with the registration
+	api := router.Group("/api")
+	router.PUT("/api/y/:id", handlerFunc)
+	if recv := catchPanic(func() { api.ANY("/y/new", handlerFunc) }); recv == nil {
+		t.Fatal("no panic for conflicting group ANY registration")
+	}
+	if handle, _, _ := router.Lookup(http.MethodGet, "/api/y/new"); handle != nil {
+		t.Error("GET /api/y/new was registered although the group ANY panicked")
+	}
+	api.ANY("/z", handlerFunc)
+	for _, ri := range router.Routes() {
+		if ri.Path == "/api/z" && !ri.Grouped {
+			t.Errorf("%s /api/z registered through the group is not marked as grouped", ri.Method)
+		}
+	}
+
+	// the conflicting path is still free to be registered for other methods
+	router.GET("/y/new", handlerFunc)
+}
+
+func TestRouterMatch(t *testing.T) {
+	var handled string
+	handlerFunc := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		handled = r.Method
+	}
+
+	router := New()
+	var registered []string
+	router.OnRegister = func(method, path string) {
+		registered = append(registered, method+" "+path)
+	}
+	router.Match([]string{http.MethodPost, http.MethodGet, http.MethodPost}, "/search", handlerFunc)
+	if !reflect.DeepEqual(registered, []string{"POST /search", "GET /search"}) {
+		t.Errorf("duplicate methods registered: %v", registered)
+	}
+	if allow := router.allowed("/search", ""); allow != "GET, OPTIONS, POST" {
+		t.Errorf("wrong allowed methods: %q", allow)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		handled = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, "/search", nil)
+		router.ServeHTTP(w, r)
+		if handled != method {
+			t.Errorf("%s /search not handled", method)
+		}
+	}
+
+	var mwCalls int
+	api := router.Group("/api")
+	api.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mwCalls++
+			next.ServeHTTP(w, r)
+		})
+	})
+	api.Match([]string{http.MethodPut, http.MethodPatch}, "/items/:id", handlerFunc)
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPatch, "/api/items/1", nil)
+	router.ServeHTTP(w, r)
+	if handled != http.MethodPatch || mwCalls != 1 {
+		t.Errorf("group route not handled through group middleware: %q, %d calls", handled, mwCalls)
+	}
+	if allow := router.allowed("/api/items/1", ""); allow != "OPTIONS, PATCH, PUT" {
+		t.Errorf("wrong allowed methods for group route: %q", allow)
+	}
+
+	// conflicts panic before anything is registered
+	router.PUT("/y/:id", handlerFunc)
+	if recv := catchPanic(func() {
+		router.Match([]string{http.MethodGet, http.MethodPut}, "/y/new", handlerFunc)
+	}); recv == nil {
+		t.Error("no panic for conflicting Match registration")
+	}
+	if handle, _, _ := router.Lookup(http.MethodGet, "/y/new"); handle != nil {
+		t.Error("GET /y/new was registered although Match panicked")
+	}
+
+	for _, methods := range [][]string{nil, {http.MethodGet, ""}} {
+		if recv := catchPanic(func() { router.Match(methods, "/z", handlerFunc) }); recv == nil {
+			t.Errorf("no panic for methods %q", methods)
+		}
+	}
+}
+
+func TestRouterAnyMethods(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	def := New()
+	def.ANY("/any", handlerFunc)
+	custom := New()
+	custom.AnyMethods = []string{http.MethodGet, "PROPFIND"}
+	custom.ANY("/any", handlerFunc)
+	custom.Group("/g").ANY("/any", handlerFunc)
+
+	if allow := def.allowed("/any", ""); allow != "DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT" {
+		t.Errorf("default router: wrong allowed methods %q", allow)
+	}
+	for _, path := range []string{"/any", "/g/any"} {
+		if allow := custom.allowed(path, ""); allow != "GET, OPTIONS, PROPFIND" {
+			t.Errorf("custom router %s: wrong allowed methods %q", path, allow)
+		}
+	}
+	for _, route := range custom.Routes() {
+		if route.Path == "/g/any" && !route.Grouped {
+			t.Errorf("%s %s not marked as grouped", route.Method, route.Path)
+		}
+	}
+
+	custom.AnyMethods = []string{}
+	if recv := catchPanic(func() { custom.ANY("/empty", handlerFunc) }); recv == nil {
+		t.Error("no panic for empty AnyMethods")
+	}
+}
+
+func TestRouterOnRegister(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	var registered []string
+	router.OnRegister = func(method, path string) {
+		registered = append(registered, method+" "+path)
+	}
+
+	router.GET("/a", handlerFunc)
+	router.Group("/api").POST("/users", handlerFunc)
+	router.ServeFiles("/static/*filepath", http.Dir("."))
+	catchPanic(func() { router.GET("/a", handlerFunc) }) // duplicate, must not be reported
+
+	want := []string{"GET /a", "POST /api/users", "GET /static/*filepath"}
+	if !reflect.DeepEqual(registered, want) {
+		t.Errorf("wrong registrations: want %v, got %v", want, registered)
+	}
+}
+
+func TestRouterSetErrorHandlerFor(t *testing.T) {
+	router := New()
+	router.GET("/x", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	router.SetErrorHandlerFor(http.StatusNotFound, func(w http.ResponseWriter, _ *http.Request, code int) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write([]byte(`{"error":"not found"}`))
+	})
+	if !router.IsUsingDefaultErrorHandler() {
+		t.Error("per-status handler must not affect IsUsingDefaultErrorHandler")
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/missing", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || w.Body.String() != `{"error":"not found"}` {
+		t.Errorf("404 handler not used: code=%d body=%q", w.Code, w.Body.String())
+	}
+
+	// other codes fall back to the general handler
+	var general int
+	router.SetErrorHandler(func(w http.ResponseWriter, _ *http.Request, code int) {
+		general = code
+		w.WriteHeader(code)
+	})
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/x", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || general != http.StatusMethodNotAllowed {
+		t.Errorf("general handler not used for 405: code=%d general=%d", w.Code, general)
+	}
+
+	// removing the per-status handler restores the general one
+	router.SetErrorHandlerFor(http.StatusNotFound, nil)
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/missing", nil)
+	router.ServeHTTP(w, r)
+	if general != http.StatusNotFound {
+		t.Errorf("general handler not used after removal, got %d", general)
+	}
+}
+
+func TestRouterParamsContextInterop(t *testing.T) {
+	type foreignKey struct{}
+	type varsKey struct{}
+
+	router := New()
+	router.ParamsContextKeys = []interface{}{foreignKey{}}
+	router.ParamsEncoder = func(ctx context.Context, ps Params) context.Context {
+		vars := make(map[string]string, len(ps))
+		for _, p := range ps {
+			vars[p.Key] = p.Value
+		}
+		return context.WithValue(ctx, varsKey{}, vars)
+	}
+
+	check := func(r *http.Request) {
+		if ps := ParamsFromContext(r.Context()); ps.ByName("id") != "42" {
+			t.Errorf("%s: params missing under ParamsKey", r.URL.Path)
+		}
+		if ps, _ := r.Context().Value(foreignKey{}).(Params); ps.ByName("id") != "42" {
+			t.Errorf("%s: params missing under additional key", r.URL.Path)
+		}
+		if vars, _ := r.Context().Value(varsKey{}).(map[string]string); vars["id"] != "42" {
+			t.Errorf("%s: params missing from encoder", r.URL.Path)
+		}
+	}
+
+	router.GET("/handle/:id", func(_ http.ResponseWriter, r *http.Request, _ Params) { check(r) })
+	router.Handler(http.MethodGet, "/handler/:id", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { check(r) }))
+	router.Group("/group").Handler(http.MethodGet, "/:id", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { check(r) }))
+
+	for _, path := range []string{"/handle/42", "/handler/42", "/group/42"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func TestRouteProduces(t *testing.T) {
+	router := New()
+	router.GET("/json", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte(`{}`))
+	}).Produces("application/json")
+	router.GET("/override", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("a,b"))
+	}).Produces("application/json")
+
+	for path, want := range map[string]string{
+		"/json":     "application/json",
+		"/override": "text/csv",
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Type"); got != want {
+			t.Errorf("%s: want Content-Type %q, got %q", path, want, got)
+		}
+	}
+}
+
+func TestRouterMaxRequestParams(t *testing.T) {
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.GET("/before/:p1/:p2/:p3/:p4", h)
+	router.MaxRequestParams = 3
+	router.GET("/b/:p1/:p2/*rest", h)
+
+	// a deep path captures no more params than its route declares
+	deep := "/b/1/2" + strings.Repeat("/x", 1000)
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, deep, nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("deep path on a route within the limit: want 200, got %d", w.Code)
+	}
+
+	// routes declaring more params are rejected at registration
+	err := router.TryHandle(http.MethodGet, "/a/:p1/:p2/:p3/*rest", h)
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("route above the limit: want ErrInvalidPath, got %v", err)
+	}
+	if recv := catchPanic(func() { router.GET("/c/:p1/:p2/:p3/:p4", h) }); recv == nil {
+		t.Error("registering a route above the limit did not panic")
+	}
+
+	// the limit only applies to routes registered after it was set
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/before/1/2/3/4", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("route registered before the limit: want 200, got %d", w.Code)
+	}
+}
+
+func TestRouterUnknownMethodStatus(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/x", handlerFunc)
+	router.POST("/x", handlerFunc)
+
+	tests := []struct {
+		status int
+		path   string
+		code   int
+		allow  string
+	}{
+		{0, "/x", http.StatusMethodNotAllowed, "GET, OPTIONS, POST"},
+		{0, "/y", http.StatusNotFound, ""},
+		{http.StatusNotFound, "/x", http.StatusNotFound, ""},
+		{http.StatusMethodNotAllowed, "/x", http.StatusMethodNotAllowed, "GET, OPTIONS, POST"},
+		{http.StatusMethodNotAllowed, "/y", http.StatusMethodNotAllowed, "GET, OPTIONS, POST"},
+		{http.StatusNotImplemented, "/x", http.StatusNotImplemented, ""},
+	}
+	for _, tt := range tests {
+		router.UnknownMethodStatus = tt.status
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("BREW", tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Header().Get("Allow") != tt.allow {
+			t.Errorf("status %d, path %s: want %d (Allow %q), got %d (Allow %q)",
+				tt.status, tt.path, tt.code, tt.allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+
+	// known methods and automatic OPTIONS are unaffected
+	router.UnknownMethodStatus = http.StatusNotImplemented
+	for method, code := range map[string]int{
+		http.MethodGet:     http.StatusOK,
+		http.MethodOptions: http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, "/x", nil)
+		router.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("%s: want %d, got %d", method, code, w.Code)
+		}
+	}
+}
+
+func TestRouteCorrelationHeader(t *testing.T) {
+	router := New()
+	router.Use(RequestID(""))
+	router.GET("/a", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).CorrelationHeader("x-correlation-id")
+	router.GET("/b", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/a", nil)
+	r.Header.Set(DefaultRequestIDHeader, "req-1")
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Correlation-ID"); got != "req-1" {
+		t.Errorf("want correlation header %q, got %q", "req-1", got)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/b", nil)
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Correlation-ID"); got != "" {
+		t.Errorf("correlation header set on route without it: %q", got)
+	}
+
+	// without a request ID in the context the header is skipped
+	plain := New()
+	plain.GET("/a", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).CorrelationHeader("X-Correlation-ID")
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/a", nil)
+	plain.ServeHTTP(w, r)
+	if _, ok := w.Header()["X-Correlation-Id"]; ok {
+		t.Error("correlation header set without request ID")
+	}
+}
+
+func TestRouterSwap(t *testing.T) {
+	router := New()
+	router.GET("/old/:id", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("old"))
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// requests in flight keep using the table they started with
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router.GET("/slow", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		close(started)
+		<-release
+		w.Write([]byte("slow"))
+	})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve("/slow") }()
+	<-started
+
+	router.Swap(func(r *Router) {
+		// the old table is still served while building
+		if w := serve("/old/1"); w.Body.String() != "old" {
+			t.Errorf("old route not served during build: %d %q", w.Code, w.Body.String())
+		}
+		r.GET("/new/:a/:b/:c", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+			w.Write([]byte(ps.ByName("a") + ps.ByName("b") + ps.ByName("c")))
+		})
+		r.POST("/new", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	})
+	close(release)
+	if w := <-done; w.Body.String() != "slow" {
+		t.Errorf("in-flight request affected by swap: %d %q", w.Code, w.Body.String())
+	}
+
+	if w := serve("/old/1"); w.Code != http.StatusNotFound {
+		t.Errorf("old route still served after swap: %d", w.Code)
+	}
+	if w := serve("/new/1/2/3"); w.Body.String() != "123" {
+		t.Errorf("new route not served after swap: %d %q", w.Code, w.Body.String())
+	}
+	if w := serve("/new"); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "OPTIONS, POST" {
+		t.Errorf("wrong method not allowed reply after swap: %d %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	// a failing build leaves the live table untouched
+	recv := catchPanic(func() {
+		router.Swap(func(r *Router) {
+			r.GET("/x/:a", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+			r.GET("/x/:b", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+		})
+	})
+	if recv == nil {
+		t.Error("no panic for conflicting routes in swap")
+	}
+	if w := serve("/new/1/2/3"); w.Body.String() != "123" {
+		t.Errorf("live table changed by failed swap: %d %q", w.Code, w.Body.String())
+	}
+	router.GET("/after", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	if w := serve("/after"); w.Code != http.StatusOK {
+		t.Errorf("registration after failed swap not served: %d", w.Code)
+	}
+}
+
+func TestRouterRegisterWhileServing(t *testing.T) {
+	router := New()
+	router.GET("/static", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+	serve(http.MethodGet, "/static")
+
+	// concurrent registrations race neither with each other nor with lookups
+	stop := make(chan struct{})
+	var readers, writers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if w := serve(http.MethodGet, "/static"); w.Code != http.StatusOK {
+					t.Errorf("static route lost during registration: %d", w.Code)
+					return
+				}
+				serve(http.MethodGet, "/plugins/3/x")
+				router.Routes()
+			}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			g := router.Group(fmt.Sprintf("/plugins/%d", i))
+			g.GET("/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+			router.POST(fmt.Sprintf("/hooks/%d", i), func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Name(fmt.Sprintf("hook-%d", i))
+		}(i)
+	}
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	for i := 0; i < 8; i++ {
+		if w := serve(http.MethodGet, fmt.Sprintf("/plugins/%d/x", i)); w.Code != http.StatusOK {
+			t.Errorf("plugin route %d not served: %d", i, w.Code)
+		}
+		if u, err := router.URL(fmt.Sprintf("hook-%d", i)); err != nil || u != fmt.Sprintf("/hooks/%d", i) {
+			t.Errorf("named route %d: %q %v", i, u, err)
+		}
+	}
+	if n := len(router.Routes()); n != 17 {
+		t.Errorf("want 17 routes, got %d", n)
+	}
+
+	// a batch becomes visible at once
+	router.HandleBatch(func(r *Router) {
+		r.GET("/batch/a", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+		if w := serve(http.MethodGet, "/batch/a"); w.Code != http.StatusNotFound {
+			t.Errorf("batch route served before the batch finished: %d", w.Code)
+		}
+		r.GET("/batch/b", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Name("batch-b")
+	})
+	for _, path := range []string{"/batch/a", "/batch/b", "/static"} {
+		if w := serve(http.MethodGet, path); w.Code != http.StatusOK {
+			t.Errorf("%s not served after batch: %d", path, w.Code)
+		}
+	}
+	if u, err := router.URL("batch-b"); err != nil || u != "/batch/b" {
+		t.Errorf("named route in batch: %q %v", u, err)
+	}
+
+	// registrations from other goroutines during a batch land in the batch
+	router.HandleBatch(func(r *Router) {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				router.GET(fmt.Sprintf("/concurrent/%d", i), func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+			}(i)
+			r.GET(fmt.Sprintf("/batch/d/%d", i), func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+		}
+		wg.Wait()
+	})
+	for i := 0; i < 4; i++ {
+		for _, path := range []string{fmt.Sprintf("/concurrent/%d", i), fmt.Sprintf("/batch/d/%d", i)} {
+			if w := serve(http.MethodGet, path); w.Code != http.StatusOK {
+				t.Errorf("%s not served after batch: %d", path, w.Code)
+			}
+		}
+	}
+
+	// a failing batch leaves the live table untouched
+	recv := catchPanic(func() {
+		router.HandleBatch(func(r *Router) {
+			r.GET("/batch/c", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+			r.GET("/batch/a", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+		})
+	})
+	if recv == nil {
+		t.Error("no panic for duplicate route in batch")
+	}
+	if w := serve(http.MethodGet, "/batch/c"); w.Code != http.StatusNotFound {
+		t.Errorf("route from failed batch served: %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/batch/a"); w.Code != http.StatusOK {
+		t.Errorf("live table changed by failed batch: %d", w.Code)
+	}
+}
+
+func TestRouteExcept(t *testing.T) {
+	router := New()
+	router.GET("/*path", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("spa"))
+	}).Except("/api", "/assets/")
+
+	// routes under excluded prefixes can be served by a chained router
+	api := New()
+	api.GET("/api/users", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("users"))
+	})
+	router.NotFound = api
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/", http.StatusOK, "spa"},
+		{"/settings/profile", http.StatusOK, "spa"},
+		{"/apis", http.StatusOK, "spa"},
+		{"/api/users", http.StatusOK, "users"},
+		{"/api", http.StatusNotFound, ""},
+		{"/api/unknown", http.StatusNotFound, ""},
+		{"/assets/app.js", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: want %d %q, got %d %q", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	if recv := catchPanic(func() {
+		router.GET("/plain", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Except("/x")
+	}); recv == nil {
+		t.Error("no panic for Except on a route without catch-all")
+	}
+}
+
+func TestRouterMalformedPath(t *testing.T) {
+	router := New()
+	router.GET("/foo/:name", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte(ps.ByName("name")))
+	})
+
+	serve := func(u *url.URL) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL = u
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// well-formed escaped paths are routed as before
+	if w := serve(&url.URL{Path: "/foo/a/b", RawPath: "/foo/a%2Fb"}); w.Code != http.StatusNotFound {
+		t.Errorf("consistent raw path rejected: %d", w.Code)
+	}
+	if w := serve(&url.URL{Path: "/foo/a b", RawPath: "/foo/a%20b"}); w.Code != http.StatusOK || w.Body.String() != "a b" {
+		t.Errorf("consistent raw path not routed: %d %q", w.Code, w.Body.String())
+	}
+
+	malformed := []*url.URL{
+		{Path: "/foo/bar", RawPath: "/foo/bar%ZZ"},
+		{Path: "/foo/bar", RawPath: "/foo/baz"},
+	}
+	// without a MalformedPathHandler the check is off
+	if w := serve(malformed[0]); w.Code != http.StatusOK || w.Body.String() != "bar" {
+		t.Errorf("check ran without MalformedPathHandler: %d %q", w.Code, w.Body.String())
+	}
+
+	router.MalformedPathHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	for _, u := range malformed {
+		if w := serve(u); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: want 400, got %d", u.RawPath, w.Code)
+		}
+	}
+
+	// middleware rewriting Path without touching RawPath does not trip the check
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, "/v1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	if w := serve(&url.URL{Path: "/v1/foo/a,b", RawPath: "/v1/foo/a%2Cb"}); w.Code != http.StatusOK || w.Body.String() != "a,b" {
+		t.Errorf("path rewritten by middleware rejected: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRouterServerSentEvents(t *testing.T) {
+	router := New()
+	router.EmitServerTiming = true
+	router.Use(MaxResponseBytes(1<<20, ResponseLimitTruncate, nil))
+	router.Use(HardTimeout(10 * time.Second))
+	group := router.Group("/stream")
+	group.Use(func(next http.Handler) http.Handler { return next })
+
+	next := make(chan struct{})
+	group.GET("/events", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Error("response writer does not implement http.Flusher")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			flusher.Flush()
+			if i < 2 {
+				<-next
+			}
+		}
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// each event must arrive before the handler is allowed to write the next one
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < 3; i++ {
+		lines := make(chan string, 1)
+		go func() {
+			line, _ := reader.ReadString('\n')
+			reader.ReadString('\n') // blank line terminating the event
+			lines <- line
+		}()
+		select {
+		case line := <-lines:
+			if want := fmt.Sprintf("data: %d\n", i); line != want {
+				t.Fatalf("want event %q, got %q", want, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d not delivered incrementally", i)
+		}
+		if i < 2 {
+			next <- struct{}{}
+		}
+	}
+}
+
+func TestRouterCustomMethods(t *testing.T) {
+	router := New()
+	var routed string
+	for _, method := range []string{"PROPFIND", "MKCOL"} {
+		method := method
+		router.Handle(method, "/dav/*path", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = method + " " + ps.ByName("path")
+		})
+	}
+	router.GET("/dav/*path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("PROPFIND", "/dav/docs/a.txt", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || routed != "PROPFIND /docs/a.txt" {
+		t.Errorf("custom method not routed: %d %q", w.Code, routed)
+	}
+
+	if handle, ps, _ := router.Lookup("MKCOL", "/dav/new"); handle == nil || ps.ByName("path") != "/new" {
+		t.Error("custom method not found by Lookup")
+	}
+
+	const allow = "GET, MKCOL, OPTIONS, PROPFIND"
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodOptions, "/dav/x", nil)
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("Allow"); got != allow {
+		t.Errorf("OPTIONS: want Allow %q, got %q", allow, got)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodDelete, "/dav/x", nil)
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("Allow"); w.Code != http.StatusMethodNotAllowed || got != allow {
+		t.Errorf("DELETE: want 405 with Allow %q, got %d %q", allow, w.Code, got)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodOptions, "*", nil)
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("Allow"); got != allow {
+		t.Errorf("OPTIONS *: want Allow %q, got %q", allow, got)
+	}
+}
+
+func TestGroupWithValue(t *testing.T) {
+	type ctxKey string
+
+	router := New()
+	tenant := router.Group("/t")
+	tenant.WithValue(ctxKey("tenant"), "acme")
+	tenant.WithValue(ctxKey("plan"), "basic")
+
+	var seenByMiddleware interface{}
+	tenant.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seenByMiddleware = r.Context().Value(ctxKey("tenant"))
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	var got [2]interface{}
+	record := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		got = [2]interface{}{r.Context().Value(ctxKey("tenant")), r.Context().Value(ctxKey("plan"))}
+	}
+	tenant.GET("/info", record)
+
+	premium := tenant.Group("/premium")
+	premium.WithValue(ctxKey("plan"), "premium")
+	premium.GET("/info", record)
+	router.GET("/info", record)
+
+	tests := []struct {
+		path string
+		want [2]interface{}
+	}{
+		{"/t/info", [2]interface{}{"acme", "basic"}},
+		{"/t/premium/info", [2]interface{}{"acme", "premium"}},
+		{"/info", [2]interface{}{nil, nil}},
+	}
+	for _, tt := range tests {
+		got = [2]interface{}{}
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if got != tt.want {
+			t.Errorf("%s: want %v, got %v", tt.path, tt.want, got)
+		}
+	}
+	if seenByMiddleware != "acme" {
+		t.Errorf("group middleware did not see value: %v", seenByMiddleware)
+	}
+}
+
+func TestGroupNested(t *testing.T) {
+	var trace []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := New()
+	router.SaveMatchedRoutePath = true
+	var matched string
+	record := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		matched = ps.MatchedRoutePath()
+	}
+
+	api := router.Group("/api")
+	api.Use(mw("api1"), mw("api2"))
+	api.Use(mw("api3")) // leaves spare capacity in the parent slice
+	v1 := api.Group("/v1/")
+	admin := v1.Group("/admin")
+	admin.Use(mw("admin"))
+	api.Use(mw("api4")) // must neither clobber nor reach the subgroups
+	admin.GET("/users/:id", record)
+	api.GET("/ping", record)
+
+	tests := []struct {
+		path    string
+		trace   string
+		pattern string
+	}{
+		{"/api/v1/admin/users/1", "api1,api2,api3,admin", "/api/v1/admin/users/:id"},
+		{"/api/ping", "api1,api2,api3,api4", "/api/ping"},
+	}
+	for _, tt := range tests {
+		trace, matched = nil, ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status %d", tt.path, w.Code)
+		}
+		if got := strings.Join(trace, ","); got != tt.trace {
+			t.Errorf("%s: want middleware %s, got %s", tt.path, tt.trace, got)
+		}
+		if matched != tt.pattern {
+			t.Errorf("%s: want matched path %q, got %q", tt.path, tt.pattern, matched)
+		}
+	}
+}
+
+func TestGroupWith(t *testing.T) {
+	var trace []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	noop := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	api := router.Group("/api")
+	api.Use(mw("api1"))
+	api.Use(mw("api2")) // leaves spare capacity in the original slice
+	api.With(mw("auth")).GET("/admin", noop)
+	authed := api.With(mw("auth"))
+	api.Use(mw("api3")) // must not reach the copy
+	authed.Use(mw("extra"))
+	authed.GET("/secret", noop)
+	api.GET("/public", noop)
+
+	if len(api.middlewares) != 3 {
+		t.Errorf("With must not change the original group, got %d middlewares", len(api.middlewares))
+	}
+	if authed.prefix != api.prefix || authed.router != api.router {
+		t.Error("With must share the prefix and router")
+	}
+
+	tests := []struct {
+		path  string
+		trace string
+	}{
+		{"/api/admin", "api1,api2,auth"},
+		{"/api/secret", "api1,api2,auth,extra"},
+		{"/api/public", "api1,api2,api3"},
+	}
+	for _, tt := range tests {
+		trace = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status %d", tt.path, w.Code)
+		}
+		if got := strings.Join(trace, ","); got != tt.trace {
+			t.Errorf("%s: want middleware %s, got %s", tt.path, tt.trace, got)
+		}
+	}
+}
+func TestRouterAllocStats(t *testing.T) {
+	router := New()
+	if stats := router.AllocStats(); stats != (AllocStats{}) {
+		t.Errorf("want zero stats for empty router, got %+v", stats)
+	}
+
+	router.GET("/static", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/users/:id/posts/:post", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	serve := func(path string) {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+	}
+
+	serve("/static")
+	if stats := router.AllocStats(); stats.ParamsPoolMisses != 0 || stats.MaxParams != 2 {
+		t.Errorf("route without params allocated: %+v", stats)
+	}
+	serve("/users/1/posts/2")
+	if stats := router.AllocStats(); stats.ParamsPoolMisses == 0 {
+		t.Errorf("pool miss not counted: %+v", stats)
+	}
+}
+
+func BenchmarkRouterParams(b *testing.B) {
+	router := New()
+	router.GET("/users/:id/posts/:post", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/users/1/posts/2", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+	b.ReportMetric(float64(router.AllocStats().ParamsPoolMisses)/float64(b.N), "poolmisses/op")
+}
+
+func BenchmarkRouterLookupInto(b *testing.B) {
+	router := New()
+	router.GET("/users/:id/posts/:post", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	ps := make(Params, 0, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if handle, _ := router.LookupInto(http.MethodGet, "/users/1/posts/2", &ps); handle == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func TestRouterStaticAllocs(t *testing.T) {
+	router := New()
+	router.GET("/users/settings", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/users/settings", nil)
+	// only the per-request tracking writer and the closure wrapping the core
+	// routing logic may allocate
+	if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) }); allocs > 2 {
+		t.Errorf("static route: want at most 2 allocations per request, got %v", allocs)
+	}
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, _ *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestRouterForwardsPusher(t *testing.T) {
+	for _, onResponse := range []bool{false, true} {
+		router := New()
+		if onResponse {
+			router.OnResponse = func(*http.Request, int, int, time.Duration) {}
+		}
+		router.GET("/", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			pusher, ok := w.(http.Pusher)
+			if !ok {
+				t.Fatal("handler lost the http.Pusher of the server's ResponseWriter")
+			}
+			if err := pusher.Push("/app.css", nil); err != nil {
+				t.Fatalf("Push: %v", err)
+			}
+		})
+
+		w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if len(w.pushed) != 1 || w.pushed[0] != "/app.css" {
+			t.Errorf("OnResponse=%v: pushed %v, want [/app.css]", onResponse, w.pushed)
+		}
+	}
+
+	router := New()
+	router.GET("/", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		if _, ok := w.(http.Pusher); ok {
+			t.Error("handler sees http.Pusher although the server's ResponseWriter does not support it")
+		}
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func BenchmarkRouterStatic(b *testing.B) {
+	router := New()
+	router.GET("/", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/users/profile", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/users/settings", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/settings", nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		w := new(mockResponseWriter)
+		for pb.Next() {
+			router.ServeHTTP(w, r)
+		}
+	})
+}
+
+func BenchmarkRouterStaticWhileRegistering(b *testing.B) {
+	router := New()
+	router.GET("/", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/users/profile", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/users/settings", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/settings", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			router.GET(fmt.Sprintf("/plugins/%d", i), func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		w := new(mockResponseWriter)
+		for pb.Next() {
+			router.ServeHTTP(w, r)
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
+
+func TestRouterHandleX(t *testing.T) {
+	router := New()
+	var got RouteContext
+	router.GETX("/users/:id", func(_ http.ResponseWriter, _ *http.Request, rc RouteContext) {
+		got = rc
+	}).WithMeta("auth", "admin").WithMeta("rate", 10)
+	router.POSTX("/users", func(_ http.ResponseWriter, _ *http.Request, rc RouteContext) {
+		got = rc
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/42", nil)
+	router.ServeHTTP(w, r)
+	want := RouteContext{
+		Pattern: "/users/:id",
+		Params:  Params{{"id", "42"}},
+		Meta:    map[string]interface{}{"auth": "admin", "rate": 10},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/users", nil)
+	router.ServeHTTP(w, r)
+	if got.Pattern != "/users" || len(got.Params) != 0 || got.Meta != nil {
+		t.Errorf("wrong route context: %+v", got)
+	}
+}
+
+func TestRouterRedirectStatus(t *testing.T) {
+	router := New()
+	router.SetRedirectStatus(http.StatusFound, http.StatusTemporaryRedirect)
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/path", h)
+	router.POST("/path", h)
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/path/", http.StatusFound},              // trailing slash
+		{http.MethodGet, "/PATH", http.StatusFound},               // fixed path
+		{http.MethodPost, "/path/", http.StatusTemporaryRedirect}, // trailing slash
+		{http.MethodPost, "/../path", http.StatusTemporaryRedirect},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tc.method, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code || w.Header().Get("Location") != "/path" {
+			t.Errorf("%s %s: want %d to /path, got %d to %q", tc.method, tc.path, tc.code, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// the zero value keeps the default codes
+	router = &Router{RedirectTrailingSlash: true}
+	router.GET("/path", h)
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/path/", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("zero value router: want 301, got %d", w.Code)
+	}
+
+	for _, codes := range [][2]int{{http.StatusOK, http.StatusTemporaryRedirect}, {http.StatusFound, 0}} {
+		if recv := catchPanic(func() { router.SetRedirectStatus(codes[0], codes[1]) }); recv == nil {
+			t.Errorf("SetRedirectStatus(%d, %d) did not panic", codes[0], codes[1])
+		}
+	}
+}
+
+func TestRouterRedirectPath(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/path", h)
+	router.GET("/dir/", h)
+	router.GET("/users/:id", h)
+	router.POST("/path", h)
+
+	for _, tc := range []struct {
+		method, path string
+		target       string
+		redirect     bool
+	}{
+		{http.MethodGet, "/path", "", false},
+		{http.MethodGet, "/path/", "/path", true},
+		{http.MethodGet, "/dir", "/dir/", true},
+		{http.MethodGet, "/PATH", "/path", true},
+		{http.MethodGet, "/../Dir", "/dir/", true},
+		{http.MethodGet, "/USERS/Gopher", "/users/Gopher", true},
+		{http.MethodGet, "/nothing", "", false},
+		{http.MethodPost, "/path/", "/path", true},
+		{http.MethodPut, "/path/", "", false}, // no PUT routes
+	} {
+		target, redirect := router.RedirectPath(tc.method, tc.path)
+		if target != tc.target || redirect != tc.redirect {
+			t.Errorf("%s %s: want %q %t, got %q %t", tc.method, tc.path, tc.target, tc.redirect, target, redirect)
+		}
+
+		// ServeHTTP must agree
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tc.method, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if location := w.Header().Get("Location"); location != tc.target {
+			t.Errorf("%s %s: ServeHTTP redirected to %q", tc.method, tc.path, location)
+		}
+	}
+
+	router.RedirectNonIdempotent = false
+	if _, redirect := router.RedirectPath(http.MethodPost, "/path/"); redirect {
+		t.Error("POST redirected with RedirectNonIdempotent disabled")
+	}
+	router.RedirectTrailingSlash = false
+	router.RedirectFixedPath = false
+	if _, redirect := router.RedirectPath(http.MethodGet, "/path/"); redirect {
+		t.Error("redirect with both redirect options disabled")
+	}
+}
+
+func TestRouterRedirectNonIdempotent(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	for _, method := range methods {
+		router.Handle(method, "/path", h)
+		router.Handle(method, "/dir/", h)
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// default: every method is redirected
+	for _, method := range methods {
+		want := http.StatusPermanentRedirect
+		if method == http.MethodGet {
+			want = http.StatusMovedPermanently
+		}
+		for _, path := range []string{"/path/", "/dir", "/PATH"} {
+			if w := serve(method, path); w.Code != want {
+				t.Errorf("default %s %s: want %d, got %d", method, path, want, w.Code)
+			}
+		}
+	}
+
+	router.RedirectNonIdempotent = false
+	for _, method := range methods {
+		want := http.StatusNotFound
+		switch method {
+		case http.MethodGet:
+			want = http.StatusMovedPermanently
+		case http.MethodHead:
+			want = http.StatusPermanentRedirect
+		}
+		for _, path := range []string{"/path/", "/dir", "/PATH"} {
+			if w := serve(method, path); w.Code != want {
+				t.Errorf("disabled %s %s: want %d, got %d", method, path, want, w.Code)
+			}
+		}
+	}
+}
+
+func TestRouteActive(t *testing.T) {
+	start := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	now := start.Add(-time.Second)
+
+	router := New()
+	router.Clock = func() time.Time { return now }
+	router.GET("/sale", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Active(start, end)
+	router.GET("/until", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Active(time.Time{}, end)
+
+	tests := []struct {
+		at          time.Time
+		sale, until int
+	}{
+		{start.Add(-time.Second), http.StatusNotFound, http.StatusOK},
+		{start, http.StatusOK, http.StatusOK},
+		{end.Add(-time.Second), http.StatusOK, http.StatusOK},
+		{end, http.StatusNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		now = tt.at
+		for path, want := range map[string]int{"/sale": tt.sale, "/until": tt.until} {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, path, nil)
+			router.ServeHTTP(w, r)
+			if w.Code != want {
+				t.Errorf("%s at %v: want %d, got %d", path, tt.at, want, w.Code)
+			}
+		}
+	}
+
+	if recv := catchPanic(func() {
+		router.GET("/bad", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Active(end, start)
+	}); recv == nil {
+		t.Error("no panic for inverted active window")
+	}
+}
+
+func TestRouterDefaultHeaders(t *testing.T) {
+	router := New()
+	router.DefaultHeaders = http.Header{
+		"Server":        {"httprouter"},
+		"Cache-Control": {"no-store"},
+		"Vary":          {"Accept"},
+	}
+	router.GET("/default", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/override", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Del("Server")
+	})
+
+	tests := []struct {
+		path string
+		want http.Header
+	}{
+		{"/default", http.Header{"Server": {"httprouter"}, "Cache-Control": {"no-store"}, "Vary": {"Accept"}}},
+		{"/override", http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept", "Accept-Encoding"}}},
+		{"/missing", http.Header{"Server": {"httprouter"}, "Cache-Control": {"no-store"}, "Vary": {"Accept"}}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, r)
+		for k, want := range tt.want {
+			if got := w.Header().Values(k); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: header %s: want %v, got %v", tt.path, k, want, got)
+			}
+		}
+		if _, ok := tt.want["Server"]; !ok && w.Header().Get("Server") != "" {
+			t.Errorf("%s: deleted default header still present", tt.path)
+		}
+	}
+
+	// handlers must not be able to modify the router's defaults
+	if got := router.DefaultHeaders.Values("Vary"); len(got) != 1 {
+		t.Errorf("default headers modified: %v", got)
+	}
+}
+
+func TestRouteWithHEAD(t *testing.T) {
+	router := New()
+	group := router.Group("/g")
+	group.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Group", "yes")
+			next.ServeHTTP(w, r)
+		})
+	})
+	group.GET("/doc/:name", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"`+ps.ByName("name")+`"`)
+		w.Write([]byte("hello "))
+		w.Write([]byte(ps.ByName("name")))
+	}).WithHEAD()
+	group.GET("/gone", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusGone)
+	}).WithHEAD()
+	router.GET("/plain", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	for _, path := range []string{"/g/doc/world", "/g/gone"} {
+		get, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		get.Body.Close()
+		head, err := http.Head(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		head.Body.Close()
+
+		if head.StatusCode != get.StatusCode || head.ContentLength != get.ContentLength {
+			t.Errorf("%s: GET %d (length %d), HEAD %d (length %d)",
+				path, get.StatusCode, get.ContentLength, head.StatusCode, head.ContentLength)
+		}
+		for _, k := range []string{"Content-Type", "Content-Length", "Etag", "X-Group"} {
+			if head.Header.Get(k) != get.Header.Get(k) {
+				t.Errorf("%s: header %s differs: GET %q, HEAD %q", path, k, get.Header.Get(k), head.Header.Get(k))
+			}
+		}
+	}
+
+	// routes without WithHEAD are not answered
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodHead, "/plain", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD without WithHEAD: want 405, got %d", w.Code)
+	}
+
+	if recv := catchPanic(func() {
+		router.POST("/p", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).WithHEAD()
+	}); recv == nil {
+		t.Error("no panic for WithHEAD on a POST route")
+	}
+}
+
+func TestRouterTryHandle(t *testing.T) {
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	for _, path := range []string{"/users/:id", "/files/*filepath", "/media/*path(*.mp4)", "/docs/:name?"} {
+		if err := router.TryHandle(http.MethodGet, path, h); err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		method, path string
+		handle       Handle
+		kind         error
+		existing     string
+	}{
+		{"", "/x", h, ErrEmptyMethod, ""},
+		{http.MethodGet, "/x", nil, ErrNilHandler, ""},
+		{http.MethodGet, "x", h, ErrInvalidPath, ""},
+		{http.MethodGet, "/users/:", h, ErrInvalidPath, ""},
+		{http.MethodGet, "/users/:id(\\d+", h, ErrInvalidPath, ""},
+		{http.MethodGet, "/a/:x?/b", h, ErrInvalidPath, ""},
+		{http.MethodGet, "/users/:id", h, ErrRouteConflict, "/users/:id"},
+		{http.MethodGet, "/users/:name/posts", h, ErrRouteConflict, "/users/:id"},
+		{http.MethodGet, "/users/new", h, ErrRouteConflict, "/users/:id"},
+		{http.MethodGet, "/files/readme", h, ErrRouteConflict, "/files/*filepath"},
+		{http.MethodGet, "/media/*path(*.x.mp4)", h, ErrRouteConflict, "/media/*path(*.mp4)"},
+		{http.MethodGet, "/docs", h, ErrRouteConflict, "/docs/:name?"},
+		{http.MethodGet, "/docs/:id", h, ErrRouteConflict, "/docs/:name?"},
+	}
+	for _, tt := range tests {
+		err := router.TryHandle(tt.method, tt.path, tt.handle)
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%s %s: want %v, got %v", tt.method, tt.path, tt.kind, err)
+			continue
+		}
+		var re *RouteError
+		if !errors.As(err, &re) || re.Existing != tt.existing || re.Path != tt.path {
+			t.Errorf("%s %s: wrong error details %+v", tt.method, tt.path, re)
+		}
+		if tt.existing != "" && !strings.Contains(err.Error(), tt.existing) {
+			t.Errorf("%s %s: existing route missing from message %q", tt.method, tt.path, err)
+		}
+	}
+
+	// failed registrations leave the table untouched
+	want := []RouteInfo{
+		{http.MethodGet, "/docs/:name?", false},
+		{http.MethodGet, "/files/*filepath", false},
+		{http.MethodGet, "/media/*path(*.mp4)", false},
+		{http.MethodGet, "/users/:id", false},
+	}
+	if got := router.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes:\nwant %v\n got %v", want, got)
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/1", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("existing route broken after failed registrations: %d", w.Code)
+	}
+}
+
+func TestRouterAllowedMethodsFromContext(t *testing.T) {
+	router := New()
+	var got []string
+	router.GET("/items", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		got = AllowedMethodsFromContext(r.Context())
+	})
+	router.POST("/items", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	record := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = AllowedMethodsFromContext(r.Context())
+	})
+	router.MethodNotAllowed = record
+	router.GlobalOPTIONS = record
+
+	serve := func(method string) []string {
+		got = []string{"unset"}
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, "/items", nil)
+		router.ServeHTTP(w, r)
+		return got
+	}
+
+	if m := serve(http.MethodDelete); !reflect.DeepEqual(m, []string{"GET", "OPTIONS", "POST"}) {
+		t.Errorf("405 with OPTIONS: got %v", m)
+	}
+	if m := serve(http.MethodOptions); !reflect.DeepEqual(m, []string{"GET", "OPTIONS", "POST"}) {
+		t.Errorf("automatic OPTIONS: got %v", m)
+	}
+	if m := serve(http.MethodGet); m != nil {
+		t.Errorf("allowed methods set for a matched route: %v", m)
+	}
+
+	router.HandleOPTIONS = false
+	if m := serve(http.MethodDelete); !reflect.DeepEqual(m, []string{"GET", "POST"}) {
+		t.Errorf("405 without OPTIONS: got %v", m)
+	}
+}
+
+func TestRouterAutoHead(t *testing.T) {
+	router := New()
+	router.AutoHead = true
+	group := router.Group("/g")
+	group.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Group", "yes")
+			next.ServeHTTP(w, r)
+		})
+	})
+	group.GET("/doc/:name", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello " + ps.ByName("name")))
+	})
+	router.GET("/file", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader("file contents"))
+	})
+
+	// explicit HEAD routes win, whether registered before or after GET
+	explicit := func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Explicit", "yes")
+	}
+	router.HEAD("/before", explicit)
+	router.GET("/before", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("get"))
+	})
+	router.GET("/after", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("get"))
+	})
+	router.HEAD("/after", explicit)
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	for _, path := range []string{"/g/doc/world", "/file"} {
+		get, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		get.Body.Close()
+		head, err := http.Head(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(head.Body)
+		head.Body.Close()
+
+		if len(body) != 0 {
+			t.Errorf("%s: HEAD returned a body: %q", path, body)
+		}
+		if head.StatusCode != get.StatusCode || head.ContentLength != get.ContentLength || get.ContentLength <= 0 {
+			t.Errorf("%s: GET %d (length %d), HEAD %d (length %d)",
+				path, get.StatusCode, get.ContentLength, head.StatusCode, head.ContentLength)
+		}
+		for _, k := range []string{"Content-Type", "Content-Length", "Accept-Ranges", "X-Group"} {
+			if head.Header.Get(k) != get.Header.Get(k) {
+				t.Errorf("%s: header %s differs: GET %q, HEAD %q", path, k, get.Header.Get(k), head.Header.Get(k))
+			}
+		}
+	}
+
+	for _, path := range []string{"/before", "/after"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodHead, path, nil)
+		router.ServeHTTP(w, r)
+		if w.Header().Get("X-Explicit") != "yes" {
+			t.Errorf("%s: explicit HEAD route not used", path)
+		}
+	}
+
+	want := []RouteInfo{
+		{http.MethodGet, "/after", false},
+		{http.MethodHead, "/after", false},
+		{http.MethodGet, "/before", false},
+		{http.MethodHead, "/before", false},
+		{http.MethodGet, "/file", false},
+		{http.MethodHead, "/file", false},
+		{http.MethodGet, "/g/doc/:name", true},
+		{http.MethodHead, "/g/doc/:name", true},
+	}
+	if got := router.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes:\nwant %v\n got %v", want, got)
+	}
+
+	// the generated route goes away with its GET route
+	router.RemoveRoute(http.MethodGet, "/file")
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodHead, "/file", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("HEAD for removed GET route: want 404, got %d", w.Code)
+	}
+}
+
+func TestRouterAlwaysStoreParams(t *testing.T) {
+	router := New()
+	var got Params
+	var stored bool
+	api := router.Group("/api")
+	api.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = ParamsFromContext(r.Context())
+			stored = got != nil
+			next.ServeHTTP(w, r)
+		})
+	})
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	api.GET("/status", h)
+	api.GET("/users/:id", h)
+	serve := func(path string) {
+		got, stored = nil, false
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+	}
+
+	serve("/api/status")
+	if stored {
+		t.Errorf("params stored for a zero-param route by default: %v", got)
+	}
+
+	router.AlwaysStoreParams = true
+	serve("/api/status")
+	if !stored || len(got) != 0 {
+		t.Errorf("want empty non-nil params for a zero-param route, got %#v", got)
+	}
+	serve("/api/users/7")
+	if got.ByName("id") != "7" {
+		t.Errorf("wrong params for a route with params: %v", got)
+	}
+}
+
+func TestRouterStoreRoutePattern(t *testing.T) {
+	router := New()
+	var pattern string
+	record := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		pattern = RoutePatternFromContext(r.Context())
+		if p := MatchedPatternFromContext(r.Context()); p != pattern {
+			t.Errorf("RoutePatternFromContext %q differs from MatchedPatternFromContext %q", pattern, p)
+		}
+	}
+	router.GET("/users/:id", record)
+	router.GET("/about", record)
+	router.Group("/api").Group("/v1").GET("/items/:id/*rest", record)
+	router.ServeFiles("/static/*filepath", http.FS(fstest.MapFS{"a.txt": {Data: []byte("a")}}))
+
+	serve := func(path string) {
+		pattern = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+	}
+
+	serve("/users/1")
+	if pattern != "" {
+		t.Errorf("pattern stored without StoreRoutePattern: %q", pattern)
+	}
+
+	router.StoreRoutePattern = true
+	for path, want := range map[string]string{
+		"/users/1":              "/users/:id",
+		"/about":                "/about",
+		"/api/v1/items/7/a/b/c": "/api/v1/items/:id/*rest",
+	} {
+		serve(path)
+		if pattern != want {
+			t.Errorf("%s: want pattern %q, got %q", path, want, pattern)
+		}
+	}
+
+	var filePattern string
+	router.UsePostMatch(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			filePattern = MatchedPatternFromContext(r.Context())
+			next.ServeHTTP(w, r)
+		})
+	})
+	serve("/static/a.txt")
+	if filePattern != "/static/*filepath" {
+		t.Errorf("wrong pattern for ServeFiles: %q", filePattern)
+	}
+
+	// the pattern is the registered one, not the request path or the
+	// expanded form of an optional param
+	ci := New()
+	ci.CaseInsensitive = true
+	ci.StoreRoutePattern = true
+	ci.GET("/About", record)
+	ci.GET("/Files/:name?", record)
+	ci.GET("/media/*path(*.mp4)", record)
+	for path, want := range map[string]string{
+		"/about":       "/About",
+		"/ABOUT":       "/About",
+		"/files":       "/Files/:name?",
+		"/files/a.txt": "/Files/:name?",
+		"/media/a.mp4": "/media/*path(*.mp4)",
+	} {
+		pattern = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		ci.ServeHTTP(w, r)
+		if pattern != want {
+			t.Errorf("CaseInsensitive %s: want pattern %q, got %q", path, want, pattern)
+		}
+	}
+}
+
+func BenchmarkRouterStoreRoutePattern(b *testing.B) {
+	router := New()
+	router.StoreRoutePattern = true
+	router.GET("/users/:id/posts/:post", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/users/1/posts/2", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func TestRouterUsePostMatch(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				entry := name
+				if p := MatchedPatternFromContext(r.Context()); p != "" {
+					entry += " " + p + " id=" + ParamsFromContext(r.Context()).ByName("id")
+				}
+				order = append(order, entry)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := New()
+	router.Use(trace("pre"))
+	router.UsePostMatch(trace("post1"), trace("post2"))
+	g := router.Group("/api")
+	g.Use(trace("group"))
+	g.GET("/users/:id", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		order = append(order, "handler")
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/api/users/42", nil)
+	router.ServeHTTP(w, r)
+	want := []string{
+		"pre",
+		"post1 /api/users/:id id=42",
+		"post2 /api/users/:id id=42",
+		"group /api/users/:id id=42",
+		"handler",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("wrong execution order:\n got %q\nwant %q", order, want)
+	}
+
+	// unmatched requests only pass the pre-match phase
+	order = nil
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/missing", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || !reflect.DeepEqual(order, []string{"pre"}) {
+		t.Errorf("unmatched request: code=%d order=%q", w.Code, order)
+	}
+}
+
+func TestRouterMaxSegments(t *testing.T) {
+	router := New()
+	router.MaxSegments = 4
+	router.GET("/a/b/c/d", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/files/*path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/a/b/c/d", http.StatusOK},
+		{"/files/x/y/z", http.StatusOK},
+		{"/files/x/y/z/w", http.StatusRequestURITooLong},
+		{strings.Repeat("/a", 5000), http.StatusRequestURITooLong},
+		{strings.Repeat("/", 5000), http.StatusRequestURITooLong},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code {
+			t.Errorf("%.20s...: want %d, got %d", tc.path, tc.code, w.Code)
+		}
+	}
+}
+
+func TestRouterIf(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.If(true).GET("/debug", h)
+	router.If(false).GET("/admin", h).Name("admin")
+	api := router.Group("/api")
+	api.If(true).GET("/beta", h)
+	api.If(false).GET("/internal", h)
+	api.If(false).Group("/v0").GET("/old", h)
+
+	for path, code := range map[string]int{
+		"/debug":        http.StatusOK,
+		"/admin":        http.StatusNotFound,
+		"/api/beta":     http.StatusOK,
+		"/api/internal": http.StatusNotFound,
+		"/api/v0/old":   http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("%s: want %d, got %d", path, code, w.Code)
+		}
+	}
+	if _, err := router.URL("admin"); err == nil {
+		t.Error("name of discarded route is registered")
+	}
+	if len(router.Routes()) != 2 {
+		t.Errorf("want 2 routes, got %v", router.Routes())
+	}
+}
+
+func TestRouterRetryAfter(t *testing.T) {
+	router := New()
+	router.RetryAfter = 1500 * time.Millisecond
+	router.GET("/", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/fail", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		w.Header().Set("Retry-After", "60")
+		router.serveError(w, r, http.StatusServiceUnavailable, ReasonOther)
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/missing", nil)
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Retry-After") != "" {
+		t.Error("Retry-After set on 404")
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/fail", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("existing Retry-After overwritten: %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	router.BeginDrain()
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("want 503 with Retry-After 2, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRouterDefault(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("route"))
+	})
+	router.Default(func(w http.ResponseWriter, r *http.Request, ps Params) {
+		if ParamsFromContext(r.Context()).ByName(DefaultPathParam) != ps.ByName(DefaultPathParam) {
+			t.Error("default route params not in context")
+		}
+		w.Write([]byte("default " + r.Method + " " + ps.ByName(DefaultPathParam)))
+	})
+	router.DefaultMethod(http.MethodPost, func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte("default post " + ps.ByName(DefaultPathParam)))
+	})
+	router.ServeUnmatched(http.FS(fstest.MapFS{"robots.txt": &fstest.MapFile{Data: []byte("static")}}))
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/users/1", http.StatusOK, "route"},
+		{http.MethodDelete, "/users/1", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/robots.txt", http.StatusOK, "static"},
+		{http.MethodGet, "/a/b", http.StatusOK, "default GET /a/b"},
+		{http.MethodPut, "/a", http.StatusOK, "default PUT /a"},
+		{http.MethodPost, "/a", http.StatusOK, "default post /a"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tc.method, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s %s: want %d %q, got %d %q", tc.method, tc.path, tc.code, tc.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouteCookie(t *testing.T) {
+	router := New()
+	var handled string
+	h := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			handled = name
+		}
+	}
+	router.GET("/app", h("stable")).
+		WhenCookie("preview", "on", h("preview")).
+		WhenCookie("beta", "", h("beta"))
+	router.GET("/account", h("account")).RequireCookie("session")
+
+	for _, tc := range []struct {
+		path    string
+		cookies []*http.Cookie
+		code    int
+		want    string
+	}{
+		{"/app", nil, http.StatusOK, "stable"},
+		{"/app", []*http.Cookie{{Name: "preview", Value: "off"}}, http.StatusOK, "stable"},
+		{"/app", []*http.Cookie{{Name: "preview", Value: "on"}}, http.StatusOK, "preview"},
+		{"/app", []*http.Cookie{{Name: "beta", Value: "1"}}, http.StatusOK, "beta"},
+		{"/app", []*http.Cookie{{Name: "beta", Value: "1"}, {Name: "preview", Value: "on"}}, http.StatusOK, "preview"},
+		{"/account", nil, http.StatusBadRequest, ""},
+		{"/account", []*http.Cookie{{Name: "session", Value: "s"}}, http.StatusOK, "account"},
+	} {
+		handled = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		for _, c := range tc.cookies {
+			r.AddCookie(c)
+		}
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code || handled != tc.want {
+			t.Errorf("%s %v: want %d %q, got %d %q", tc.path, tc.cookies, tc.code, tc.want, w.Code, handled)
+		}
+	}
+}
+
+func TestRouterParamConstraint(t *testing.T) {
+	router := New()
+	var id string
+	router.GET(`/users/:id(\d+)`, func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		id = ps.ByName("id")
+	}).Name("user")
+	notFound := false
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		notFound = true
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/42", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || id != "42" {
+		t.Errorf("want match with id 42, got %d %q", w.Code, id)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/users/gordon", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || !notFound {
+		t.Errorf("want NotFound handler for unsatisfied constraint, got %d", w.Code)
+	}
+
+	if names, ok := router.ParamNames(http.MethodGet, `/users/:id(\d+)`); !ok || !reflect.DeepEqual(names, []string{"id"}) {
+		t.Errorf("wrong param names %v", names)
+	}
+	if u, err := router.URL("user", "id", "7"); err != nil || u != "/users/7" {
+		t.Errorf("want /users/7, got %q, %v", u, err)
+	}
+
+	// a constrained param still owns its position
+	for _, path := range []string{"/users/me", `/users/:name([a-z]+)`} {
+		if err := router.TryHandle(http.MethodGet, path, func(http.ResponseWriter, *http.Request, Params) {}); !errors.Is(err, ErrRouteConflict) {
+			t.Errorf("%s next to /users/:id(\\d+): want ErrRouteConflict, got %v", path, err)
+		}
+	}
+}
+
+func TestRouterOptionalParam(t *testing.T) {
+	router := New()
+	router.SaveMatchedRoutePath = true
+	var name, matched string
+	router.GET("/files/:name?", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		name, matched = ps.ByName("name"), ps.MatchedRoutePath()
+	}).Name("files")
+
+	for _, tc := range []struct {
+		path, name string
+		code       int
+	}{
+		{"/files/report.pdf", "report.pdf", http.StatusOK},
+		{"/files", "", http.StatusOK},
+		{"/files/", "", http.StatusMovedPermanently},
+	} {
+		name, matched = "unset", ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tc.code {
+			t.Errorf("%s: want %d, got %d", tc.path, tc.code, w.Code)
+		}
+		if tc.code == http.StatusOK && (name != tc.name || matched != "/files/:name?") {
+			t.Errorf("%s: got name %q, matched route path %q", tc.path, name, matched)
+		}
+		if tc.code == http.StatusMovedPermanently && w.Header().Get("Location") != "/files" {
+			t.Errorf("%s: wrong redirect %q", tc.path, w.Header().Get("Location"))
+		}
+	}
+
+	// Lookup is consistent for both forms
+	h1, ps1, _ := router.Lookup(http.MethodGet, "/files/a")
+	h2, ps2, _ := router.Lookup(http.MethodGet, "/files")
+	if h1 == nil || h2 == nil || ps1.ByName("name") != "a" || ps2.ByName("name") != "" {
+		t.Errorf("inconsistent Lookup: %v %v", ps1, ps2)
+	}
+
+	if u, _ := router.URL("files"); u != "/files" {
+		t.Errorf("want /files, got %q", u)
+	}
+	if u, _ := router.URL("files", "name", "a b"); u != "/files/a%20b" {
+		t.Errorf("want /files/a%%20b, got %q", u)
+	}
+
+	for _, path := range []string{"/a/:b?/c", "/a/*b?", "/a/x:b?"} {
+		if recv := catchPanic(func() { router.GET(path, func(http.ResponseWriter, *http.Request, Params) {}) }); recv == nil {
+			t.Errorf("no panic for invalid optional parameter in '%s'", path)
+		}
+	}
+}
+
+func TestRouterHandleWith(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := New()
+	router.Use(trace("global"))
+	var got Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		order = append(order, "handler")
+		got = ps
+	}
+	router.HandleWith(http.MethodGet, "/users/:id", handle, trace("a"), trace("b"))
+	g := router.Group("/api")
+	g.Use(trace("group"))
+	g.HandleWith(http.MethodGet, "/items/:id", handle, trace("route"))
+	router.GET("/plain", handle)
+
+	for _, tc := range []struct {
+		path  string
+		order []string
+		ps    Params
+	}{
+		{"/users/1", []string{"global", "a", "b", "handler"}, Params{{"id", "1"}}},
+		{"/api/items/2", []string{"global", "group", "route", "handler"}, Params{{"id", "2"}}},
+		{"/plain", []string{"global", "handler"}, nil},
+	} {
+		order, got = nil, nil
+		r, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if !reflect.DeepEqual(order, tc.order) || !reflect.DeepEqual(got, tc.ps) {
+			t.Errorf("%s: got order %v params %v, want %v %v", tc.path, order, got, tc.order, tc.ps)
+		}
+	}
+}
+
+func TestRouterMethodOverride(t *testing.T) {
+	var gotRoute, gotMethod string
+	record := func(route string) Handle {
+		return func(_ http.ResponseWriter, r *http.Request, _ Params) {
+			gotRoute, gotMethod = route, r.Method
+		}
+	}
+
+	router := New()
+	router.MethodOverrideHeader = "X-HTTP-Method-Override"
+	router.POST("/items/:id", record("post"))
+	router.PUT("/items/:id", record("put"))
+	router.GET("/only-get", record("get"))
+
+	tests := []struct {
+		method, override, path string
+		code                   int
+		route                  string
+		allow                  string
+	}{
+		{http.MethodPost, "PUT", "/items/1", http.StatusOK, "put", ""},
+		{http.MethodPost, "put", "/items/1", http.StatusOK, "put", ""},
+		{http.MethodPost, "", "/items/1", http.StatusOK, "post", ""},
+		{http.MethodPost, "FOO", "/items/1", http.StatusOK, "post", ""},
+		{http.MethodPost, "GET", "/items/1", http.StatusOK, "post", ""},
+		{http.MethodGet, "PUT", "/only-get", http.StatusOK, "get", ""},
+		{http.MethodPost, "DELETE", "/items/1", http.StatusMethodNotAllowed, "", "OPTIONS, POST, PUT"},
+		{http.MethodPost, "DELETE", "/only-get", http.StatusMethodNotAllowed, "", "GET, OPTIONS"},
+	}
+	for _, tt := range tests {
+		gotRoute, gotMethod = "", ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		if tt.override != "" {
+			r.Header.Set("X-HTTP-Method-Override", tt.override)
+		}
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || gotRoute != tt.route {
+			t.Errorf("%s %s (override %q): want %d %q, got %d %q", tt.method, tt.path, tt.override, tt.code, tt.route, w.Code, gotRoute)
+		}
+		if gotRoute != "" && gotMethod != tt.method {
+			t.Errorf("%s %s (override %q): request method changed to %s", tt.method, tt.path, tt.override, gotMethod)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s (override %q): want Allow %q, got %q", tt.method, tt.path, tt.override, tt.allow, allow)
+		}
+	}
+
+	router.MethodOverrideRewrite = true
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/items/1", nil)
+	r.Header.Set("X-HTTP-Method-Override", "PUT")
+	router.ServeHTTP(w, r)
+	if gotRoute != "put" || gotMethod != http.MethodPut || r.Method != http.MethodPost {
+		t.Errorf("MethodOverrideRewrite: got route %q method %s (original %s)", gotRoute, gotMethod, r.Method)
+	}
+}
+
+func TestGroupSetErrorHandler(t *testing.T) {
+	handler := func(name string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request, statusCode int) {
+			w.WriteHeader(statusCode)
+			w.Write([]byte(name))
+		}
+	}
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.SetErrorHandler(handler("global"))
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("notfound"))
+	})
+	router.GET("/page", h)
+
+	api := router.Group("/api")
+	api.SetErrorHandler(handler("api"))
+	api.GET("/items", h)
+	api.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) { panic("boom") })
+	api.Group("/v2").SetErrorHandler(handler("v2"))
+	router.Group("/users/:id").SetErrorHandler(handler("users"))
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/api/missing", http.StatusNotFound, "api"},
+		{http.MethodGet, "/api", http.StatusNotFound, "api"},
+		{http.MethodPost, "/api/items", http.StatusMethodNotAllowed, "api"},
+		{http.MethodGet, "/api/panic", http.StatusInternalServerError, "api"},
+		{http.MethodGet, "/api/v2/missing", http.StatusNotFound, "v2"},
+		{http.MethodGet, "/users/7/missing", http.StatusNotFound, "users"},
+		{http.MethodGet, "/missing", http.StatusNotFound, "notfound"},
+		{http.MethodGet, "/apix", http.StatusNotFound, "notfound"},
+		{http.MethodGet, "/users", http.StatusNotFound, "notfound"},
+		{http.MethodPost, "/page", http.StatusMethodNotAllowed, "global"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %s: want %d %q, got %d %q", tt.method, tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	// removing the group handler falls back to the router's handlers
+	router.Group("/api/").SetErrorHandler(nil)
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/api/missing", nil)
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "notfound" {
+		t.Errorf("after removal: want router NotFound, got %q", w.Body.String())
+	}
+}
+
+func TestGroupSetErrorHandlerRegisteredRoutes(t *testing.T) {
+	handler := func(name string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request, statusCode int) {
+			w.WriteHeader(statusCode)
+			w.Write([]byte(name))
+		}
+	}
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	boom := func(_ http.ResponseWriter, _ *http.Request, _ Params) { panic("boom") }
+
+	router := New()
+	router.SetErrorHandler(handler("global"))
+
+	// a param group does not capture routes registered elsewhere
+	lang := router.Group("/:lang")
+	lang.SetErrorHandler(handler("lang"))
+	lang.GET("/home", h)
+	lang.GET("/panic", boom)
+	router.POST("/upload", boom)
+
+	// routes registered on the router under a group prefix keep the router's handlers
+	api := router.Group("/api")
+	api.SetErrorHandler(handler("api"))
+	api.Group("/v1").POST("/items", boom)
+	router.PUT("/api/legacy", boom)
+	user := router.Group(`/users/:id(\d+)`)
+	user.SetErrorHandler(handler("user"))
+	user.Group("/posts").DELETE("/panic", boom)
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodPost, "/upload", http.StatusInternalServerError, "global"},
+		{http.MethodGet, "/en/panic", http.StatusInternalServerError, "lang"},
+		{http.MethodGet, "/en/missing", http.StatusNotFound, "lang"},
+		{http.MethodPost, "/api/v1/items", http.StatusInternalServerError, "api"},
+		{http.MethodPut, "/api/legacy", http.StatusInternalServerError, "global"},
+		{http.MethodPut, "/api/missing", http.StatusNotFound, "api"},
+		{http.MethodDelete, "/users/7/posts/panic", http.StatusInternalServerError, "user"},
+		{http.MethodGet, "/users/x/missing", http.StatusNotFound, "lang"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %s: want %d %q, got %d %q", tt.method, tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouterMergeTrailingSlash(t *testing.T) {
+	var (
+		gotBody    string
+		gotParams  Params
+		gotPattern string
+	)
+	router := New()
+	router.MergeTrailingSlash = true
+	router.StoreRoutePattern = true
+	router.POST("/items", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotPattern = MatchedPatternFromContext(r.Context())
+	})
+	router.SaveMatchedRoutePath = true
+	router.GET("/users/:id/", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		gotParams = ps
+		gotPattern = MatchedPatternFromContext(r.Context())
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/items/", strings.NewReader("payload"))
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || gotBody != "payload" || gotPattern != "/items" {
+		t.Errorf("POST /items/: want 200 with body, got %d %q (pattern %q)", w.Code, gotBody, gotPattern)
+	}
+
+	for _, path := range []string{"/users/42", "/users/42/"} {
+		gotParams, gotPattern = nil, ""
+		w = httptest.NewRecorder()
+		r, _ = http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		want := Params{{"id", "42"}, {MatchedRoutePathParam, "/users/:id/"}}
+		if w.Code != http.StatusOK || !reflect.DeepEqual(gotParams, want) || gotPattern != "/users/:id/" {
+			t.Errorf("GET %s: want 200 with %v, got %d %v (pattern %q)", path, want, w.Code, gotParams, gotPattern)
+		}
+	}
+
+	// the merged route also counts for the Allow header
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPut, "/items/", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "OPTIONS, POST" {
+		t.Errorf("PUT /items/: want 405 with Allow, got %d %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	if target, ok := router.RedirectPath(http.MethodGet, "/users/42"); ok {
+		t.Errorf("RedirectPath: want no redirect, got %q", target)
+	}
+	router.MergeTrailingSlash = false
+	if target, ok := router.RedirectPath(http.MethodGet, "/users/42"); !ok || target != "/users/42/" {
+		t.Errorf("RedirectPath without MergeTrailingSlash: got %q %v", target, ok)
+	}
+}
+
+func TestRouterErrorHandlerExt(t *testing.T) {
+	var (
+		gotCode   int
+		gotReason ErrorReason
+	)
+	router := New()
+	router.RedirectTrailingSlash = false
+	router.MaxSegments = 4
+	router.UnknownMethodStatus = http.StatusNotImplemented
+	router.SetErrorHandler(func(w http.ResponseWriter, _ *http.Request, code int) {
+		t.Errorf("plain error handler used for %d", code)
+		w.WriteHeader(code)
+	})
+	router.SetErrorHandlerExt(func(w http.ResponseWriter, _ *http.Request, code int, reason ErrorReason) {
+		gotCode, gotReason = code, reason
+		w.WriteHeader(code)
+	})
+
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/page", h)
+	router.POST("/form", h)
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) { panic("boom") })
+	router.GET("/admin", h).Host("admin.example.com")
+	router.ServeFiles("/static/*filepath", http.FS(fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("a")}}))
+	router.Group("/upload").HandleWith(http.MethodPut, "/", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		io.ReadAll(r.Body)
+	}, MaxBodyBytes(1))
+
+	tests := []struct {
+		method, path string
+		code         int
+		reason       ErrorReason
+	}{
+		{http.MethodGet, "/missing", http.StatusNotFound, ReasonNotFound},
+		{http.MethodGet, "/page/", http.StatusNotFound, ReasonTrailingSlash},
+		{http.MethodGet, "/form", http.StatusMethodNotAllowed, ReasonMethodNotAllowed},
+		{"BREW", "/page", http.StatusNotImplemented, ReasonUnknownMethod},
+		{http.MethodGet, "/panic", http.StatusInternalServerError, ReasonPanic},
+		{http.MethodGet, "/static/missing.txt", http.StatusNotFound, ReasonStaticMiss},
+		{http.MethodGet, "/admin", http.StatusNotFound, ReasonRejected},
+		{http.MethodGet, "/a/b/c/d/e", http.StatusRequestURITooLong, ReasonTooManySegments},
+		{http.MethodPut, "/upload/", http.StatusRequestEntityTooLarge, ReasonMiddleware},
+	}
+	for _, tt := range tests {
+		gotCode, gotReason = 0, -1
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.path, strings.NewReader("body"))
+		router.ServeHTTP(w, r)
+		if gotCode != tt.code || gotReason != tt.reason {
+			t.Errorf("%s %s: want %d %v, got %d %v", tt.method, tt.path, tt.code, tt.reason, gotCode, gotReason)
+		}
+	}
+
+	router.BeginDrain()
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/page", nil)
+	router.ServeHTTP(w, r)
+	if gotReason != ReasonDraining {
+		t.Errorf("draining: want %v, got %v", ReasonDraining, gotReason)
+	}
+	router.EndDrain()
+
+	if s := ReasonStaticMiss.String(); s != "static miss" {
+		t.Errorf("unexpected reason name %q", s)
+	}
+	if s := ErrorReason(99).String(); s != "ErrorReason(99)" {
+		t.Errorf("unexpected name for unknown reason %q", s)
+	}
+}
+
+func TestRouterDecodeParams(t *testing.T) {
+	var gotName string
+	router := New()
+	router.GET("/files/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		gotName = ps.ByName("name")
+	})
+
+	// without DecodeParams the decoded %2F splits the segment
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/files/my%2Ffile", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DecodeParams disabled: want 404 for /files/my%%2Ffile, got %d", w.Code)
+	}
+
+	router.DecodeParams = true
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/files/my%20file", "my file"},
+		{"/files/my%2Ffile", "my/file"},
+		{"/files/my%2fdir%2Fa%25b", "my/dir/a%b"},
+		{"/files/plain", "plain"},
+	}
+	for _, tt := range tests {
+		gotName = ""
+		w = httptest.NewRecorder()
+		r, _ = http.NewRequest(http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || gotName != tt.want {
+			t.Errorf("GET %s: want 200 with %q, got %d %q", tt.path, tt.want, w.Code, gotName)
+		}
+	}
+
+	// an encoded slash does not create an extra segment for the Allow header either
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/files/my%2Ffile", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /files/my%%2Ffile: want 405, got %d", w.Code)
+	}
+
+	// the trailing slash redirect keeps the encoded slash
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/files/a%2Fb/", nil)
+	router.ServeHTTP(w, r)
+	loc := w.Header().Get("Location")
+	if w.Code != http.StatusMovedPermanently || loc != "/files/a%2Fb" {
+		t.Errorf("GET /files/a%%2Fb/: want 301 to /files/a%%2Fb, got %d %q", w.Code, loc)
+	}
+	gotName = ""
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, loc, nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || gotName != "a/b" {
+		t.Errorf("following the redirect: want 200 with %q, got %d %q", "a/b", w.Code, gotName)
+	}
+
+	if target, ok := router.RedirectPath(http.MethodGet, "/files/a%2Fb/"); !ok || target != "/files/a%2Fb" {
+		t.Errorf("RedirectPath: want /files/a%%2Fb, got %q %t", target, ok)
+	}
+	if explain := router.Explain(http.MethodGet, "/files/a%2Fb"); !strings.Contains(explain, "params: name=a/b") {
+		t.Errorf("Explain does not show the decoded param:\n%s", explain)
+	}
+}
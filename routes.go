@@ -0,0 +1,370 @@
+package httprouter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// RouteInfo 描述一条已注册的路由。
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	// Grouped 表示路由是否通过 Group 注册
+	Grouped bool `json:"grouped"`
+}
+
+// Routes 返回所有已注册路由的列表，按路径、再按方法排序。
+// 路径是注册时使用的路由模式（记录在各方法的 trie 树中），包含 :param 与 *catchAll 段以及组前缀；
+// 可选参数的路由只列出一次，例如 "/files/:name?"。
+// Routes 读取当前生效的路由表快照，可以与请求处理并发调用。
+func (r *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	t := r.liveTable()
+	for method, root := range t.trees {
+		seen := make(map[string]bool)
+		root.walk("", func(path, pattern string, _ Handle) {
+			// 可选参数路由的两种形式记录的是同一个路由模式
+			if seen[pattern] {
+				return
+			}
+			seen[pattern] = true
+			routes = append(routes, RouteInfo{Method: method, Path: pattern, Grouped: t.grouped[method+" "+path]})
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// setGroupPrefix 记录通过前缀为 prefix 的组注册的路由 method 与 path，用于选择组的错误处理函数，见 groupErrorHandlerFor。
+// 与 markGrouped 一样，自动生成的 HEAD 路由同样记录。
+func (r *Router) setGroupPrefix(method, path, prefix string) {
+	t := r.routes
+	if t.groupPrefixes == nil {
+		t.groupPrefixes = make(map[string]string)
+	}
+	t.groupPrefixes[method+" "+path] = prefix
+	if method == http.MethodGet && t.autoHead[r.treePattern(path)] {
+		t.groupPrefixes[http.MethodHead+" "+path] = prefix
+	}
+}
+
+// markGrouped 记录 method 与 path 对应的路由是通过 Group 注册的。
+func (r *Router) markGrouped(method, path string) {
+	t := r.routes
+	path = r.treePattern(path)
+	if t.grouped == nil {
+		t.grouped = make(map[string]bool)
+	}
+	if method == http.MethodGet && t.autoHead[path] {
+		r.markGrouped(http.MethodHead, path)
+	}
+	if base, full, ok := splitOptionalParam(path); ok {
+		t.grouped[method+" "+base] = true
+		t.grouped[method+" "+full] = true
+		return
+	}
+	t.grouped[method+" "+path] = true
+}
+
+// RemoveRoute 注销 method 与 path 对应的路由，返回该路由是否存在。
+// path 是注册时使用的路由模式（例如 "/users/:id"），而不是具体的请求路径，必须与注册时完全一致；
+// 可选参数的路由（例如 "/files/:name?"）以注册时的形式给出，两种形式一并注销；
+// 只给出其中一种形式（例如 "/files"）时不注销任何路由，返回 false。
+//
+// 移除之后，对该路径的请求如同路由从未注册：回复 404，或在该路径仍注册了其他方法时回复 405，
+// Allow 头部与 OPTIONS 回复不再列出该方法；方法的最后一个路由被移除时，该方法也从全局允许的方法中去除。
+// 路由通过 Route.Name 登记的名称随之释放，AutoHead 为 GET 路由自动生成的 HEAD 路由也一并注销。
+// 与其他注册方法一样，路由器开始处理请求之后可以与请求处理并发调用，见 HandleBatch。
+func (r *Router) RemoveRoute(method, path string) bool {
+	removed := false
+	r.mutate(func() {
+		removed = r.removeRoute(method, path)
+	})
+	return removed
+}
+
+// removeRoute 是 RemoveRoute 的内部实现，直接修改 r.routes。
+// 方法的 trie 树由其余路由重新构建，因此不会留下空节点或悬空的通配符节点。
+func (r *Router) removeRoute(method, path string) bool {
+	t := r.routes
+	if t == nil || t.trees[method] == nil {
+		return false
+	}
+	path = r.treePattern(path)
+
+	// 按树中记录的注册路由模式查找，而不是按树中的路径：可选参数路由的两种形式
+	// 记录的都是 "/files/:name?"，因此总是一并注销，只给出其中一种形式（例如 "/files"）时不注销任何路由
+	type entry struct {
+		path, pattern string
+		handle        Handle
+	}
+	var kept []entry
+	var patterns []string
+	removed := ""
+	t.trees[method].walk("", func(p, pattern string, handle Handle) {
+		if r.treePattern(pattern) == path {
+			patterns = append(patterns, p)
+			removed = pattern
+			return
+		}
+		kept = append(kept, entry{p, pattern, handle})
+	})
+	if len(patterns) == 0 {
+		return false
+	}
+
+	if len(kept) == 0 {
+		delete(t.trees, method)
+	} else {
+		root := new(node)
+		for _, e := range kept {
+			root.addPatternRoute(e.path, e.pattern, e.handle)
+		}
+		t.trees[method] = root
+	}
+	t.globalAllowed = r.computeAllowed(t, "*", "")
+	t.clearAllowedCache()
+
+	for name, rt := range t.names {
+		if rt.method == method && r.treePattern(rt.path) == path {
+			delete(t.names, name)
+		}
+	}
+	for _, p := range patterns {
+		delete(t.grouped, method+" "+p)
+		delete(t.savesMatchedPath, method+" "+p)
+	}
+	delete(t.groupPrefixes, method+" "+removed)
+
+	switch {
+	case method == http.MethodHead && t.autoHead[path]:
+		delete(t.autoHead, path)
+	case method == http.MethodHead:
+		t.explicitHead--
+	case method == http.MethodGet && t.autoHead[path]:
+		// 自动生成的 HEAD 路由随 GET 路由一起注销
+		r.removeRoute(http.MethodHead, path)
+	}
+	return true
+}
+
+// walk 深度优先遍历以 n 为根的树，对每个注册了处理函数的完整路径调用 fn，pattern 是注册时使用的路由模式。
+func (n *node) walk(prefix string, fn func(path, pattern string, handle Handle)) {
+	path := prefix + n.path
+	if n.handle != nil {
+		fn(path, n.pattern, n.handle)
+	}
+	for _, s := range n.suffixes {
+		fn(path+catchAllSuffixPattern(s.suffix), s.pattern, s.handle)
+	}
+	for _, child := range n.children {
+		child.walk(path, fn)
+	}
+}
+
+// Conflict 描述同一 trie 位置上相互重叠的两条路由，见 ConflictReport。
+type Conflict struct {
+	Method string `json:"method"`
+
+	// Specific 是优先匹配的更具体的路由模式，例如 "/src/*filepath/raw"
+	Specific string `json:"specific"`
+
+	// General 是接收其余请求的较宽泛的路由模式，例如 "/src/*filepath"
+	General string `json:"general"`
+}
+
+// ConflictReport 静态分析各方法的 trie 树，列出可能相互遮蔽的路由对，按方法、再按路由模式排序。
+// 同一位置的静态段与参数在注册时即被拒绝（见 Handle），因此报告的是共存的 catch-all：
+// 带后缀的 catch-all 与同名的普通 catch-all（例如 "/src/*filepath/raw" 与 "/src/*filepath"），
+// 以及后缀相互包含的两个 catch-all（例如 "*path(*.x.mp4)" 与 "*path(*.mp4)"）。
+// 它只读取当前生效的路由表，不改变匹配行为，适合在上线前检查或在测试中断言为空。
+func (r *Router) ConflictReport() []Conflict {
+	var conflicts []Conflict
+	for method, root := range r.liveTable().trees {
+		root.conflicts(func(specific, general string) {
+			conflicts = append(conflicts, Conflict{Method: method, Specific: specific, General: general})
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		a, b := conflicts[i], conflicts[j]
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if a.General != b.General {
+			return a.General < b.General
+		}
+		return a.Specific < b.Specific
+	})
+	return conflicts
+}
+
+// conflicts 深度优先遍历以 n 为根的树，对同一 catch-all 叶子上相互重叠的每一对路由模式调用 fn。
+// 后缀按注册顺序尝试，因此只有先注册的较长后缀会遮蔽之后较短的后缀（反之在注册时已被拒绝）。
+func (n *node) conflicts(fn func(specific, general string)) {
+	for i, s := range n.suffixes {
+		if n.handle != nil {
+			fn(s.pattern, n.pattern)
+		}
+		for _, t := range n.suffixes[i+1:] {
+			if strings.HasSuffix(s.suffix, t.suffix) {
+				fn(s.pattern, t.pattern)
+			}
+		}
+	}
+	for _, child := range n.children {
+		child.conflicts(fn)
+	}
+}
+
+// paramNames 按出现顺序返回路由模式中的参数名（包括 catch-all 参数名，不含后缀）。
+func paramNames(pattern string) []string {
+	var names []string
+	for {
+		wildcard, i, _ := findWildcard(pattern)
+		if i < 0 {
+			return names
+		}
+		name, _ := splitParam(wildcard)
+		if wildcard[0] == '*' {
+			name, _ = splitCatchAllSuffix(wildcard[1:])
+		}
+		names = append(names, name)
+		pattern = pattern[i+len(wildcard):]
+	}
+}
+
+// ParamNames 返回已注册路由的参数名（包括 catch-all 参数名），按在路由模式中声明的顺序排列。
+// path 是注册时使用的路由模式（例如 "/users/:id/files/*filepath"），而不是具体的请求路径；
+// 路由不存在时第二个返回值为 false。可用于校验处理函数读取的参数或生成代码。
+// 路由注册时启用了 SaveMatchedRoutePath 的，列表末尾包含处理函数收到的 MatchedRoutePathParam。
+func (r *Router) ParamNames(method, path string) ([]string, bool) {
+	t := r.liveTable()
+	root := t.trees[method]
+	if root == nil {
+		return nil, false
+	}
+	found := ""
+	root.walk("", func(p, pattern string, _ Handle) {
+		if pattern == path || p == path {
+			found = p
+		}
+	})
+	if found == "" {
+		return nil, false
+	}
+	names := paramNames(path)
+	if names == nil {
+		names = []string{}
+	}
+	if t.savesMatchedPath[method+" "+found] {
+		names = append(names, MatchedRoutePathParam)
+	}
+	return names, true
+}
+
+// manifestEntry 是路由清单中的一项。
+type manifestEntry struct {
+	Method string   `json:"method"`
+	Path   string   `json:"path"`
+	Params []string `json:"params"`
+}
+
+// ServeManifest 在给定路径注册一个 GET 处理函数，以 JSON 格式返回路由表，
+// 每一项包含方法、路由模式与参数名列表。可用于服务发现或前端代码生成。
+// exclude 是一个可选的谓词，返回 true 的路由（例如管理接口）不会出现在清单中，可为 nil。
+// 清单在每次请求时根据当前路由表生成。
+func (r *Router) ServeManifest(path string, exclude func(RouteInfo) bool) *Route {
+	return r.GET(path, func(w http.ResponseWriter, req *http.Request, _ Params) {
+		entries := make([]manifestEntry, 0)
+		for _, ri := range r.Routes() {
+			if exclude != nil && exclude(ri) {
+				continue
+			}
+			params := paramNames(ri.Path)
+			if params == nil {
+				params = []string{}
+			}
+			entries = append(entries, manifestEntry{Method: ri.Method, Path: ri.Path, Params: params})
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(entries)
+	})
+}
+
+// URL 根据路由名称（见 Route.Name）与参数生成路由的路径，参数以键值对的形式给出：
+//
+//	router.URL("user", "id", "42") // "/api/v1/users/42"
+//
+// 命名参数的值会被转义为单个路径段；catch-all 参数的值是路径的剩余部分，
+// 按段转义，缺少开头的 '/' 时自动补上，带后缀的 catch-all 在值不以后缀结尾时自动追加后缀。
+// 可选参数（例如 "/files/:name?"）缺失时省略该段。
+// 名称不存在、参数缺失或参数个数为奇数时返回错误。
+func (r *Router) URL(name string, params ...string) (string, error) {
+	rt := r.liveTable().names[name]
+	if rt == nil {
+		return "", errors.New("httprouter: no route named '" + name + "'")
+	}
+	if len(params)%2 != 0 {
+		return "", errors.New("httprouter: odd number of URL parameters for route '" + name + "'")
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	var sb strings.Builder
+	pattern := rt.path
+	for {
+		wildcard, i, _ := findWildcard(pattern)
+		if i < 0 {
+			sb.WriteString(pattern)
+			return sb.String(), nil
+		}
+		sb.WriteString(pattern[:i])
+		pattern = pattern[i+len(wildcard):]
+
+		name, _ := splitParam(wildcard)
+		suffix := ""
+		if wildcard[0] == '*' {
+			name, suffix = splitCatchAllSuffix(wildcard[1:])
+		}
+		value, ok := values[name]
+		if !ok && strings.HasSuffix(wildcard, "?") {
+			// 省略可选参数，连同它之前的 '/'
+			if u := strings.TrimSuffix(sb.String(), "/"); u != "" {
+				return u, nil
+			}
+			return "/", nil
+		}
+		if !ok {
+			return "", errors.New("httprouter: missing parameter '" + name + "' for route '" + rt.path + "'")
+		}
+
+		if wildcard[0] == ':' {
+			sb.WriteString(url.PathEscape(value))
+			continue
+		}
+
+		// catch-all 总是紧跟在 '/' 之后，该 '/' 已经写出；其后的静态段在循环结束时写出
+		value = strings.TrimPrefix(value, "/")
+		if suffix != "" && !strings.HasSuffix(value, suffix) {
+			value += suffix
+		}
+		segments := strings.Split(value, "/")
+		for j, seg := range segments {
+			segments[j] = url.PathEscape(seg)
+		}
+		sb.WriteString(strings.Join(segments, "/"))
+	}
+}
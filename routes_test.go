@@ -0,0 +1,338 @@
+package httprouter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRouterRoutes(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/users/:id", handlerFunc)
+	router.POST("/users", handlerFunc)
+	router.GET("/users", handlerFunc)
+	router.Group("/api").DELETE("/items/:id", handlerFunc)
+	router.GET("/media/*path(*.mp4)", handlerFunc)
+	router.GET("/static/*filepath", handlerFunc)
+	router.Group("/").GET("/files/:name?", handlerFunc)
+
+	want := []RouteInfo{
+		{http.MethodDelete, "/api/items/:id", true},
+		{http.MethodGet, "/files/:name?", true},
+		{http.MethodGet, "/media/*path(*.mp4)", false},
+		{http.MethodGet, "/static/*filepath", false},
+		{http.MethodGet, "/users", false},
+		{http.MethodPost, "/users", false},
+		{http.MethodGet, "/users/:id", false},
+	}
+	if got := router.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes:\nwant %v\n got %v", want, got)
+	}
+}
+
+func TestParamNames(t *testing.T) {
+	tests := map[string][]string{
+		"/":                        nil,
+		"/users/:id":               {"id"},
+		"/a/:x/b/:y/*rest":         {"x", "y", "rest"},
+		"/media/*path(*.mp4)":      {"path"},
+		"/files/:name/raw/:format": {"name", "format"},
+	}
+	for pattern, want := range tests {
+		if got := paramNames(pattern); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want %v, got %v", pattern, want, got)
+		}
+	}
+}
+
+func TestRouterServeManifest(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/users/:id", handlerFunc)
+	router.GET("/files/:name?", handlerFunc)
+	router.Group("/admin").POST("/reset", handlerFunc)
+	router.ServeManifest("/manifest.json", func(ri RouteInfo) bool {
+		return strings.HasPrefix(ri.Path, "/admin/")
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/manifest.json", nil)
+	router.ServeHTTP(w, r)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("wrong content type: %q", ct)
+	}
+	var got []manifestEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	want := []manifestEntry{
+		{http.MethodGet, "/files/:name?", []string{"name"}},
+		{http.MethodGet, "/manifest.json", []string{}},
+		{http.MethodGet, "/users/:id", []string{"id"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong manifest:\nwant %v\n got %v", want, got)
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/", h).Name("home")
+	router.GET("/files/*filepath", h).Name("files")
+	router.GET("/media/*path(*.mp4)", h).Name("video")
+	router.GET("/proxy/:host/resource/*rest/raw", h).Name("proxy")
+	v1 := router.Group("/api").Group("/v1")
+	v1.GET("/users/:id", h).Name("user")
+	v1.GET("/users/:id/posts/:post", h).Name("post")
+
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+	}{
+		{"home", nil, "/"},
+		{"user", []string{"id", "42"}, "/api/v1/users/42"},
+		{"user", []string{"id", "a b/c"}, "/api/v1/users/a%20b%2Fc"},
+		{"post", []string{"post", "7", "id", "42"}, "/api/v1/users/42/posts/7"},
+		{"files", []string{"filepath", "/css/site.css"}, "/files/css/site.css"},
+		{"files", []string{"filepath", "a dir/x"}, "/files/a%20dir/x"},
+		{"video", []string{"path", "/clips/intro"}, "/media/clips/intro.mp4"},
+		{"video", []string{"path", "intro.mp4"}, "/media/intro.mp4"},
+		{"proxy", []string{"host", "h", "rest", "/a/b"}, "/proxy/h/resource/a/b/raw"},
+	}
+	for _, tt := range tests {
+		got, err := router.URL(tt.name, tt.params...)
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%q, %v): want %q, got %q (%v)", tt.name, tt.params, tt.want, got, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		params []string
+	}{
+		{"unknown", nil},
+		{"user", nil},
+		{"user", []string{"id"}},
+		{"post", []string{"id", "42"}},
+	} {
+		if _, err := router.URL(tt.name, tt.params...); err == nil {
+			t.Errorf("URL(%q, %v): expected error", tt.name, tt.params)
+		}
+	}
+
+	if recv := catchPanic(func() { router.GET("/other", h).Name("user") }); recv == nil {
+		t.Error("no panic for duplicate route name")
+	}
+
+	// names belong to the route table and are replaced by Swap
+	router.Swap(func(r *Router) {
+		r.GET("/v2/users/:id", h).Name("user")
+	})
+	if got, err := router.URL("user", "id", "1"); err != nil || got != "/v2/users/1" {
+		t.Errorf("URL after swap: got %q (%v)", got, err)
+	}
+	if _, err := router.URL("home"); err == nil {
+		t.Error("name from replaced route table still resolvable")
+	}
+}
+
+func TestRouterParamNames(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/", h)
+	router.GET("/users/:id/files/*filepath", h)
+	router.GET("/media/*path(*.mp4)", h)
+	router.POST("/users/:id/posts/:post", h)
+	router.GET("/files/:name?", h)
+
+	tests := []struct {
+		method, path string
+		names        []string
+		ok           bool
+	}{
+		{http.MethodGet, "/", []string{}, true},
+		{http.MethodGet, "/users/:id/files/*filepath", []string{"id", "filepath"}, true},
+		{http.MethodGet, "/media/*path(*.mp4)", []string{"path"}, true},
+		{http.MethodPost, "/users/:id/posts/:post", []string{"id", "post"}, true},
+		{http.MethodGet, "/files/:name?", []string{"name"}, true},
+		{http.MethodGet, "/users/:id/posts/:post", nil, false},
+		{http.MethodPost, "/users/42/posts/7", nil, false},
+		{http.MethodPut, "/", nil, false},
+	}
+	for _, tt := range tests {
+		names, ok := router.ParamNames(tt.method, tt.path)
+		if ok != tt.ok || !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("ParamNames(%s, %s): want %v %v, got %v %v", tt.method, tt.path, tt.names, tt.ok, names, ok)
+		}
+	}
+
+	router = New()
+	router.SaveMatchedRoutePath = true
+	router.GET("/users/:id/files/*filepath", h)
+	want := []string{"id", "filepath", MatchedRoutePathParam}
+	if names, ok := router.ParamNames(http.MethodGet, "/users/:id/files/*filepath"); !ok || !reflect.DeepEqual(names, want) {
+		t.Errorf("with SaveMatchedRoutePath: want %v, got %v %v", want, names, ok)
+	}
+
+	// the flag only affects routes registered while it is set
+	router.SaveMatchedRoutePath = false
+	router.GET("/posts/:post", h)
+	if names, ok := router.ParamNames(http.MethodGet, "/posts/:post"); !ok || !reflect.DeepEqual(names, []string{"post"}) {
+		t.Errorf("registered without SaveMatchedRoutePath: want [post], got %v %v", names, ok)
+	}
+	if names, _ := router.ParamNames(http.MethodGet, "/users/:id/files/*filepath"); !reflect.DeepEqual(names, want) {
+		t.Errorf("after disabling SaveMatchedRoutePath: want %v, got %v", want, names)
+	}
+}
+
+func TestRouterConflictReport(t *testing.T) {
+	router := New()
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router.GET("/users/:id", h)
+	router.GET("/src/*filepath", h)
+	router.GET("/src/*filepath/x", h)
+	router.GET("/media/*path(*.x.mp4)", h)
+	router.GET("/media/*path(*.mp4)", h)
+	router.GET("/media/*path(*.ogg)", h)
+	router.POST("/src/*filepath(*.go)", h)
+
+	if got := New().ConflictReport(); got != nil {
+		t.Errorf("empty router: want no conflicts, got %v", got)
+	}
+
+	// a static segment next to a param is rejected at registration instead
+	if err := router.TryHandle(http.MethodGet, "/users/me", h); !errors.Is(err, ErrRouteConflict) {
+		t.Fatalf("/users/me next to /users/:id: want ErrRouteConflict, got %v", err)
+	}
+
+	want := []Conflict{
+		{Method: http.MethodGet, Specific: "/media/*path(*.x.mp4)", General: "/media/*path(*.mp4)"},
+		{Method: http.MethodGet, Specific: "/src/*filepath/x", General: "/src/*filepath"},
+	}
+	if got := router.ConflictReport(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestRouterRemoveRoute(t *testing.T) {
+	handler := func(body string) Handle {
+		return func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Write([]byte(body))
+		}
+	}
+
+	router := New()
+	router.GET("/users/:id", handler("get user")).Name("user")
+	router.PUT("/users/:id", handler("put user"))
+	router.GET("/users/:id/posts", handler("posts"))
+	router.Group("/").GET("/files/:name?", handler("file"))
+	router.GET("/media/*path", handler("media"))
+	router.GET("/media/*path(*.mp4)", handler("video"))
+	router.DELETE("/items/:id(\\d+)", handler("delete"))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+	// populate the allowed cache before removing
+	serve(http.MethodPost, "/users/1")
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/users/1"},            // request path, not a pattern
+		{http.MethodGet, "/users/:user"},        // different parameter name
+		{http.MethodGet, "/users"},              // prefix of a route
+		{http.MethodPost, "/users/:id"},         // method without routes
+		{http.MethodDelete, "/items/:id"},       // constraint missing
+		{http.MethodGet, "/media/*path(*.mp3)"}, // unknown suffix
+	} {
+		if router.RemoveRoute(tc.method, tc.path) {
+			t.Errorf("%s %s removed although not registered", tc.method, tc.path)
+		}
+	}
+
+	if !router.RemoveRoute(http.MethodGet, "/users/:id") {
+		t.Fatal("registered route not removed")
+	}
+	if router.RemoveRoute(http.MethodGet, "/users/:id") {
+		t.Error("route removed twice")
+	}
+	if w := serve(http.MethodGet, "/users/1"); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "OPTIONS, PUT" {
+		t.Errorf("removed route still allowed: %d %q", w.Code, w.Header().Get("Allow"))
+	}
+	if w := serve(http.MethodPost, "/users/1"); w.Header().Get("Allow") != "OPTIONS, PUT" {
+		t.Errorf("stale Allow header after removal: %q", w.Header().Get("Allow"))
+	}
+	if w := serve(http.MethodGet, "/users/1/posts"); w.Body.String() != "posts" {
+		t.Errorf("sibling route lost: %d %q", w.Code, w.Body.String())
+	}
+	if _, err := router.URL("user"); err == nil {
+		t.Error("name of removed route still registered")
+	}
+
+	// optional parameters are removed in both forms, and only by their pattern
+	for _, half := range []string{"/files", "/files/:name"} {
+		if router.RemoveRoute(http.MethodGet, half) {
+			t.Errorf("%s removed one form of /files/:name?", half)
+		}
+	}
+	if w := serve(http.MethodGet, "/files"); w.Body.String() != "file" {
+		t.Errorf("optional route damaged by partial removal: %d %q", w.Code, w.Body.String())
+	}
+	if !router.RemoveRoute(http.MethodGet, "/files/:name?") {
+		t.Error("optional route not removed")
+	}
+	for _, path := range []string{"/files", "/files/a"} {
+		if w := serve(http.MethodGet, path); w.Code != http.StatusNotFound {
+			t.Errorf("%s still served: %d", path, w.Code)
+		}
+	}
+
+	// the plain catch-all and its suffixed variant are independent
+	if !router.RemoveRoute(http.MethodGet, "/media/*path") {
+		t.Error("catch-all not removed")
+	}
+	if w := serve(http.MethodGet, "/media/a.mp4"); w.Body.String() != "video" {
+		t.Errorf("suffixed catch-all lost: %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/media/a.mp3"); w.Code != http.StatusNotFound {
+		t.Errorf("removed catch-all still served: %d", w.Code)
+	}
+
+	// removing the last route of a method drops the method entirely
+	if !router.RemoveRoute(http.MethodDelete, "/items/:id(\\d+)") {
+		t.Error("constrained route not removed")
+	}
+	if _, ok := router.liveTable().trees[http.MethodDelete]; ok {
+		t.Error("empty method tree not deleted")
+	}
+	if w := serve(http.MethodOptions, "*"); w.Header().Get("Allow") != "GET, OPTIONS, PUT" {
+		t.Errorf("wrong global Allow after removal: %q", w.Header().Get("Allow"))
+	}
+
+	want := []RouteInfo{
+		{http.MethodGet, "/media/*path(*.mp4)", false},
+		{http.MethodPut, "/users/:id", false},
+		{http.MethodGet, "/users/:id/posts", false},
+	}
+	if got := router.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes after removal:\nwant %v\n got %v", want, got)
+	}
+
+	// a removed route can be registered again
+	router.GET("/users/:id", handler("new user"))
+	if w := serve(http.MethodGet, "/users/1"); w.Body.String() != "new user" {
+		t.Errorf("re-registered route not served: %d %q", w.Code, w.Body.String())
+	}
+}
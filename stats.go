@@ -0,0 +1,83 @@
+package httprouter
+
+import "unsafe"
+
+// TreeStats 描述一个方法的 trie 树的规模，见 Router.Stats。
+type TreeStats struct {
+	// Routes 是树中注册的处理函数数量（可选参数的路由计为两个）
+	Routes int
+
+	// Nodes 是树的节点总数，其中 ParamNodes 个是命名参数节点，CatchAllNodes 个是 catch-all 节点
+	Nodes         int
+	ParamNodes    int
+	CatchAllNodes int
+
+	// MaxDepth 是从根节点到最深节点经过的节点数，根节点的深度为 1
+	MaxDepth int
+
+	// MaxFanOut 是单个节点拥有的最大子节点数。
+	// 很大的值意味着许多路由在同一位置分叉（例如大量共享前缀的静态路由），查找时需要逐个比较索引字符。
+	MaxFanOut int
+
+	// Bytes 是树占用内存的近似值：节点结构体本身以及节点中的路径、索引与子节点切片，
+	// 不包括处理函数与约束的正则表达式。
+	Bytes int
+}
+
+// RouterStats 是路由器的 trie 树统计，见 Router.Stats。
+type RouterStats struct {
+	// Methods 是各方法的树的统计
+	Methods map[string]TreeStats
+
+	// Total 是所有方法的汇总：数量与字节数相加，MaxDepth 与 MaxFanOut 取最大值
+	Total TreeStats
+}
+
+// Stats 遍历当前生效路由表中各方法的 trie 树，返回节点数量、最大深度、参数节点数量与近似的内存占用，
+// 用于了解大量路由占用的内存，以及路由的命名是否导致过多的分叉。
+// 它读取路由表快照，可以与请求处理并发调用；遍历所有节点，不适合在请求路径上频繁调用。
+func (r *Router) Stats() RouterStats {
+	stats := RouterStats{Methods: make(map[string]TreeStats)}
+	for method, root := range r.liveTable().trees {
+		var ts TreeStats
+		root.stats(&ts, 1)
+		stats.Methods[method] = ts
+
+		total := &stats.Total
+		total.Routes += ts.Routes
+		total.Nodes += ts.Nodes
+		total.ParamNodes += ts.ParamNodes
+		total.CatchAllNodes += ts.CatchAllNodes
+		total.MaxDepth = max(total.MaxDepth, ts.MaxDepth)
+		total.MaxFanOut = max(total.MaxFanOut, ts.MaxFanOut)
+		total.Bytes += ts.Bytes
+	}
+	return stats
+}
+
+// stats 将以 n 为根、深度为 depth 的子树累加到 ts。
+func (n *node) stats(ts *TreeStats, depth int) {
+	ts.Nodes++
+	switch n.nType {
+	case param:
+		ts.ParamNodes++
+	case catchAll:
+		ts.CatchAllNodes++
+	}
+	if n.handle != nil {
+		ts.Routes++
+	}
+	ts.Routes += len(n.suffixes)
+	ts.MaxDepth = max(ts.MaxDepth, depth)
+	ts.MaxFanOut = max(ts.MaxFanOut, len(n.children))
+
+	ts.Bytes += int(unsafe.Sizeof(*n)) + len(n.path) + len(n.indices) +
+		cap(n.children)*int(unsafe.Sizeof(n)) + cap(n.suffixes)*int(unsafe.Sizeof(catchAllSuffix{}))
+	for _, s := range n.suffixes {
+		ts.Bytes += len(s.suffix)
+	}
+
+	for _, child := range n.children {
+		child.stats(ts, depth+1)
+	}
+}
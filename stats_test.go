@@ -0,0 +1,52 @@
+package httprouter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterStats(t *testing.T) {
+	router := New()
+	if stats := router.Stats(); len(stats.Methods) != 0 || stats.Total != (TreeStats{}) {
+		t.Errorf("stats of an empty router: %+v", stats)
+	}
+
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	for _, path := range []string{
+		"/",
+		"/users",
+		"/users/:id",
+		"/users/:id/posts",
+		"/static/*filepath",
+		"/media/*path(*.mp4)",
+		"/media/*path(*.webm)",
+	} {
+		router.GET(path, h)
+	}
+	router.POST("/users", h)
+
+	// GET tree:
+	//   /                      (route)
+	//   ├── users              (route)
+	//   │   └── /
+	//   │       └── :id        (route)
+	//   │           └── /posts (route)
+	//   ├── static/ -> catch-all -> /*filepath (route)
+	//   └── media/  -> catch-all -> /*path     (2 suffix routes)
+	stats := router.Stats()
+	get := stats.Methods[http.MethodGet]
+	want := TreeStats{Routes: 7, Nodes: 11, ParamNodes: 1, CatchAllNodes: 4, MaxDepth: 5, MaxFanOut: 3, Bytes: get.Bytes}
+	if get != want {
+		t.Errorf("GET stats: want %+v, got %+v", want, get)
+	}
+	post := stats.Methods[http.MethodPost]
+	if post.Routes != 1 || post.Nodes != 1 || post.MaxDepth != 1 || post.MaxFanOut != 0 {
+		t.Errorf("POST stats: %+v", post)
+	}
+	if get.Bytes <= post.Bytes || post.Bytes <= 0 {
+		t.Errorf("implausible byte counts: GET %d, POST %d", get.Bytes, post.Bytes)
+	}
+	if stats.Total.Nodes != 12 || stats.Total.Routes != 8 || stats.Total.MaxDepth != 5 || stats.Total.Bytes != get.Bytes+post.Bytes {
+		t.Errorf("wrong totals: %+v", stats.Total)
+	}
+}
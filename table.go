@@ -0,0 +1,312 @@
+package httprouter
+
+import (
+	"container/list"
+	"hash/maphash"
+	"maps"
+	"sync"
+)
+
+// routeTable 是一份完整的路由表：各方法的 trie 树以及由它们派生的数据。
+// 请求期间路由器通过原子指针读取当前生效的路由表（见 Router.Swap），
+// 一个请求从开始到结束始终使用同一份路由表。
+type routeTable struct {
+	trees map[string]*node
+
+	paramsPool sync.Pool
+	maxParams  uint16
+
+	// 全局 (*) 允许方法的缓存值
+	globalAllowed string
+
+	// 特定路径允许方法的缓存，惰性填充，在路由表变更时清空
+	allowedCache allowedCache
+
+	// 具名路由，见 Route.Name
+	names map[string]*Route
+
+	// 通过 Group 注册的路由，键为 "方法 路径"，见 Routes
+	grouped map[string]bool
+
+	// 通过 Group 注册的路由所属的组前缀，键为 "方法 路由模式"（注册时的形式），见 groupErrorHandlerFor
+	groupPrefixes map[string]string
+
+	// 启用 SaveMatchedRoutePath 时注册、处理函数收到 MatchedRoutePathParam 的路由，键为 "方法 路径"，见 ParamNames
+	savesMatchedPath map[string]bool
+
+	// AutoHead 自动生成的 HEAD 路由的路径，以及显式注册的 HEAD 路由的数量
+	autoHead     map[string]bool
+	explicitHead int
+}
+
+// emptyRouteTable 是尚未注册任何路由时使用的路由表。
+var emptyRouteTable = &routeTable{}
+
+func (t *routeTable) getParams() *Params {
+	ps, _ := t.paramsPool.Get().(*Params)
+	*ps = (*ps)[0:0] // 重置切片
+	return ps
+}
+
+func (t *routeTable) putParams(ps *Params) {
+	if ps != nil {
+		t.paramsPool.Put(ps)
+	}
+}
+
+// clearAllowedCache 清空 allowed 的缓存，在路由表变更时调用。
+func (t *routeTable) clearAllowedCache() {
+	t.allowedCache.clear()
+}
+
+const (
+	// allowedCacheShards 是 allowedCache 的分片数
+	allowedCacheShards = 16
+	// allowedCacheShardSize 是每个分片的最大条目数
+	allowedCacheShardSize = 64
+	// allowedCacheMaxPath 是缓存的路径的最大长度，更长的路径每次重新计算
+	allowedCacheMaxPath = 256
+)
+
+// allowedCacheSeed 是 allowedCache 选择分片时使用的哈希种子。
+var allowedCacheSeed = maphash.MakeSeed()
+
+// allowedCache 缓存特定路径允许的方法列表（见 Router.allowed）。
+// 带参数的路由可以匹配无数个不同的路径，因此缓存按路径的哈希分片，每个分片是一个有界的 LRU 缓存：
+// 任意的请求路径不会让缓存无限增长，也不会把常用的路径挤出整个缓存，并发的请求分散在不同分片的锁上。
+// 零值可以直接使用。
+type allowedCache struct {
+	shards [allowedCacheShards]allowedCacheShard
+}
+
+type allowedCacheShard struct {
+	mu      sync.Mutex
+	entries map[allowedCacheKey]*list.Element
+	lru     list.List // 元素为 allowedCacheEntry，最近使用的在前
+}
+
+type allowedCacheEntry struct {
+	key   allowedCacheKey
+	allow string
+}
+
+func (c *allowedCache) shard(key allowedCacheKey) *allowedCacheShard {
+	return &c.shards[maphash.String(allowedCacheSeed, key.path)%allowedCacheShards]
+}
+
+// get 返回 key 缓存的方法列表。
+func (c *allowedCache) get(key allowedCacheKey) (allow string, ok bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return "", false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(allowedCacheEntry).allow, true
+}
+
+// put 缓存 key 的方法列表，分片已满时淘汰最久未使用的条目。过长的路径不缓存。
+func (c *allowedCache) put(key allowedCacheKey, allow string) {
+	if len(key.path) > allowedCacheMaxPath {
+		return
+	}
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(e)
+		return
+	}
+	if s.entries == nil {
+		s.entries = make(map[allowedCacheKey]*list.Element)
+	}
+	if s.lru.Len() >= allowedCacheShardSize {
+		oldest := s.lru.Back()
+		delete(s.entries, s.lru.Remove(oldest).(allowedCacheEntry).key)
+	}
+	s.entries[key] = s.lru.PushFront(allowedCacheEntry{key: key, allow: allow})
+}
+
+// clear 清空所有分片。
+func (c *allowedCache) clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.entries = nil
+		s.lru.Init()
+		s.mu.Unlock()
+	}
+}
+
+// len 返回缓存的条目数。
+func (c *allowedCache) len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// AllocStats 是路由器的分配统计，用于诊断与调优，见 Router.AllocStats。
+type AllocStats struct {
+	// ParamsPoolMisses 是自路由器创建以来 Params 池未命中、需要新分配 Params 的次数。
+	// 池在稳定负载下应当很少未命中；持续增长的未命中次数通常意味着并发量变化剧烈，
+	// 或者池中的对象频繁被 GC 回收。
+	ParamsPoolMisses uint64
+
+	// MaxParams 是当前路由表中单个路由的最大参数数量，即每次分配的 Params 容量。
+	MaxParams uint16
+}
+
+// AllocStats 返回路由器的分配统计。它可以在处理请求期间安全地并发调用。
+func (r *Router) AllocStats() AllocStats {
+	return AllocStats{
+		ParamsPoolMisses: r.paramsAllocs.Load(),
+		MaxParams:        r.liveTable().maxParams,
+	}
+}
+
+// liveTable 返回当前生效的路由表。
+func (r *Router) liveTable() *routeTable {
+	if t := r.table.Load(); t != nil {
+		return t
+	}
+	return emptyRouteTable
+}
+
+// Swap 原子地替换整个路由表，用于零停机地重新加载路由配置。
+// build 在一份全新的空路由表上注册路由（通过传入的路由器调用 GET、Group 等，用法与平常一致），
+// build 返回后新路由表一次性生效：已经开始处理的请求继续使用旧路由表直到结束，
+// 之后到达的请求使用新路由表，不存在只注册了一部分路由的中间状态。
+//
+// 在 build 执行期间，路由器照常使用旧路由表处理请求，无需加锁。
+// 如果 build 发生 panic（例如路由冲突），旧路由表保持不变，panic 会继续向上传播。
+// 路由器的配置（中间件、错误处理器等）不受影响，Swap 只替换路由。
+// 多个 Swap 调用会依次执行；与 HandleBatch 相同，执行期间其他 goroutine 的注册写入新路由表。
+func (r *Router) Swap(build func(*Router)) {
+	if build == nil {
+		panic("build function must not be nil")
+	}
+	r.stage(func(*routeTable) *routeTable { return &routeTable{} }, true, func() { build(r) })
+}
+
+// HandleBatch 在当前路由表的副本上执行 build 中的所有注册，然后使它们一次性生效：
+//
+//	router.HandleBatch(func(r *httprouter.Router) {
+//		api := r.Group("/plugins/foo")
+//		api.GET("/status", status)
+//		api.POST("/reload", reload).Name("foo-reload")
+//	})
+//
+// 路由器开始处理请求（第一次调用 ServeHTTP）之后，Handle 等注册方法同样可以与请求处理并发调用：
+// 每次注册复制一份路由表，在副本上添加路由后原子地替换当前路由表，请求处理始终无锁地读取完整的路由表，
+// 读取路径没有额外开销。相应地，这种注册的代价与已注册的路由数量成正比；
+// 需要在运行时一次注册许多路由时，使用 HandleBatch 只复制一次。
+// 路由的后续配置（Name、守卫、匹配规则等）也应在 build 中完成，使路由以完整的配置生效。
+//
+// 与 Swap 一样，build 发生 panic 时当前路由表保持不变。
+// 开始处理请求之后的注册依次执行；HandleBatch 与 Swap 执行期间其他 goroutine 的注册同样写入正在构建的路由表，
+// 随批次一起生效（build 发生 panic 时也随批次一起被丢弃）。
+func (r *Router) HandleBatch(build func(*Router)) {
+	if build == nil {
+		panic("build function must not be nil")
+	}
+	r.stage(r.cloneTable, true, func() { build(r) })
+}
+
+// mutate 执行一次路由注册 fn。路由器开始处理请求之后，fn 在当前路由表的副本上执行，完成后副本原子地生效；
+// 否则 fn 直接修改 r.routes。
+// Swap 与 HandleBatch 执行期间，无论注册来自 build 还是其他 goroutine，fn 都在 batchMu 的保护下
+// 直接写入正在构建的路由表，随批次一起生效。
+func (r *Router) mutate(fn func()) {
+	if !r.serving.Load() {
+		fn()
+		return
+	}
+	if r.batching.Load() {
+		r.batchMu.Lock()
+		// 批次可能在获取 batchMu 之前已经结束，此时 r.routes 已经生效，不能再直接修改
+		if r.batching.Load() {
+			defer r.batchMu.Unlock()
+			fn()
+			return
+		}
+		r.batchMu.Unlock()
+	}
+	r.stage(r.cloneTable, false, fn)
+}
+
+// stage 将 r.routes 替换为 next 基于它返回的新路由表，执行 fn 后使新路由表生效。
+// fn 发生 panic 时恢复原来的路由表。batch 表示 fn 中的注册直接写入新路由表，见 mutate。
+func (r *Router) stage(next func(*routeTable) *routeTable, batch bool, fn func()) {
+	r.swapMu.Lock()
+	defer r.swapMu.Unlock()
+
+	old := r.routes
+	staging := next(old)
+	if batch {
+		r.batchMu.Lock()
+		r.routes = staging
+		r.batching.Store(true)
+		r.batchMu.Unlock()
+	} else {
+		r.routes = staging
+	}
+	published := false
+	defer func() {
+		if batch {
+			// 生效与结束批次在同一临界区内完成，之后到达的注册不会再写入已经生效的路由表
+			r.batchMu.Lock()
+			defer r.batchMu.Unlock()
+			r.batching.Store(false)
+		}
+		if published {
+			r.table.Store(staging)
+		} else {
+			r.routes = old
+		}
+	}()
+
+	fn()
+	published = true
+}
+
+// cloneTable 返回 t 的副本：trie 树与具名路由等登记被复制，allowed 缓存与 Params 池重新开始。
+func (r *Router) cloneTable(t *routeTable) *routeTable {
+	c := &routeTable{}
+	if t == nil {
+		return c
+	}
+	c.maxParams = t.maxParams
+	c.globalAllowed = t.globalAllowed
+	if t.trees != nil {
+		c.trees = make(map[string]*node, len(t.trees))
+		for method, root := range t.trees {
+			c.trees[method] = root.clone()
+		}
+	}
+	c.names = maps.Clone(t.names)
+	c.grouped = maps.Clone(t.grouped)
+	c.savesMatchedPath = maps.Clone(t.savesMatchedPath)
+	c.groupPrefixes = maps.Clone(t.groupPrefixes)
+	c.autoHead = maps.Clone(t.autoHead)
+	c.explicitHead = t.explicitHead
+	r.initParamsPool(c)
+	return c
+}
+
+// initParamsPool 在路由表需要 Params 时初始化它的 Params 池。
+func (r *Router) initParamsPool(t *routeTable) {
+	if t.paramsPool.New == nil && t.maxParams > 0 {
+		t.paramsPool.New = func() interface{} {
+			r.paramsAllocs.Add(1)
+			ps := make(Params, 0, t.maxParams)
+			return &ps
+		}
+	}
+}
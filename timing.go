@@ -0,0 +1,59 @@
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// serverTiming 记录一次请求中路由匹配与处理程序执行的耗时，
+// 用于在 Router.EmitServerTiming 启用时生成 Server-Timing 头部。
+type serverTiming struct {
+	start    time.Time // 进入核心路由逻辑的时间
+	routedAt time.Time // 路由匹配完成的时间
+	written  bool      // 标记 Server-Timing 头部是否已经写入
+}
+
+func newServerTiming() *serverTiming {
+	return &serverTiming{start: time.Now()}
+}
+
+// routed 标记路由匹配阶段结束。重复调用只记录第一次。
+func (st *serverTiming) routed() {
+	if st.routedAt.IsZero() {
+		st.routedAt = time.Now()
+	}
+}
+
+// writeHeader 将当前的耗时写入 Server-Timing 头部。
+// 处理程序耗时统计到调用时刻为止（即首字节写出之前）。
+func (st *serverTiming) writeHeader(h http.Header) {
+	if st.written {
+		return
+	}
+	st.written = true
+
+	now := time.Now()
+	st.routed()
+	if st.routedAt.After(now) {
+		st.routedAt = now
+	}
+
+	h.Add("Server-Timing", "route;dur="+formatTimingDuration(st.routedAt.Sub(st.start))+
+		", handler;dur="+formatTimingDuration(now.Sub(st.routedAt)))
+}
+
+// finish 在核心处理结束后调用。
+// 如果响应尚未开始（例如处理程序没有写出任何内容），此时写入完整的耗时，
+// net/http 随后隐式写出头部时会包含它；如果响应已经开始，则不做任何事。
+func (st *serverTiming) finish(scw *statusCapturingResponseWriter) {
+	if scw.started {
+		return
+	}
+	st.writeHeader(scw.Header())
+}
+
+// formatTimingDuration 将时长格式化为 Server-Timing 使用的毫秒数。
+func formatTimingDuration(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
@@ -0,0 +1,131 @@
+package httprouter
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TransformMaxBuffer 是 Transform 为单个响应缓冲的最大字节数。
+// 响应体超过该大小时放弃转换，已缓冲的内容与后续数据原样写出。
+var TransformMaxBuffer = 8 << 20
+
+// Transform 返回一个改写响应体的中间件：状态码为 200 且媒体类型为 contentType（忽略参数与大小写，
+// 例如 "text/html"）的响应会被完整缓冲，处理结束后以 fn(body) 的结果替换响应体，并重新设置 Content-Length。
+// 典型用途是向静态文件服务器返回的 HTML 中注入脚本标签。
+//
+// 以下响应不做转换，原样写出：
+//   - 媒体类型不匹配、状态码不是 200（例如 206 Range 响应、304）或设置了 Content-Encoding 的响应；
+//   - HEAD 请求的响应；
+//   - 超过 TransformMaxBuffer 的响应；
+//   - 处理程序调用了 Flush 的流式响应（从 Flush 开始原样写出）。
+//
+// 未设置 Content-Type 的响应与 net/http 一样根据首次写入的数据推断类型。
+func Transform(contentType string, fn func([]byte) []byte) Middleware {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				next.ServeHTTP(w, req)
+				return
+			}
+			tw := &transformWriter{w: w, contentType: contentType}
+			next.ServeHTTP(tw, req)
+			if tw.buffering {
+				body := fn(tw.buf)
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.WriteHeader(tw.status)
+				w.Write(body)
+			}
+		})
+	}
+}
+
+// transformWriter 在响应匹配时缓冲状态码与响应体，否则直接代理到原始 ResponseWriter。
+type transformWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	wroteHeader bool
+	buffering   bool
+	status      int
+	buf         []byte
+}
+
+func (tw *transformWriter) Header() http.Header {
+	return tw.w.Header()
+}
+
+// WriteHeader 决定是否缓冲该响应。1xx 信息性响应（101 除外）直接写出。
+func (tw *transformWriter) WriteHeader(statusCode int) {
+	if tw.wroteHeader {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		tw.w.WriteHeader(statusCode)
+		return
+	}
+	tw.wroteHeader = true
+	tw.status = statusCode
+	if tw.matches() {
+		tw.buffering = true
+		return
+	}
+	tw.w.WriteHeader(statusCode)
+}
+
+func (tw *transformWriter) matches() bool {
+	h := tw.w.Header()
+	if tw.status != http.StatusOK || h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mediaType == tw.contentType
+}
+
+func (tw *transformWriter) Write(data []byte) (int, error) {
+	if !tw.wroteHeader {
+		if tw.w.Header().Get("Content-Type") == "" {
+			tw.w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		tw.WriteHeader(http.StatusOK)
+	}
+	if !tw.buffering {
+		return tw.w.Write(data)
+	}
+	if len(tw.buf)+len(data) > TransformMaxBuffer {
+		if err := tw.bypass(); err != nil {
+			return 0, err
+		}
+		return tw.w.Write(data)
+	}
+	tw.buf = append(tw.buf, data...)
+	return len(data), nil
+}
+
+// bypass 放弃转换，写出状态码与已缓冲的内容，此后的数据直接写出。
+func (tw *transformWriter) bypass() error {
+	tw.buffering = false
+	tw.w.WriteHeader(tw.status)
+	_, err := tw.w.Write(tw.buf)
+	tw.buf = nil
+	return err
+}
+
+// Flush 表示流式响应：放弃转换，写出已缓冲的内容并刷新。
+func (tw *transformWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.buffering {
+		tw.bypass()
+	}
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用。
+func (tw *transformWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
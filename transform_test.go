@@ -0,0 +1,72 @@
+package httprouter
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	inject := Transform("text/html", func(b []byte) []byte {
+		return bytes.Replace(b, []byte("</body>"), []byte("<script></script></body>"), 1)
+	})
+
+	router := New()
+	router.Use(inject)
+	router.GET("/page", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", "26")
+		w.Write([]byte("<html><body>"))
+		w.Write([]byte("hi</body></html>"))
+	})
+	router.GET("/sniffed", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("<html><body></body></html>"))
+	})
+	router.GET("/data", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"body":"</body>"}`))
+	})
+	router.GET("/stream", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<body>"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("</body>"))
+	})
+	router.GET("/large", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(bytes.Repeat([]byte("a"), TransformMaxBuffer))
+		w.Write([]byte("</body>"))
+	})
+
+	for _, tc := range []struct {
+		path, body string
+	}{
+		{"/page", "<html><body>hi<script></script></body></html>"},
+		{"/sniffed", "<html><body><script></script></body></html>"},
+		{"/data", `{"body":"</body>"}`},
+		{"/stream", "<body></body>"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != tc.body {
+			t.Errorf("%s: want body %q, got %d %q", tc.path, tc.body, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/page", nil)
+	router.ServeHTTP(w, r)
+	if cl := w.Header().Get("Content-Length"); cl != "45" {
+		t.Errorf("Content-Length not updated: %q", cl)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/large", nil)
+	router.ServeHTTP(w, r)
+	if w.Body.Len() != TransformMaxBuffer+7 || strings.Contains(w.Body.String(), "<script>") {
+		t.Errorf("oversized response transformed or truncated: %d bytes", w.Body.Len())
+	}
+}
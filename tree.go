@@ -5,6 +5,7 @@
 package httprouter
 
 import (
+	"regexp"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -26,8 +27,66 @@ func longestCommonPrefix(a, b string) int {
 	return i
 }
 
+// foldCase returns path in lower case for case-insensitive matching. A rune is
+// only replaced if its lower case has the same encoded length, so that byte
+// offsets into the folded path are valid for the original path as well.
+// If nothing needs to be folded, path itself is returned without allocating.
+func foldCase(path string) string {
+	var b []byte
+	for i := 0; i < len(path); {
+		c := path[i]
+		if c < utf8.RuneSelf {
+			if 'A' <= c && c <= 'Z' {
+				if b == nil {
+					b = []byte(path)
+				}
+				b[i] = c + 'a' - 'A'
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(path[i:])
+		if lo := unicode.ToLower(r); lo != r && utf8.RuneLen(lo) == size {
+			if b == nil {
+				b = []byte(path)
+			}
+			utf8.EncodeRune(b[i:], lo)
+		}
+		i += size
+	}
+	if b == nil {
+		return path
+	}
+	return string(b)
+}
+
+// foldPattern applies foldCase to the static parts of a route pattern.
+// Wildcard names and constraints are kept as they are.
+func foldPattern(path string) string {
+	var b strings.Builder
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			b.WriteString(foldCase(path))
+			return b.String()
+		}
+		b.WriteString(foldCase(path[:i]))
+		if wildcard[0] == '*' {
+			// A catch-all may be followed by a static suffix, e.g. '*path(*.MP4)'
+			name, suffix := splitCatchAllSuffix(wildcard)
+			b.WriteString(name)
+			b.WriteString(catchAllSuffixPattern(foldCase(suffix)))
+		} else {
+			b.WriteString(wildcard)
+		}
+		path = path[i+len(wildcard):]
+	}
+}
+
 // Search for a wildcard segment and check the name for invalid characters.
 // Returns -1 as index, if no wildcard was found.
+// A named parameter may be followed by a regular expression constraint in
+// parentheses, e.g. ':id(\d+)', which is returned as part of the wildcard.
 func findWildcard(path string) (wilcard string, i int, valid bool) {
 	// Find start
 	for start, c := range []byte(path) {
@@ -38,12 +97,31 @@ func findWildcard(path string) (wilcard string, i int, valid bool) {
 
 		// Find end and check for invalid characters
 		valid = true
-		for end, c := range []byte(path[start+1:]) {
-			switch c {
-			case '/':
-				return path[start : start+1+end], start, valid
-			case ':', '*':
+		constrained := false
+		for end := start + 1; end < len(path); end++ {
+			switch c := path[end]; {
+			case c == '/':
+				return path[start:end], start, valid
+			case constrained:
+				// Nothing may follow the constraint within the segment
+				valid = false
+			case c == ':' || c == '*':
 				valid = false
+			case c == '(' && path[start] == ':':
+				close := constraintEnd(path, end)
+				if close < 0 {
+					return path[start:], start, false
+				}
+				end = close
+				constrained = true
+			case c == '(' && path[start] == '*' && strings.HasPrefix(path[end:], "(*"):
+				// Required suffix of a catch-all, e.g. '*path(*.mp4)'
+				close := strings.IndexAny(path[end:], ")/")
+				if close <= 2 || path[end+close] != ')' {
+					return path[start:], start, false
+				}
+				end += close
+				constrained = true
 			}
 		}
 		return path[start:], start, valid
@@ -51,15 +129,61 @@ func findWildcard(path string) (wilcard string, i int, valid bool) {
 	return "", -1, false
 }
 
+// constraintEnd returns the index of the ')' closing the regular expression
+// constraint which starts with the '(' at path[open], or -1 if it is not
+// closed. Escaped characters and character classes are skipped.
+func constraintEnd(path string, open int) int {
+	depth := 0
+	for i := open; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			i++
+		case '[':
+			// Skip the character class; a ']' right after '[' or '[^' is literal
+			i++
+			if i < len(path) && path[i] == '^' {
+				i++
+			}
+			if i < len(path) && path[i] == ']' {
+				i++
+			}
+			for i < len(path) && path[i] != ']' {
+				if path[i] == '\\' {
+					i++
+				}
+				i++
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitParam splits a named parameter wildcard like ':id(\d+)' into its
+// name 'id' and the regular expression constraint '\d+', if any.
+func splitParam(wildcard string) (name, constraint string) {
+	wildcard = strings.TrimSuffix(wildcard, "?") // optional parameter, see Router.Handle
+	if i := strings.IndexByte(wildcard, '('); i > 0 {
+		return wildcard[1:i], wildcard[i+1 : len(wildcard)-1]
+	}
+	return wildcard[1:], ""
+}
+
 func countParams(path string) uint16 {
 	var n uint16
-	for i := range []byte(path) {
-		switch path[i] {
-		case ':', '*':
-			n++
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			return n
 		}
+		n++
+		path = path[i+len(wildcard):]
 	}
-	return n
 }
 
 type nodeType uint8
@@ -79,6 +203,139 @@ type node struct {
 	priority  uint32
 	children  []*node
 	handle    Handle
+
+	// Route pattern as it was registered, e.g. '/files/:name?' for both
+	// forms of an optional param or '/Users/:id' with case-insensitive
+	// matching. Only set on nodes with a handle.
+	pattern string
+
+	// Handles of catch-all routes with a required suffix, e.g. /*path(*.mp4).
+	// Only used on the catch-all leaf node, tried in registration order.
+	suffixes []catchAllSuffix
+
+	// Regular expression constraint of a param node, e.g. :id(\d+).
+	// Compiled once at registration time and anchored to the whole segment.
+	constraint *regexp.Regexp
+}
+
+// paramKey returns the name of the parameter of a param node.
+func (n *node) paramKey() string {
+	if n.constraint != nil {
+		return n.path[1:strings.IndexByte(n.path, '(')]
+	}
+	return n.path[1:]
+}
+
+// paramMatches reports whether value satisfies the constraint of a param
+// node. Nodes without constraint match any value.
+func (n *node) paramMatches(value string) bool {
+	return n.constraint == nil || n.constraint.MatchString(value)
+}
+
+// catchAllSuffix is a catch-all handle which only matches if the captured
+// value ends with the given suffix.
+type catchAllSuffix struct {
+	suffix  string
+	handle  Handle
+	pattern string
+}
+
+// splitCatchAllSuffix splits a catch-all wildcard like '*path(*.mp4)' into its
+// name part '*path' and the required suffix '.mp4'. Static segments following
+// the catch-all belong to the suffix, e.g. '*path/raw' has the suffix '/raw'
+// and '*path(*.json)/raw' the suffix '.json/raw'.
+// The marker '(*' can not be part of a plain catch-all name, since wildcard
+// names must not contain '*', so names like '*file.path' keep their dots.
+func splitCatchAllSuffix(wildcard string) (name, suffix string) {
+	end := len(wildcard)
+	if i := strings.IndexByte(wildcard[1:], '/'); i >= 0 {
+		end = i + 1
+	}
+	name, suffix = wildcard[:end], wildcard[end:]
+	if i := strings.Index(name, "(*"); i >= 0 && strings.HasSuffix(name, ")") {
+		return name[:i], name[i+2:len(name)-1] + suffix
+	}
+	return name, suffix
+}
+
+// catchAllSuffixPattern returns the suffix as written in a route pattern,
+// i.e. the inverse of splitCatchAllSuffix: '.json/raw' becomes '(*.json)/raw'.
+func catchAllSuffixPattern(suffix string) string {
+	i := strings.IndexByte(suffix, '/')
+	if i < 0 {
+		i = len(suffix)
+	}
+	if i == 0 {
+		return suffix
+	}
+	return "(*" + suffix[:i] + ")" + suffix[i:]
+}
+
+// addSuffixHandle registers the handle for the given suffix on a catch-all
+// leaf. An empty suffix registers the plain catch-all handle.
+func (n *node) addSuffixHandle(suffix string, handle Handle, fullPath, pattern string) {
+	if suffix == "" {
+		if n.handle != nil {
+			panic("a handle is already registered for path '" + fullPath + "'")
+		}
+		n.handle = handle
+		n.pattern = pattern
+		return
+	}
+	if i := strings.IndexAny(suffix, ":*"); i >= 0 {
+		panic("only static segments may follow the catch-all '" + n.path + "', found '" +
+			suffix[i:] + "' in path '" + fullPath + "'")
+	}
+	for _, s := range n.suffixes {
+		if s.suffix == suffix {
+			panic("a handle is already registered for path '" + fullPath + "'")
+		}
+		// Suffixes are tried in registration order, so a longer suffix
+		// registered after one it ends with could never match.
+		if strings.HasSuffix(suffix, s.suffix) {
+			panic("catch-all suffix '" + suffix + "' in path '" + fullPath +
+				"' is unreachable, every path ending with it is already matched by the suffix '" +
+				s.suffix + "' registered before; register the longer suffix first")
+		}
+	}
+	n.suffixes = append(n.suffixes, catchAllSuffix{suffix: suffix, handle: handle, pattern: pattern})
+}
+
+// catchAllMatch returns the handle of a catch-all leaf for the remaining
+// path, the captured value and the suffix of the matching route. Suffixed
+// handles are tried in registration order before the plain catch-all handle.
+// Static segments following the catch-all are not part of the captured
+// value, which must not be empty.
+func (n *node) catchAllMatch(path string) (handle Handle, value, suffix string) {
+	for _, s := range n.suffixes {
+		if !strings.HasSuffix(path, s.suffix) {
+			continue
+		}
+		value = path
+		if i := strings.IndexByte(s.suffix, '/'); i >= 0 {
+			value = path[:len(path)-len(s.suffix)+i]
+			if value == "" {
+				continue
+			}
+		}
+		return s.handle, value, s.suffix
+	}
+	return n.handle, path, ""
+}
+
+// clone returns a deep copy of the tree rooted at n. Handles are shared.
+func (n *node) clone() *node {
+	c := *n
+	if n.children != nil {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.clone()
+		}
+	}
+	if n.suffixes != nil {
+		c.suffixes = append([]catchAllSuffix(nil), n.suffixes...)
+	}
+	return &c
 }
 
 // Increments priority of the given child and reorders if necessary
@@ -107,12 +364,18 @@ func (n *node) incrementChildPrio(pos int) int {
 // addRoute adds a node with the given handle to the path.
 // Not concurrency-safe!
 func (n *node) addRoute(path string, handle Handle) {
+	n.addPatternRoute(path, path, handle)
+}
+
+// addPatternRoute is like addRoute, but records pattern instead of path as
+// the route pattern of the handle, see matchedPattern.
+func (n *node) addPatternRoute(path, pattern string, handle Handle) {
 	fullPath := path
 	n.priority++
 
 	// Empty tree
 	if n.path == "" && n.indices == "" {
-		n.insertChild(path, fullPath, handle)
+		n.insertChild(path, fullPath, pattern, handle)
 		n.nType = root
 		return
 	}
@@ -133,6 +396,7 @@ walk:
 				indices:   n.indices,
 				children:  n.children,
 				handle:    n.handle,
+				pattern:   n.pattern,
 				priority:  n.priority - 1,
 			}
 
@@ -141,6 +405,7 @@ walk:
 			n.indices = string([]byte{n.path[i]})
 			n.path = path[:i]
 			n.handle = nil
+			n.pattern = ""
 			n.wildChild = false
 		}
 
@@ -152,6 +417,15 @@ walk:
 				n = n.children[0]
 				n.priority++
 
+				// Another catch-all with the same name, optionally
+				// distinguished by a suffix, e.g. /*path and /*path(*.mp4)
+				if n.nType == catchAll && strings.HasPrefix(path, n.path) {
+					if name, suffix := splitCatchAllSuffix(path); name == n.path {
+						n.addSuffixHandle(suffix, handle, fullPath, pattern)
+						return
+					}
+				}
+
 				// Check if the wildcard matches
 				if len(path) >= len(n.path) && n.path == path[:len(n.path)] &&
 					// Adding a child to a catchAll is not possible
@@ -201,7 +475,7 @@ walk:
 				n.incrementChildPrio(len(n.indices) - 1)
 				n = child
 			}
-			n.insertChild(path, fullPath, handle)
+			n.insertChild(path, fullPath, pattern, handle)
 			return
 		}
 
@@ -210,11 +484,12 @@ walk:
 			panic("a handle is already registered for path '" + fullPath + "'")
 		}
 		n.handle = handle
+		n.pattern = pattern
 		return
 	}
 }
 
-func (n *node) insertChild(path, fullPath string, handle Handle) {
+func (n *node) insertChild(path, fullPath, pattern string, handle Handle) {
 	for {
 		// Find prefix until first wildcard
 		wildcard, i, valid := findWildcard(path)
@@ -224,12 +499,16 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 		// The wildcard name must not contain ':' and '*'
 		if !valid {
+			if wildcard[0] == ':' && strings.IndexByte(wildcard, '(') > 0 {
+				panic("invalid constraint in wildcard '" + wildcard + "' in path '" + fullPath +
+					"': constraints must be enclosed in balanced parentheses and end the path segment")
+			}
 			panic("only one wildcard per path segment is allowed, has: '" +
 				wildcard + "' in path '" + fullPath + "'")
 		}
 
 		// Check if the wildcard has a name
-		if len(wildcard) < 2 {
+		if len(wildcard) < 2 || wildcard[1] == '(' {
 			panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
 		}
 
@@ -253,6 +532,13 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 				nType: param,
 				path:  wildcard,
 			}
+			if _, constraint := splitParam(wildcard); constraint != "" {
+				re, err := regexp.Compile("^(?:" + constraint + ")$")
+				if err != nil {
+					panic("invalid constraint in wildcard '" + wildcard + "' in path '" + fullPath + "': " + err.Error())
+				}
+				child.constraint = re
+			}
 			n.children = []*node{child}
 			n = child
 			n.priority++
@@ -271,14 +557,11 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 			// Otherwise we're done. Insert the handle in the new leaf
 			n.handle = handle
+			n.pattern = pattern
 			return
 		}
 
-		// catchAll
-		if i+len(wildcard) != len(path) {
-			panic("catch-all routes are only allowed at the end of the path in path '" + fullPath + "'")
-		}
-
+		// catchAll, optionally followed by static segments
 		if len(n.path) > 0 && n.path[len(n.path)-1] == '/' {
 			panic("catch-all conflicts with existing handle for the path segment root in path '" + fullPath + "'")
 		}
@@ -291,6 +574,12 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 		n.path = path[:i]
 
+		// A catch-all may require a suffix, e.g. /*path(*.mp4) or /*path/raw
+		name, suffix := splitCatchAllSuffix(path[i:])
+		if len(name) < 3 {
+			panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
+		}
+
 		// First node: catchAll node with empty path
 		child := &node{
 			wildChild: true,
@@ -303,11 +592,11 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 		// Second node: node holding the variable
 		child = &node{
-			path:     path[i:],
+			path:     name,
 			nType:    catchAll,
-			handle:   handle,
 			priority: 1,
 		}
+		child.addSuffixHandle(suffix, handle, fullPath, pattern)
 		n.children = []*node{child}
 
 		return
@@ -316,6 +605,7 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 	// If no wildcard was found, simply insert the path and handle
 	n.path = path
 	n.handle = handle
+	n.pattern = pattern
 }
 
 // Returns the handle registered with the given path (key). The values of
@@ -324,6 +614,14 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
 func (n *node) getValue(path string, params func() *Params) (handle Handle, ps *Params, tsr bool) {
+	return n.getFoldedValue(path, path, params)
+}
+
+// getFoldedValue is like getValue, but path is only used to walk the tree,
+// while the values of wildcards (and the values checked against constraints)
+// are taken from orig at the same byte offsets. orig must have the same length
+// as path, e.g. the request path that was folded with foldCase.
+func (n *node) getFoldedValue(path, orig string, params func() *Params) (handle Handle, ps *Params, tsr bool) {
 walk: // Outer loop for walking the tree
 	for {
 		prefix := n.path
@@ -360,6 +658,13 @@ walk: // Outer loop for walking the tree
 						end++
 					}
 
+					value := orig[len(orig)-len(path):][:end]
+
+					// A segment not satisfying the constraint does not match
+					if !n.paramMatches(value) {
+						return
+					}
+
 					// Save param value
 					if params != nil {
 						if ps == nil {
@@ -369,8 +674,8 @@ walk: // Outer loop for walking the tree
 						i := len(*ps)
 						*ps = (*ps)[:i+1]
 						(*ps)[i] = Param{
-							Key:   n.path[1:],
-							Value: path[:end],
+							Key:   n.paramKey(),
+							Value: value,
 						}
 					}
 
@@ -399,6 +704,10 @@ walk: // Outer loop for walking the tree
 					return
 
 				case catchAll:
+					var value string
+					handle, value, _ = n.catchAllMatch(path)
+					value = orig[len(orig)-len(path):][:len(value)]
+
 					// Save param value
 					if params != nil {
 						if ps == nil {
@@ -409,11 +718,9 @@ walk: // Outer loop for walking the tree
 						*ps = (*ps)[:i+1]
 						(*ps)[i] = Param{
 							Key:   n.path[2:],
-							Value: path,
+							Value: value,
 						}
 					}
-
-					handle = n.handle
 					return
 
 				default:
@@ -462,6 +769,124 @@ walk: // Outer loop for walking the tree
 	}
 }
 
+// closestMatch returns the longest prefix of path that can be matched by the
+// tree, i.e. the part of path consumed up to the deepest node reached before
+// the lookup failed. Parameter segments are counted with their request values.
+// It is only meant to be called after getValue found no handle.
+func (n *node) closestMatch(path string) string {
+	consumed := 0
+walk:
+	for {
+		prefix := n.path
+		if len(path)-consumed < len(prefix) || path[consumed:consumed+len(prefix)] != prefix {
+			return path[:consumed]
+		}
+		consumed += len(prefix)
+		if consumed == len(path) {
+			return path
+		}
+
+		if !n.wildChild {
+			idxc := path[consumed]
+			for i, c := range []byte(n.indices) {
+				if c == idxc {
+					n = n.children[i]
+					continue walk
+				}
+			}
+			return path[:consumed]
+		}
+
+		n = n.children[0]
+		if n.nType != param {
+			// A catch-all that did not match (e.g. suffix mismatch)
+			return path[:consumed]
+		}
+
+		// Skip the param value
+		end := consumed
+		for end < len(path) && path[end] != '/' {
+			end++
+		}
+		if !n.paramMatches(path[consumed:end]) {
+			return path[:consumed]
+		}
+		consumed = end
+		if consumed == len(path) || len(n.children) == 0 {
+			return path[:consumed]
+		}
+		n = n.children[0]
+	}
+}
+
+// matchedPattern returns the pattern the handle getValue finds for path was
+// registered with, or "" if there is none. It walks the tree exactly like
+// getValue, but does not collect the parameter values.
+func (n *node) matchedPattern(path string) string {
+	return n.matchedFoldedPattern(path, path)
+}
+
+// matchedFoldedPattern is like matchedPattern, but constraints are checked
+// against the values in orig, see getFoldedValue.
+func (n *node) matchedFoldedPattern(path, orig string) string {
+walk:
+	for {
+		prefix := n.path
+		if len(path) > len(prefix) {
+			if path[:len(prefix)] != prefix {
+				return ""
+			}
+			path = path[len(prefix):]
+
+			if !n.wildChild {
+				idxc := path[0]
+				for i, c := range []byte(n.indices) {
+					if c == idxc {
+						n = n.children[i]
+						continue walk
+					}
+				}
+				return ""
+			}
+
+			n = n.children[0]
+			if n.nType == catchAll {
+				handle, _, suffix := n.catchAllMatch(path)
+				if handle == nil {
+					return ""
+				}
+				for _, s := range n.suffixes {
+					if s.suffix == suffix {
+						return s.pattern
+					}
+				}
+				return n.pattern
+			}
+
+			// param: skip the value
+			end := 0
+			for end < len(path) && path[end] != '/' {
+				end++
+			}
+			if !n.paramMatches(orig[len(orig)-len(path):][:end]) {
+				return ""
+			}
+			if end < len(path) {
+				if len(n.children) > 0 {
+					path = path[end:]
+					n = n.children[0]
+					continue walk
+				}
+				return ""
+			}
+			return n.pattern
+		} else if path == prefix {
+			return n.pattern
+		}
+		return ""
+	}
+}
+
 // Makes a case-insensitive lookup of the given path and tries to find a handler.
 // It can optionally also fix trailing slashes.
 // It returns the case-corrected path and a bool indicating whether the lookup
@@ -607,6 +1032,10 @@ walk: // Outer loop for walking the tree
 					end++
 				}
 
+				if !n.paramMatches(path[:end]) {
+					return nil
+				}
+
 				// Add param value to case insensitive path
 				ciPath = append(ciPath, path[:end]...)
 
@@ -640,6 +1069,9 @@ walk: // Outer loop for walking the tree
 				return nil
 
 			case catchAll:
+				if handle, _, _ := n.catchAllMatch(path); handle == nil {
+					return nil
+				}
 				return append(ciPath, path...)
 
 			default:
@@ -60,6 +60,9 @@ func checkRequests(t *testing.T, tree *node, requests testRequests) {
 			if fakeHandlerValue != request.route {
 				t.Errorf("handle mismatch for route '%s': Wrong handle (%s != %s)", request.path, fakeHandlerValue, request.route)
 			}
+			if pattern := tree.matchedPattern(request.path); pattern != request.route {
+				t.Errorf("pattern mismatch for route '%s': %s != %s", request.path, pattern, request.route)
+			}
 		}
 
 		var ps Params
@@ -82,6 +85,7 @@ func checkPriorities(t *testing.T, n *node) uint32 {
 	if n.handle != nil {
 		prio++
 	}
+	prio += uint32(len(n.suffixes))
 
 	if n.priority != prio {
 		t.Errorf(
@@ -319,11 +323,15 @@ func TestEmptyWildcardName(t *testing.T) {
 
 func TestTreeCatchAllConflict(t *testing.T) {
 	routes := []testRoute{
-		{"/src/*filepath/x", true},
+		{"/src/*filepath/x", false},
 		{"/src2/", false},
 		{"/src2/*filepath/x", true},
 		{"/src3/*filepath", false},
-		{"/src3/*filepath/x", true},
+		{"/src3/*filepath/x", false},
+		{"/src3/*filepath/y/x", true}, // unreachable behind /x
+		{"/src3/*other/y", true},
+		{"/src4/*filepath/:x", true},
+		{"/src4/*filepath/x/*rest", true},
 	}
 	testRoutes(t, routes)
 }
@@ -336,6 +344,245 @@ func TestTreeCatchAllConflictRoot(t *testing.T) {
 	testRoutes(t, routes)
 }
 
+func TestTreeCatchAllSuffix(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/media/*path(*.mp4)",
+		"/media/*path(*.jpg)",
+		"/media/*path(*.tar.gz)",
+		"/media/*path(*.gz)",
+		"/video/*file(*.mp4)",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/media/a/b.mp4", false, "/media/*path(*.mp4)", Params{Param{"path", "/a/b.mp4"}}},
+		{"/media/b.jpg", false, "/media/*path(*.jpg)", Params{Param{"path", "/b.jpg"}}},
+		// overlapping suffixes are tried in registration order
+		{"/media/c.tar.gz", false, "/media/*path(*.tar.gz)", Params{Param{"path", "/c.tar.gz"}}},
+		{"/media/c.gz", false, "/media/*path(*.gz)", Params{Param{"path", "/c.gz"}}},
+		{"/media/c.png", true, "", Params{Param{"path", "/c.png"}}},
+		{"/video/v.mp4", false, "/video/*file(*.mp4)", Params{Param{"file", "/v.mp4"}}},
+		{"/video/v.jpg", true, "", Params{Param{"file", "/v.jpg"}}},
+	})
+
+	// a plain catch-all is the fallback if no suffix matches
+	tree.addRoute("/media/*path", fakeHandler("/media/*path"))
+	checkRequests(t, tree, testRequests{
+		{"/media/a/b.mp4", false, "/media/*path(*.mp4)", Params{Param{"path", "/a/b.mp4"}}},
+		{"/media/c.png", false, "/media/*path", Params{Param{"path", "/c.png"}}},
+	})
+
+	checkPriorities(t, tree)
+
+	if fixed, found := tree.findCaseInsensitivePath("/VIDEO/v.mp4", true); !found || fixed != "/video/v.mp4" {
+		t.Errorf("case insensitive lookup failed: %s, %v", fixed, found)
+	}
+	if _, found := tree.findCaseInsensitivePath("/VIDEO/v.jpg", true); found {
+		t.Error("case insensitive lookup matched a catch-all without a matching suffix")
+	}
+
+	for _, route := range []string{
+		"/media/*path(*.mp4)",   // duplicate suffix
+		"/media/*path",          // duplicate plain catch-all
+		"/media/*other(*.mp4)",  // different name
+		"/media/*(*.mp4)",       // empty name
+		"/media/*path(*.x.mp4)", // unreachable behind .mp4
+		"/media/*path/:id",      // wildcard after the catch-all
+	} {
+		if recv := catchPanic(func() { tree.addRoute(route, fakeHandler(route)) }); recv == nil {
+			t.Errorf("no panic while inserting route '%s'", route)
+		}
+	}
+	if recv := catchPanic(func() { (&node{}).addRoute("/*(*.mp4)", nil) }); recv == nil {
+		t.Error("no panic while inserting catch-all with empty name")
+	}
+}
+
+func TestTreeCatchAllDottedName(t *testing.T) {
+	tree := &node{}
+
+	// Dots belong to the name unless the suffix is marked with '(*...)'
+	tree.addRoute("/src/*file.path", fakeHandler("/src/*file.path"))
+	tree.addRoute("/lib/*v1.2", fakeHandler("/lib/*v1.2"))
+	checkRequests(t, tree, testRequests{
+		{"/src/a/b.go", false, "/src/*file.path", Params{Param{"file.path", "/a/b.go"}}},
+		{"/lib/x", false, "/lib/*v1.2", Params{Param{"v1.2", "/x"}}},
+	})
+
+	if recv := catchPanic(func() { tree.addRoute("/src/*file", nil) }); recv == nil {
+		t.Error("no panic while inserting a catch-all conflicting with a dotted name")
+	}
+
+	for _, route := range []string{
+		"/a/*path(*)",      // empty suffix
+		"/b/*path(*.mp4",   // unclosed suffix
+		"/c/*path(*.mp4)x", // trailing characters
+		"/d/*path(*.a/b)",  // '/' within the suffix marker
+	} {
+		if recv := catchPanic(func() { (&node{}).addRoute(route, fakeHandler(route)) }); recv == nil {
+			t.Errorf("no panic while inserting route '%s'", route)
+		}
+	}
+}
+
+func TestTreeCatchAllSegments(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/repos/*path/blob/raw",
+		"/repos/*path/blob",
+		"/repos/*path",
+		"/files/*name(*.json)/meta",
+		"/files/*name/meta",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	checkRequests(t, tree, testRequests{
+		// static segments after the catch-all are not part of the value
+		{"/repos/a/b/blob", false, "/repos/*path/blob", Params{Param{"path", "/a/b"}}},
+		{"/repos/a/blob/raw", false, "/repos/*path/blob/raw", Params{Param{"path", "/a"}}},
+		{"/repos/a/b", false, "/repos/*path", Params{Param{"path", "/a/b"}}},
+		// the catch-all must capture at least one segment
+		{"/repos/blob", false, "/repos/*path", Params{Param{"path", "/blob"}}},
+		{"/repos/blob/raw", false, "/repos/*path", Params{Param{"path", "/blob/raw"}}},
+		// a suffix within the last captured segment stays part of the value
+		{"/files/x.json/meta", false, "/files/*name(*.json)/meta", Params{Param{"name", "/x.json"}}},
+		{"/files/x.txt/meta", false, "/files/*name/meta", Params{Param{"name", "/x.txt"}}},
+		{"/files/meta", true, "", Params{Param{"name", "/meta"}}},
+	})
+
+	checkPriorities(t, tree)
+
+	for path, want := range map[string]string{
+		"/repos/a/b/blob":    "/repos/*path/blob",
+		"/repos/a/b":         "/repos/*path",
+		"/files/x.json/meta": "/files/*name(*.json)/meta",
+		"/files/meta":        "",
+	} {
+		if got := tree.matchedPattern(path); got != want {
+			t.Errorf("%s: want pattern %q, got %q", path, want, got)
+		}
+	}
+
+	if fixed, found := tree.findCaseInsensitivePath("/FILES/x.txt/meta", true); !found || fixed != "/files/x.txt/meta" {
+		t.Errorf("case insensitive lookup failed: %s, %v", fixed, found)
+	}
+}
+
+func TestTreeParamConstraint(t *testing.T) {
+	tree := &node{}
+	routes := [...]string{
+		`/users/:id(\d+)`,
+		`/users/:id(\d+)/posts/:slug([a-z-]+)`,
+		`/v:major([0-9]{1,2})/info`,
+		`/tags/:tag((?:go|rust)(?:-lang)?)`,
+		`/codes/:code([^/)]+)`,
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/users/42", false, `/users/:id(\d+)`, Params{Param{"id", "42"}}},
+		{"/users/gordon", true, "", nil},
+		{"/users/42x", true, "", nil},
+		{"/users/42/posts/hello-world", false, `/users/:id(\d+)/posts/:slug([a-z-]+)`, Params{Param{"id", "42"}, Param{"slug", "hello-world"}}},
+		{"/users/42/posts/Hello", true, "", Params{Param{"id", "42"}}},
+		{"/users/x/posts/hello", true, "", nil},
+		{"/v2/info", false, `/v:major([0-9]{1,2})/info`, Params{Param{"major", "2"}}},
+		{"/v123/info", true, "", nil},
+		{"/tags/go-lang", false, `/tags/:tag((?:go|rust)(?:-lang)?)`, Params{Param{"tag", "go-lang"}}},
+		{"/tags/golang", true, "", nil},
+		{"/codes/a(b", false, `/codes/:code([^/)]+)`, Params{Param{"code", "a(b"}}},
+	})
+	checkPriorities(t, tree)
+
+	if got := tree.closestMatch("/users/42/posts/Hello"); got != "/users/42/posts/" {
+		t.Errorf("closest match: want /users/42/posts/, got %s", got)
+	}
+	if _, found := tree.findCaseInsensitivePath("/USERS/42", true); !found {
+		t.Error("case-insensitive lookup failed for a constrained param")
+	}
+	if _, found := tree.findCaseInsensitivePath("/USERS/X", true); found {
+		t.Error("case-insensitive lookup ignored the constraint")
+	}
+	if n := countParams(`/a/:id((?::x)*)/b/:c(\d*)`); n != 2 {
+		t.Errorf("want 2 params, got %d", n)
+	}
+
+	// matching stays allocation-free
+	ps := make(Params, 0, 2)
+	allocs := testing.AllocsPerRun(100, func() {
+		ps = ps[:0]
+		tree.getValue("/users/42/posts/hello", func() *Params { return &ps })
+	})
+	if allocs != 0 {
+		t.Errorf("constrained match allocates: %v allocs", allocs)
+	}
+}
+
+func TestTreeParamConstraintConflict(t *testing.T) {
+	testRoutes(t, []testRoute{
+		{`/users/:id(\d+)`, false},
+		{`/users/:id(\d+)/posts`, false},
+		{`/users/:id`, true},
+		{`/users/:name([a-z]+)`, true},
+		{`/items/:id`, false},
+		{`/items/:id(\d+)`, true},
+	})
+
+	for _, route := range []string{
+		`/a/:id(\d+`,
+		`/a/:id(\d+)x`,
+		`/a/:id(\d+)x/b`,
+		`/a/:(\d+)`,
+		`/a/:id([a-)`,
+		`/a/:id(+)`,
+	} {
+		if recv := catchPanic(func() { (&node{}).addRoute(route, fakeHandler(route)) }); recv == nil {
+			t.Errorf("no panic for invalid constraint in '%s'", route)
+		}
+	}
+}
+
+func TestTreeClosestMatch(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/users",
+		"/users/:id/posts",
+		"/assets/*file(*.css)",
+		"/about",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	tests := []struct {
+		path, closest string
+	}{
+		{"/users/", "/users/"},
+		{"/users/5", "/users/5"},
+		{"/users/5/comments", "/users/5"},
+		{"/users/5/posts/1", "/users/5/posts"},
+		{"/usrs", "/"},
+		{"/assets/site.js", "/assets"},
+		{"/aboutus", "/about"},
+		{"/contact", "/"},
+	}
+	for _, tt := range tests {
+		if got := tree.closestMatch(tt.path); got != tt.closest {
+			t.Errorf("closestMatch(%q): want %q, got %q", tt.path, tt.closest, got)
+		}
+	}
+}
+
 func TestTreeCatchMaxParams(t *testing.T) {
 	tree := &node{}
 	var route = "/cmd/*filepath"
@@ -719,3 +966,56 @@ func TestRedirectTrailingSlash(t *testing.T) {
 		t.Fatalf("want true, is false")
 	}
 }
+
+func TestTreeFoldCase(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"/users/42", "/users/42"},
+		{"/Users/AbC", "/users/abc"},
+		{"/ÜBER/Straße", "/über/straße"},
+		{"/\u212Aelvin", "/\u212Aelvin"}, // the Kelvin sign folds to a shorter 'k'
+		{"/bad\xffPATH", "/bad\xffpath"},
+	} {
+		if got := foldCase(tc.in); got != tc.want || len(got) != len(tc.in) {
+			t.Errorf("foldCase(%q): want %q, got %q", tc.in, tc.want, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"/Users/:ID/Posts", "/users/:ID/posts"},
+		{"/Codes/:Code([A-Z]+)/X", "/codes/:Code([A-Z]+)/x"},
+		{"/Files/*Path(*.PDF)", "/files/*Path(*.pdf)"},
+		{"/Repos/*Rest/RAW", "/repos/*Rest/raw"},
+	} {
+		if got := foldPattern(tc.in); got != tc.want {
+			t.Errorf("foldPattern(%q): want %q, got %q", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestTreeGetFoldedValue(t *testing.T) {
+	tree := &node{}
+	tree.addRoute("/users/:id/files/*path(*.pdf)", fakeHandler("pdf"))
+	tree.addRoute("/codes/:code([A-Z]+)", fakeHandler("code"))
+
+	orig := "/Users/AbC/Files/Docs/Report.PDF"
+	handle, ps, _ := tree.getFoldedValue(foldCase(orig), orig, getParams)
+	if handle == nil {
+		t.Fatal("folded path not matched")
+	}
+	want := Params{{"id", "AbC"}, {"path", "/Docs/Report.PDF"}}
+	if !reflect.DeepEqual(*ps, want) {
+		t.Errorf("want params %v, got %v", want, *ps)
+	}
+
+	// constraints are checked against the original value
+	if handle, _, _ := tree.getFoldedValue("/codes/abc", "/codes/ABC", getParams); handle == nil {
+		t.Error("constraint not checked against the original value")
+	}
+	if handle, _, _ := tree.getFoldedValue("/codes/abc", "/codes/abc", getParams); handle != nil {
+		t.Error("lower-case value satisfied an upper-case constraint")
+	}
+}